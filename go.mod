@@ -1,3 +1,10 @@
 module github.com/naspinall/GoAP
 
 go 1.14
+
+require (
+	github.com/pion/dtls/v2 v2.2.12
+	github.com/pion/transport/v2 v2.2.10
+	golang.org/x/crypto v0.18.0
+	golang.org/x/net v0.20.0
+)
@@ -0,0 +1,198 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+
+	messages "github.com/naspinall/GoAP/pkg/message"
+)
+
+// SetBlockSize sets the preferred block size for block-wise transfers.
+func (c *Client) SetBlockSize(size int) error {
+	szx, err := messages.SZXFromSize(size)
+	if err != nil {
+		return err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.blockSZX = szx
+	return nil
+}
+
+// BlockSize returns the preferred block size for block-wise transfers.
+func (c *Client) BlockSize() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return (&messages.Block{SZX: c.blockSZX}).Size()
+}
+
+// Sends the request, splitting the payload into Block1 blocks when it does
+// not fit in a single block.
+func (c *Client) upload(ctx context.Context, message *messages.Message) (*messages.Message, error) {
+	payload := message.Payload
+	c.mutex.Lock()
+	block := &messages.Block{SZX: c.blockSZX}
+	c.mutex.Unlock()
+
+	// Requests fitting in a single block are sent as they are
+	if len(payload) <= block.Size() {
+		m, err := c.exchange(ctx, message)
+		if err != nil {
+			return nil, err
+		}
+
+		// Server only accepts smaller blocks
+		if !smallerBlock(m, block) {
+			return m, nil
+		}
+	}
+
+	var offset int
+	for {
+		end := offset + block.Size()
+		block.Num = uint(offset / block.Size())
+		block.More = end < len(payload)
+		if !block.More {
+			end = len(payload)
+		}
+
+		request, err := c.copyRequest(message)
+		if err != nil {
+			return nil, err
+		}
+		request.Payload = payload[offset:end]
+		request.Options.Block1 = &messages.Block{
+			Num:  block.Num,
+			More: block.More,
+			SZX:  block.SZX,
+		}
+
+		// Size1 tells the server the total size of the body
+		if block.Num == 0 {
+			request.Options.Size1 = uint(len(payload))
+		}
+
+		m, err := c.exchange(ctx, request)
+		if err != nil {
+			return nil, err
+		}
+
+		// Restarting the transfer with the size the server asked for
+		if smallerBlock(m, block) {
+			offset = 0
+			continue
+		}
+
+		// Final response, or the server rejected the transfer
+		if !block.More || m.Code != messages.Continue {
+			return m, nil
+		}
+
+		// Server can lower the block size during the transfer
+		if m.Options.Block1 != nil && m.Options.Block1.SZX < block.SZX {
+			block.SZX = m.Options.Block1.SZX
+		}
+
+		offset = end
+	}
+}
+
+// Checks a 4.13 Request Entity Too Large response for a smaller block size,
+// updating the block if there is one.
+func smallerBlock(m *messages.Message, block *messages.Block) bool {
+	if m.Code != messages.RequestEntityTooLarge || m.Options.Block1 == nil {
+		return false
+	}
+
+	if m.Options.Block1.SZX >= block.SZX {
+		return false
+	}
+
+	block.SZX = m.Options.Block1.SZX
+	return true
+}
+
+// Fetches the remaining blocks of a response split with the Block2 option.
+func (c *Client) download(ctx context.Context, message *messages.Message, m *messages.Message) (*messages.Message, error) {
+	block := m.Options.Block2
+	if block == nil {
+		return m, nil
+	}
+
+	// Collecting the full body
+	var payload []byte
+	eTag := m.Options.ETag
+
+	for {
+		// Blocks must arrive in order
+		if block.Offset() != len(payload) {
+			return nil, errors.New("Unexpected Block")
+		}
+		payload = append(payload, m.Payload...)
+
+		if !block.More {
+			break
+		}
+
+		// Requesting the next block with the size chosen by the server
+		next, err := c.copyRequest(message)
+		if err != nil {
+			return nil, err
+		}
+		next.Payload = nil
+		next.Options.Block2 = &messages.Block{
+			Num: block.Num + 1,
+			SZX: block.SZX,
+		}
+
+		m, err = c.exchange(ctx, next)
+		if err != nil {
+			return nil, err
+		}
+
+		block = m.Options.Block2
+		if block == nil {
+			return nil, errors.New("Missing Block2 Option")
+		}
+
+		// Resource changed during the transfer
+		if !sameETag(eTag, m.Options.ETag) {
+			return nil, errors.New("Representation Changed During Transfer")
+		}
+	}
+
+	// Returning the last response carrying the complete representation
+	m.Payload = payload
+	m.Options.Block2 = nil
+	return m, nil
+}
+
+// Creates a copy of the request with new message ID and token.
+func (c *Client) copyRequest(message *messages.Message) (*messages.Message, error) {
+	messageID, token, err := c.ids()
+	if err != nil {
+		return nil, err
+	}
+
+	options := *message.Options
+
+	m := messages.NewMessage(messages.WithType(message.Type), messages.WithMessageID(messageID), messages.WithToken(token), messages.WithPayload(message.Payload))
+	m.Code = message.Code
+	m.Options = &options
+
+	return m, nil
+}
+
+func sameETag(a, b [][]byte) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for index := range a {
+		if !bytes.Equal(a[index], b[index]) {
+			return false
+		}
+	}
+	return true
+}
@@ -1,17 +1,20 @@
 package client
 
 import (
-	"crypto/rand"
-	"encoding/binary"
+	"context"
 	"errors"
-	"log"
-	"math/big"
 	"net"
+	"sync"
+	"syscall"
 	"time"
 
 	messages "github.com/naspinall/GoAP/pkg/message"
+	"github.com/naspinall/GoAP/pkg/oscore"
+	"github.com/naspinall/GoAP/pkg/stream"
 )
 
+// Default transmission parameters and the values derived from them, in
+// seconds. See messages.TransmissionParams for other parameters.
 const (
 	MaxTransmitSpan  = 45  // Maximum time from first transmission to it's last retransmission
 	MaxTransmitWait  = 93  // Maximum time from first transmission to giving up on recieving an acknowledgement
@@ -24,26 +27,44 @@ const (
 	AckTimeout      = 2   // Minmum spacing before retransmission
 	AckRandomFactor = 1.5 // Random factor used to generate timeout
 	MaxRetransmit   = 4   // Maxmimun number of times to do a retransmission
-	Nstart          = 1   //
-	DefaultLeisure  = 5
-	ProbingRate     = 1
+	Nstart          = 1   // Maximum number of outstanding interactions with an endpoint
+	DefaultLeisure  = 5   // Maximum delay of responses to multicast requests
+	ProbingRate     = 1   // Bytes per second sent to endpoints that don't respond
 )
 
-type TokenChannel struct {
-	Token   []byte
-	Channel chan *messages.Message
-}
+// ErrReset is returned when the server rejects a confirmable message with
+// a reset, like one it couldn't parse.
+var ErrReset = errors.New("Message Reset")
 
-type MessageChannel struct {
-	Message chan *messages.Message
-	Error   chan error
-}
+// ErrTimeout is returned when the server doesn't acknowledge a request, or
+// doesn't send the response after acknowledging it.
+var ErrTimeout = errors.New("Timeout")
 
+// ErrBadOption is returned for responses with critical options the client
+// doesn't recognize, which are rejected (RFC 7252 5.4.1).
+var ErrBadOption = errors.New("Bad Option")
+
+// Client sends requests to a server. Any number of goroutines can use a
+// client at once.
 type Client struct {
-	ips             []net.IP
-	conn            *net.UDPConn
-	tokenChannels   map[uint64]chan *messages.Message
-	messageChannels map[uint16]*MessageChannel
+	conn      net.Conn // UDP, or DTLS for coaps
+	exchanges *exchanges
+
+	// Set for CoAP over TCP and TLS
+	session *stream.Session
+
+	// Congestion control state of the server, for datagram transports
+	endpoint *endpoint
+
+	// Settings changed while exchanges are going on
+	mutex    sync.Mutex
+	params   messages.TransmissionParams
+	rto      RTOEstimator    // Binary exponential backoff when nil
+	blockSZX uint8           // Preferred block size
+	security *oscore.Context // Set for protecting exchanges with OSCORE
+
+	done chan struct{}
+	once sync.Once
 }
 
 func NewClient(address string, port int) (*Client, error) {
@@ -61,53 +82,145 @@ func NewClient(address string, port int) (*Client, error) {
 		return nil, err
 	}
 
+	return newClient(conn), nil
+}
+
+// Creates a client exchanging datagrams over conn.
+func newClient(conn net.Conn) *Client {
 	c := &Client{
-		ips:             ips,
-		conn:            conn,
-		tokenChannels:   make(map[uint64]chan *messages.Message),
-		messageChannels: make(map[uint16]*MessageChannel),
+		conn:      conn,
+		exchanges: newExchanges(),
+		blockSZX:  messages.MaxBlockSZX,
+		params:    messages.DefaultTransmissionParams,
+		endpoint:  acquireEndpoint(conn.RemoteAddr().String()),
+		done:      make(chan struct{}),
 	}
 
 	// Listener for responses
 	go c.listen()
 
-	return c, nil
+	return c
+}
+
+// SetSecurityContext protects every following exchange end-to-end with
+// OSCORE (RFC 8613), so proxies on the way can't read or change requests
+// and responses. A nil context turns protection off.
+func (c *Client) SetSecurityContext(context *oscore.Context) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.security = context
+}
+
+// SecurityContext returns the OSCORE security context, if any.
+func (c *Client) SecurityContext() *oscore.Context {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.security
+}
+
+// SetTransmissionParams changes the parameters of retransmission for the
+// following exchanges.
+func (c *Client) SetTransmissionParams(params messages.TransmissionParams) error {
+	if err := params.Validate(); err != nil {
+		return err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.params = params
+	return nil
+}
+
+// TransmissionParams returns the parameters of retransmission.
+func (c *Client) TransmissionParams() messages.TransmissionParams {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.params
+}
+
+// SetRTOEstimator changes how retransmission timeouts are picked for the
+// following exchanges, like NewCoCoA for lossy links. A nil estimator uses
+// the binary exponential backoff of the transmission parameters.
+func (c *Client) SetRTOEstimator(estimator RTOEstimator) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.rto = estimator
+}
+
+// RTOEstimator returns the estimator of retransmission timeouts, if any.
+func (c *Client) RTOEstimator() RTOEstimator {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.rto
+}
+
+// Close closes the connection, ending all exchanges.
+func (c *Client) Close() error {
+	var err error
+	c.once.Do(func() {
+		close(c.done)
+		if c.session != nil {
+			err = c.session.Release()
+			return
+		}
+		releaseEndpoint(c.endpoint)
+		err = c.conn.Close()
+	})
+	return err
 }
 
 func (c *Client) listen() {
 	for {
 
 		// Read Message.
-		b := make([]byte, 1024)
-		if _, err := c.conn.Read(b); err != nil {
-			log.Fatal(err)
+		b := make([]byte, messages.MaxMessageSize)
+		n, err := c.conn.Read(b)
+		if err != nil {
+			// Port unreachable for an earlier datagram, retransmissions
+			// may still get through
+			if errors.Is(err, syscall.ECONNREFUSED) {
+				continue
+			}
+
+			// Connection failed, ending every exchange
+			c.Close()
+			return
 		}
 
-		// Decode Message.
-		m, err := messages.FromBytes(b)
+		// Decode Message, dropping malformed ones.
+		m, err := messages.FromBytes(b[:n])
 		if err != nil {
-			log.Fatal(err)
+			continue
 		}
 
-		// Get corresponding message channel.
-		mc, ok := c.messageChannels[m.MessageID]
-		if !ok {
-			// No message ID, message could be a response
-			tc, ok := c.tokenChannels[m.Token]
-			if ok {
-				// Sending response to handler
-				tc <- m
-				// Send acknowledgement message
-				go c.sendAck(m)
-			}
+		// Anything from the server shows it's responding again
+		c.endpoint.responded()
 
-			// If no corresponding token, drop message
+		// Acknowledgements and resets share the message ID of our requests
+		if m.Type == messages.Acknowledgement || m.Type == messages.Reset {
+			if r, ok := c.exchanges.reply(m.MessageID); ok {
+				r.deliver(m)
+			}
 			continue
 		}
 
-		// Send message down corresponding message channel.
-		mc.Message <- m
+		// Separate responses and notifications are matched on their token
+		r, ok := c.exchanges.response(m.Token)
+		if !ok {
+			// Rejecting responses nobody is waiting for, such as notifications
+			// for a cancelled observation.
+			go c.sendReset(m)
+			continue
+		}
 
+		if m.Type == messages.Confirmable {
+			if len(m.Options.BadOptions()) > 0 {
+				go c.sendReset(m)
+			} else {
+				go c.sendAck(m)
+			}
+		}
+		r.deliver(m)
 	}
 }
 
@@ -119,152 +232,254 @@ func (c *Client) sendAck(m *messages.Message) {
 	ack.Write(c.conn)
 }
 
-func (c *Client) generateToken() (uint64, error) {
-	// Generating the random token
-	tokenBytes := make([]byte, 8)
-	if _, err := rand.Read(tokenBytes); err != nil {
-		return 0, err
-	}
-	token, _ := binary.Uvarint(tokenBytes)
-
-	// Checking if already in use
-	_, ok := c.tokenChannels[token]
-	if ok {
-		return c.generateToken()
-	}
+func (c *Client) sendReset(m *messages.Message) {
+	// Creating RST Message
+	rst := messages.NewMessage(messages.WithMessageID(m.MessageID), messages.WithType(messages.Reset))
 
-	return token, nil
+	// Sending RST
+	rst.Write(c.conn)
 }
 
-func (c *Client) generateMessageID() (uint16, error) {
-	// Generating random message id
-	messageBytes := make([]byte, 2)
-	if _, err := rand.Read(messageBytes); err != nil {
-		return 0, err
-	}
-	// Converity to 16 bit integer
-	bigMessageID, _ := binary.Uvarint(messageBytes)
-	messageID := uint16(bigMessageID)
-
-	// Checking if already in use
-	_, ok := c.messageChannels[messageID]
-	if ok {
-		return c.generateMessageID()
-	}
-
-	return messageID, nil
+// Takes a message ID and token for a new request.
+func (c *Client) ids() (uint16, []byte, error) {
+	return c.exchanges.ids()
 }
 
-func (c *Client) setupSession(messageID uint16, token uint64) {
-	// Creating Channels
-	tc, mc, ec := make(chan *messages.Message), make(chan *messages.Message), make(chan error)
+// Do sends a request and waits for the response. Request payloads larger
+// than the block size are uploaded with the Block1 option, and responses
+// split with the Block2 option are returned as a single message.
+func (c *Client) Do(message *messages.Message) (*messages.Message, error) {
+	return c.DoContext(context.Background(), message)
+}
 
-	// Adding Channels to client map
-	c.tokenChannels[token], c.messageChannels[messageID] = tc, &MessageChannel{
-		Error:   ec,
-		Message: mc,
+// DoContext is Do with a context. Once the context is done retransmissions
+// stop, any response that arrives is dropped, and its error is returned.
+// Without a deadline, separate responses and responses over reliable
+// transports are waited for up to the exchange lifetime.
+func (c *Client) DoContext(ctx context.Context, message *messages.Message) (*messages.Message, error) {
+	m, err := c.upload(ctx, message)
+	if err != nil {
+		return nil, err
 	}
+
+	return c.download(ctx, message, m)
 }
 
-func (c *Client) teardownSession(messageID uint16, token uint64) {
-	delete(c.messageChannels, messageID)
-	delete(c.tokenChannels, token)
+// Sends a request and waits for the response, protecting both with OSCORE
+// when the client has a security context.
+func (c *Client) exchange(ctx context.Context, message *messages.Message) (*messages.Message, error) {
+	m, _, err := c.secureExchange(ctx, c.SecurityContext(), message)
+	return m, err
 }
 
-func (c *Client) randomIDs() (messageID uint16, token uint64, err error) {
-	randomID, err := rand.Int(rand.Reader, big.NewInt(0xFFFF))
-	if err != nil {
-		return 0, 0, err
+// Sends a request and waits for the response, protecting both with the
+// security context if there is one. Returns the OSCORE exchange responses
+// to the request are unprotected with.
+func (c *Client) secureExchange(ctx context.Context, security *oscore.Context, message *messages.Message) (*messages.Message, *oscore.Exchange, error) {
+	if security == nil {
+		m, err := c.transmit(ctx, message)
+		return m, nil, err
 	}
-	messageID = uint16(randomID.Uint64())
 
-	// Checking messageID not in use
-	if _, ok := c.messageChannels[messageID]; ok {
-		return c.randomIDs()
+	protected, exchange, err := security.ProtectRequest(message)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	randomID, err = rand.Int(rand.Reader, big.NewInt(0xFFFFFFFFFFFFFFF))
+	m, err := c.transmit(ctx, protected)
 	if err != nil {
-		return 0, 0, err
+		return nil, nil, err
 	}
-	token = randomID.Uint64()
 
-	// Checking token not in use
-	if _, ok := c.tokenChannels[token]; ok {
-		return c.randomIDs()
-	}
+	m, err = unprotect(security, m, exchange)
+	return m, exchange, err
+}
 
-	return
+// Unprotects a response. Servers send errors about OSCORE itself, like an
+// unknown security context, without protection.
+func unprotect(security *oscore.Context, m *messages.Message, exchange *oscore.Exchange) (*messages.Message, error) {
+	if m.Options.OSCORE == nil && m.Code >= messages.Bad {
+		return m, nil
+	}
+	return security.UnprotectResponse(m, exchange)
 }
 
-func (c *Client) Do(message *messages.Message) (*messages.Message, error) {
+// Sends a message, retransmitting confirmable messages until acknowledged.
+// Non-confirmable messages are sent once (RFC 7252 4.3). Confirmable
+// messages wait while NSTART interactions with the server are outstanding,
+// and messages to a server that stopped responding are sent no faster than
+// the probing rate.
+func (c *Client) transmit(ctx context.Context, message *messages.Message) (*messages.Message, error) {
+	// Reliable transports have no retransmission or acknowledgements
+	if c.session != nil {
+		return c.exchangeStream(ctx, message)
+	}
+
 	// Retransmit
 	var retransmit int
 
-	// Message timout
-	timeout := AckTimeout * AckRandomFactor // TODO make this a random value.
+	// Not sending anything for exchanges that are already cancelled
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	// Message timout, doubling with every retransmission unless estimated
+	params, estimator := c.TransmissionParams(), c.RTOEstimator()
+	if message.Type != messages.Confirmable {
+		estimator = nil
+	}
+	addr := c.conn.RemoteAddr().String()
+	initial := params.InitialTimeout()
+	if estimator != nil {
+		initial = estimator.Timeout(addr, params)
+	}
+	timeout := initial
 	messageID, token := message.MessageID, message.Token
 
-	// Setting up CoAP message session
-	c.setupSession(messageID, token)
+	// Waiting for the interaction to be one of the outstanding ones, which
+	// ends once acknowledged or on giving up
+	finish := func() {}
+	if message.Type == messages.Confirmable {
+		if err := c.endpoint.start(ctx, params.Nstart, c.done); err != nil {
+			return nil, err
+		}
+
+		var once sync.Once
+		finish = func() { once.Do(c.endpoint.finish) }
+		defer finish()
+	}
+
+	if err := message.Encode(); err != nil {
+		return nil, err
+	}
+	if err := c.endpoint.pace(ctx, len(message.Bytes()), params.ProbingRate, c.done); err != nil {
+		return nil, err
+	}
+
+	// Adding the exchange, so the listener can find it
+	replies, responses, done := c.exchanges.open(messageID, token)
+	defer c.exchanges.close(messageID, token, done)
+
+	// Round trips from the first transmission feed the estimator
+	start := time.Now()
+	measure := func() {
+		if estimator != nil {
+			estimator.Measure(addr, params, time.Since(start), retransmit)
+		}
+	}
 
-	// Getting Message Channels
-	messageChannel := c.messageChannels[messageID].Message
+	// Non-confirmable messages only get a response, or a reset
+	if message.Type != messages.Confirmable {
+		if err := message.Write(c.conn); err != nil {
+			return nil, err
+		}
+		return c.waitForResponse(ctx, replies, responses)
+	}
 
 	// Keep retransmitting until MaxRetransmit
-	for retransmit <= MaxRetransmit {
+	for retransmit <= params.MaxRetransmit {
 
 		// Sending Message
 		message.Write(c.conn)
-		log.Println("Message Sent")
 
-		ticker := time.NewTicker(time.Duration(timeout) * time.Second)
+		timer := time.NewTimer(timeout)
 
 		select {
-		case m := <-messageChannel:
+		case m := <-replies:
+			timer.Stop()
+			measure()
 
-			if m.Type != messages.Acknowledgement {
-				c.teardownSession(messageID, token)
+			if m.Type == messages.Reset {
+				return nil, ErrReset
 			}
 
-			log.Println("Acknowledge Recieved")
 			// If a piggbacked response, send message to reciever
 			if m.Code != messages.Empty {
-				c.teardownSession(messageID, token)
-				return m, nil
+				return checkOptions(m)
 			}
 
 			// Transmission Complete
-			return c.waitForResponse(token)
+			finish()
+			return c.waitForResponse(ctx, nil, responses)
+
+		case m := <-responses:
+			// Separate response overtook a lost acknowledgement
+			timer.Stop()
+			measure()
+			return checkOptions(m)
 
-		case <-ticker.C:
+		case <-timer.C:
 
 			// Increase retransmit timmer
 			retransmit++
 
 			// Increase timeout
-			timeout *= 2
+			if estimator != nil {
+				timeout = estimator.Backoff(initial, timeout)
+			} else {
+				timeout *= 2
+			}
+
+		case <-ctx.Done():
+			// Cancelled, no more retransmissions
+			timer.Stop()
+			return nil, ctx.Err()
+
+		case <-c.done:
+			timer.Stop()
+			return nil, ErrClosed
 		}
 
 	}
 
+	// Server isn't responding, probing it from now on
+	c.endpoint.timedOut()
+
 	// Sending timeout error
-	c.teardownSession(messageID, token)
-	return nil, errors.New("Timout")
+	return nil, ErrTimeout
 }
 
-func (c *Client) waitForResponse(token uint64) (*messages.Message, error) {
-	tokenChannel := c.tokenChannels[token]
+// Waits for the separate response to an acknowledged request, the response
+// to a non-confirmable request, or the response on a reliable transport.
+// Resets arrive on replies, if waiting for them. Without a deadline on the
+// context, the response is given up on once the exchange lifetime is over.
+func (c *Client) waitForResponse(ctx context.Context, replies <-chan *messages.Message, responses <-chan *messages.Message) (*messages.Message, error) {
+	var expired <-chan time.Time
+	if _, ok := ctx.Deadline(); !ok {
+		timer := time.NewTimer(c.TransmissionParams().ExchangeLifetime())
+		defer timer.Stop()
+		expired = timer.C
+	}
 
-	select {
+	for {
+		select {
 
-	// Waiting for response
-	case m := <-tokenChannel:
-		log.Println("Response Recieved")
-		return m, nil
+		// Waiting for response
+		case m := <-responses:
+			return checkOptions(m)
 
-	}
+		// Acknowledgements of non-confirmable messages mean nothing
+		case m := <-replies:
+			if m.Type == messages.Reset {
+				return nil, ErrReset
+			}
 
-	return nil, errors.New("Response Timeout")
+		case <-expired:
+			return nil, ErrTimeout
 
+		case <-ctx.Done():
+			return nil, ctx.Err()
+
+		case <-c.done:
+			return nil, ErrClosed
+		}
+	}
+}
+
+// Rejects responses with critical options the client doesn't recognize.
+func checkOptions(m *messages.Message) (*messages.Message, error) {
+	if len(m.Options.BadOptions()) > 0 {
+		return nil, ErrBadOption
+	}
+	return m, nil
 }
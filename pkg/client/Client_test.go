@@ -0,0 +1,631 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	messages "github.com/naspinall/GoAP/pkg/message"
+)
+
+// Serves body in blocks of blockSize bytes as piggybacked responses.
+func blockServer(t *testing.T, body []byte, blockSize int) *net.UDPConn {
+	return testServer(t, func(request *messages.Message, reply func(*messages.Message)) {
+		var num uint
+		if request.Options.Block2 != nil {
+			num = request.Options.Block2.Num
+		}
+
+		block, err := messages.NewBlock(num, false, blockSize)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		end := block.Offset() + block.Size()
+		if end >= len(body) {
+			end = len(body)
+		} else {
+			block.More = true
+		}
+
+		response := piggyback(request, messages.Content, messages.WithPayload(body[block.Offset():end]))
+		response.Options.Block2 = block
+		response.Options.ETag = [][]byte{{0x01}}
+		reply(response)
+	})
+}
+
+func TestClient_GetBlockwise(t *testing.T) {
+	tests := []struct {
+		name      string
+		length    int
+		blockSize int
+	}{
+		{
+			name:      "Single Block",
+			length:    10,
+			blockSize: 1024,
+		},
+		{
+			name:      "Exact Blocks",
+			length:    64,
+			blockSize: 16,
+		},
+		{
+			name:      "Partial Last Block",
+			length:    2500,
+			blockSize: 1024,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := make([]byte, tt.length)
+			for index := range body {
+				body[index] = byte(index)
+			}
+
+			conn := blockServer(t, body, tt.blockSize)
+			defer conn.Close()
+
+			c, err := NewClient("127.0.0.1", conn.LocalAddr().(*net.UDPAddr).Port)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			m, err := c.Get("coap://127.0.0.1/firmware")
+			if err != nil {
+				t.Fatalf("Client.Get() error = %v", err)
+			}
+
+			if !bytes.Equal(m.Payload, body) {
+				t.Errorf("Client.Get() Payload length = %v, want %v", len(m.Payload), len(body))
+			}
+			if m.Options.Block2 != nil {
+				t.Errorf("Client.Get() Block2 = %+v, want nil", m.Options.Block2)
+			}
+		})
+	}
+}
+
+// Accepts Block1 uploads of at most maxBlock bytes per block, sending the
+// reassembled body down the returned channel.
+func uploadServer(t *testing.T, maxBlock int) (*net.UDPConn, chan []byte) {
+	bodies := make(chan []byte, 1)
+	maxSZX, err := messages.SZXFromSize(maxBlock)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var body []byte
+	conn := testServer(t, func(request *messages.Message, reply func(*messages.Message)) {
+		response := piggyback(request, messages.Changed)
+		block := request.Options.Block1
+
+		switch {
+		case block == nil && len(request.Payload) > maxBlock, block != nil && block.SZX > maxSZX:
+			response.Code = messages.RequestEntityTooLarge
+			response.Options.Block1 = &messages.Block{SZX: maxSZX}
+		case block == nil:
+			bodies <- request.Payload
+		default:
+			if block.Num == 0 {
+				body = nil
+			}
+			body = append(body[:block.Offset()], request.Payload...)
+			response.Options.Block1 = block
+			response.Code = messages.Continue
+			if !block.More {
+				response.Code = messages.Changed
+				bodies <- body
+			}
+		}
+
+		reply(response)
+	})
+
+	return conn, bodies
+}
+
+func TestClient_PostBlockwise(t *testing.T) {
+	tests := []struct {
+		name      string
+		length    int
+		blockSize int
+		maxBlock  int
+	}{
+		{
+			name:      "Single Block",
+			length:    100,
+			blockSize: 1024,
+			maxBlock:  1024,
+		},
+		{
+			name:      "Multiple Blocks",
+			length:    3000,
+			blockSize: 1024,
+			maxBlock:  1024,
+		},
+		{
+			name:      "Server Requests Smaller Blocks",
+			length:    3000,
+			blockSize: 1024,
+			maxBlock:  256,
+		},
+		{
+			name:      "Single Block Too Large",
+			length:    500,
+			blockSize: 1024,
+			maxBlock:  64,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := make([]byte, tt.length)
+			for index := range body {
+				body[index] = byte(index)
+			}
+
+			conn, bodies := uploadServer(t, tt.maxBlock)
+			defer conn.Close()
+
+			c, err := NewClient("127.0.0.1", conn.LocalAddr().(*net.UDPAddr).Port)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := c.SetBlockSize(tt.blockSize); err != nil {
+				t.Fatal(err)
+			}
+
+			m, err := c.Post("coap://127.0.0.1/upload", messages.WithPayload(body))
+			if err != nil {
+				t.Fatalf("Client.Post() error = %v", err)
+			}
+			if m.Code != messages.Changed {
+				t.Fatalf("Client.Post() Code = %v, want %v", m.Code, messages.Changed)
+			}
+
+			if got := <-bodies; !bytes.Equal(got, body) {
+				t.Errorf("Client.Post() uploaded length = %v, want %v", len(got), len(body))
+			}
+		})
+	}
+}
+
+func TestClient_Observe(t *testing.T) {
+	deregistered := make(chan bool, 1)
+
+	conn := testServer(t, func(request *messages.Message, reply func(*messages.Message)) {
+		if request.Code != messages.GET {
+			return
+		}
+
+		response := piggyback(request, messages.Content, messages.WithPayload([]byte("0")))
+		if *request.Options.Observe == messages.ObserveDeregister {
+			deregistered <- true
+			reply(response)
+			return
+		}
+
+		response.Options.Observe = new(uint)
+		reply(response)
+
+		// Notifications, with a stale one in the middle
+		for index, sequence := range []uint{2, 1, 3} {
+			notification := messages.NewMessage(messages.WithType(messages.NonConfirmable), messages.WithMessageID(uint16(100+index)), messages.WithToken(request.Token), messages.WithObserve(sequence), messages.WithPayload([]byte{'0' + byte(sequence)}))
+			notification.Code = messages.Content
+			reply(notification)
+		}
+	})
+	defer conn.Close()
+
+	c, err := NewClient("127.0.0.1", conn.LocalAddr().(*net.UDPAddr).Port)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	received := make(chan string, 4)
+	o, err := c.Observe("coap://127.0.0.1/temperature", func(m *messages.Message) {
+		received <- string(m.Payload)
+	})
+	if err != nil {
+		t.Fatalf("Client.Observe() error = %v", err)
+	}
+
+	for _, want := range []string{"0", "2", "3"} {
+		select {
+		case got := <-received:
+			if got != want {
+				t.Errorf("Client.Observe() notification = %v, want %v", got, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Client.Observe() missing notification %v", want)
+		}
+	}
+
+	if err := o.Cancel(); err != nil {
+		t.Fatalf("Observation.Cancel() error = %v", err)
+	}
+	if !<-deregistered {
+		t.Errorf("Observation.Cancel() didn't deregister")
+	}
+
+	select {
+	case <-o.Done():
+	default:
+		t.Errorf("Observation.Done() not closed after Cancel")
+	}
+}
+
+func TestClient_ObserveSlowHandler(t *testing.T) {
+	body := bytes.Repeat([]byte("0123456789abcdef"), 4)
+	serve := func(request *messages.Message, num uint) *messages.Message {
+		block, _ := messages.NewBlock(num, false, 16)
+		block.More = block.Offset()+16 < len(body)
+		response := piggyback(request, messages.Content, messages.WithPayload(body[block.Offset():block.Offset()+16]))
+		response.Options.Block2 = block
+		return response
+	}
+
+	conn := testServer(t, func(request *messages.Message, reply func(*messages.Message)) {
+		switch {
+		case request.Options.Block2 != nil:
+			reply(serve(request, request.Options.Block2.Num))
+
+		case request.Options.Observe != nil && *request.Options.Observe == messages.ObserveRegister:
+			response := piggyback(request, messages.Content, messages.WithPayload([]byte("0")))
+			response.Options.Observe = new(uint)
+			reply(response)
+
+			// A notification split into blocks, then more queueing behind it
+			notification := serve(request, 0)
+			notification.Type, notification.MessageID = messages.NonConfirmable, 100
+			notification.Options.Observe = new(uint)
+			*notification.Options.Observe = 1
+			reply(notification)
+			for sequence := uint(2); sequence < 6; sequence++ {
+				notification := messages.NewMessage(messages.WithType(messages.NonConfirmable), messages.WithMessageID(uint16(100+sequence)), messages.WithToken(request.Token), messages.WithObserve(sequence), messages.WithPayload([]byte("later")))
+				notification.Code = messages.Content
+				reply(notification)
+			}
+
+		default:
+			reply(piggyback(request, messages.Content, messages.WithPayload([]byte("other"))))
+		}
+	})
+	defer conn.Close()
+
+	c, err := NewClient("127.0.0.1", conn.LocalAddr().(*net.UDPAddr).Port)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	received := make(chan []byte, 1)
+	release := make(chan struct{})
+	o, err := c.Observe("coap://127.0.0.1/firmware", func(m *messages.Message) {
+		if string(m.Payload) == "0" {
+			return
+		}
+
+		// Holding up the handler on the first notification
+		select {
+		case received <- m.Payload:
+			<-release
+		default:
+		}
+	})
+	if err != nil {
+		t.Fatalf("Client.Observe() error = %v", err)
+	}
+	defer o.Cancel()
+
+	select {
+	case got := <-received:
+		if !bytes.Equal(got, body) {
+			t.Errorf("Client.Observe() notification = %q, want %q", got, body)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Client.Observe() missing block-wise notification")
+	}
+
+	// Other exchanges go on while the handler is busy
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	m, err := c.GetContext(ctx, "coap://127.0.0.1/other")
+	close(release)
+	if err != nil {
+		t.Fatalf("Client.GetContext() error = %v", err)
+	}
+	if string(m.Payload) != "other" {
+		t.Errorf("Client.GetContext() payload = %q, want %q", m.Payload, "other")
+	}
+}
+
+func TestObservation_fresh(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name     string
+		last     uint
+		sequence uint
+		received time.Time
+		want     bool
+	}{
+		{
+			name:     "Newer",
+			last:     5,
+			sequence: 6,
+			received: now,
+			want:     true,
+		},
+		{
+			name:     "Older",
+			last:     6,
+			sequence: 5,
+			received: now,
+			want:     false,
+		},
+		{
+			name:     "Duplicate",
+			last:     6,
+			sequence: 6,
+			received: now,
+			want:     false,
+		},
+		{
+			name:     "Wrapped Around",
+			last:     0xFFFFFF,
+			sequence: 1,
+			received: now,
+			want:     true,
+		},
+		{
+			name:     "Older But Long Ago",
+			last:     6,
+			sequence: 5,
+			received: now.Add(ObserveFreshness + time.Second),
+			want:     true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := &Observation{sequence: tt.last, received: now}
+			if got := o.fresh(tt.sequence, tt.received); got != tt.want {
+				t.Errorf("Observation.fresh() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClient_DoContext(t *testing.T) {
+	tests := []struct {
+		name        string
+		acknowledge bool // Server acknowledges the request, but never responds
+	}{
+		{
+			name: "Retransmitting",
+		},
+		{
+			name:        "Waiting For Separate Response",
+			acknowledge: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := testServer(t, func(request *messages.Message, reply func(*messages.Message)) {
+				if tt.acknowledge {
+					reply(messages.NewMessage(messages.WithType(messages.Acknowledgement), messages.WithMessageID(request.MessageID)))
+				}
+			})
+			defer conn.Close()
+
+			c, err := NewClient("127.0.0.1", conn.LocalAddr().(*net.UDPAddr).Port)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer c.Close()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+
+			start := time.Now()
+			if _, err := c.GetContext(ctx, "coap://127.0.0.1/slow"); err != context.DeadlineExceeded {
+				t.Errorf("Client.GetContext() error = %v, want %v", err, context.DeadlineExceeded)
+			}
+			if elapsed := time.Since(start); elapsed > time.Second {
+				t.Errorf("Client.GetContext() took %v after the deadline", elapsed)
+			}
+
+			if n := c.exchanges.len(); n != 0 {
+				t.Errorf("Client exchanges = %d, want none left", n)
+			}
+		})
+	}
+}
+
+func TestClient_SeparateResponseTimeout(t *testing.T) {
+	// Acknowledging without ever sending the response
+	conn := testServer(t, func(request *messages.Message, reply func(*messages.Message)) {
+		reply(messages.NewMessage(messages.WithType(messages.Acknowledgement), messages.WithMessageID(request.MessageID)))
+	})
+	defer conn.Close()
+
+	c, err := NewClient("127.0.0.1", conn.LocalAddr().(*net.UDPAddr).Port)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	params := messages.DefaultTransmissionParams
+	params.AckTimeout, params.MaxLatency, params.ProcessingDelay = 10*time.Millisecond, 20*time.Millisecond, 10*time.Millisecond
+	if err := c.SetTransmissionParams(params); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	if _, err := c.Get("coap://127.0.0.1/slow"); err != ErrTimeout {
+		t.Errorf("Client.Get() error = %v, want %v", err, ErrTimeout)
+	}
+	if elapsed := time.Since(start); elapsed < params.ExchangeLifetime() || elapsed > time.Second {
+		t.Errorf("Client.Get() gave up after %v, want about %v", elapsed, params.ExchangeLifetime())
+	}
+	if n := c.exchanges.len(); n != 0 {
+		t.Errorf("Client exchanges = %d, want none left", n)
+	}
+}
+
+func TestClient_NonConfirmable(t *testing.T) {
+	tests := []struct {
+		name    string
+		reply   messages.MessageType // Reply to the request, or none
+		wantErr error
+	}{
+		{
+			name:    "Not Retransmitted",
+			wantErr: context.DeadlineExceeded,
+		},
+		{
+			name:    "Acknowledged",
+			reply:   messages.Acknowledgement,
+			wantErr: context.DeadlineExceeded,
+		},
+		{
+			name:    "Reset",
+			reply:   messages.Reset,
+			wantErr: ErrReset,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sent int32
+			conn := testServer(t, func(request *messages.Message, reply func(*messages.Message)) {
+				atomic.AddInt32(&sent, 1)
+				if tt.reply != 0 {
+					reply(messages.NewMessage(messages.WithType(tt.reply), messages.WithMessageID(request.MessageID)))
+				}
+			})
+			defer conn.Close()
+
+			c, err := NewClient("127.0.0.1", conn.LocalAddr().(*net.UDPAddr).Port)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer c.Close()
+
+			params := messages.DefaultTransmissionParams
+			params.AckTimeout = 10 * time.Millisecond
+			if err := c.SetTransmissionParams(params); err != nil {
+				t.Fatal(err)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+
+			if _, err := c.GetContext(ctx, "coap://127.0.0.1/hello", messages.WithType(messages.NonConfirmable)); err != tt.wantErr {
+				t.Errorf("Client.GetContext() error = %v, want %v", err, tt.wantErr)
+			}
+			if n := atomic.LoadInt32(&sent); n != 1 {
+				t.Errorf("Client.GetContext() sent the request %d times, want once", n)
+			}
+		})
+	}
+}
+
+func TestClient_DoContextCancelled(t *testing.T) {
+	c, err := NewClient("127.0.0.1", 9)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := c.GetContext(ctx, "coap://127.0.0.1/"); err != context.Canceled {
+		t.Errorf("Client.GetContext() error = %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestClient_ParallelGet(t *testing.T) {
+	conn := echoServer(t)
+	defer conn.Close()
+
+	c, err := NewClient("127.0.0.1", conn.LocalAddr().(*net.UDPAddr).Port)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	const requests = 64
+
+	// Settings change while requests are going on
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		for size := 512; ; size ^= 512 ^ 1024 {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			c.SetBlockSize(size)
+			c.SetSecurityContext(nil)
+			time.Sleep(time.Millisecond)
+		}
+	}()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, requests)
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			// Every response must come back to the request it answers
+			payload := []byte(strconv.Itoa(i))
+			m, err := c.Put("coap://127.0.0.1/things", messages.WithPayload(payload))
+			if err != nil {
+				errs <- err
+				return
+			}
+			if !bytes.Equal(m.Payload[1:], payload) {
+				errs <- fmt.Errorf("response payload = %q, want %q", m.Payload[1:], payload)
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+	if n := c.exchanges.len(); n != 0 {
+		t.Errorf("Client exchanges = %d, want none left", n)
+	}
+}
+
+func TestClient_BadOption(t *testing.T) {
+	// Responding with an unregistered critical option
+	conn := testServer(t, func(request *messages.Message, reply func(*messages.Message)) {
+		response := piggyback(request, messages.Content, messages.WithPayload([]byte("hello")))
+		response.Options.Raw = append(response.Options.Raw, messages.Option{Number: 2063, Value: []byte{1}})
+		reply(response)
+	})
+	defer conn.Close()
+
+	c, err := NewClient("127.0.0.1", conn.LocalAddr().(*net.UDPAddr).Port)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if _, err := c.Get("coap://127.0.0.1/hello"); err != ErrBadOption {
+		t.Errorf("Client.Get() error = %v, want %v", err, ErrBadOption)
+	}
+}
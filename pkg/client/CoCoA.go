@@ -0,0 +1,172 @@
+package client
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+
+	messages "github.com/naspinall/GoAP/pkg/message"
+)
+
+// RTOEstimator picks the retransmission timeouts of confirmable messages,
+// replacing the fixed binary exponential backoff of RFC 7252 4.2.
+type RTOEstimator interface {
+	// Timeout returns the wait before the first retransmission of a message
+	// to the endpoint at addr.
+	Timeout(addr string, params messages.TransmissionParams) time.Duration
+
+	// Backoff returns the wait before the next retransmission, given the
+	// initial timeout of the exchange and the one that just expired.
+	Backoff(initial, timeout time.Duration) time.Duration
+
+	// Measure records the time from the first transmission of a message to
+	// the endpoint at addr to its acknowledgement, after retransmissions.
+	Measure(addr string, params messages.TransmissionParams, rtt time.Duration, retransmissions int)
+}
+
+// CoCoA bounds and variable backoff thresholds
+const (
+	cocoaMaxRTO      = 60 * time.Second
+	cocoaLowRTO      = time.Second
+	cocoaHighRTO     = 3 * time.Second
+	cocoaStrongK     = 4
+	cocoaWeakK       = 1
+	cocoaWeakSamples = 2 // Retransmissions after which round trips are too ambiguous to use
+)
+
+// CoCoA is the RTO estimator of CoAP Simple Congestion Control/Advanced
+// (draft-ietf-core-cocoa). Round trips of messages acknowledged without
+// retransmission feed a strong estimate, and those acknowledged after one or
+// two retransmissions a weak estimate, per endpoint. A CoCoA can be shared
+// by clients.
+type CoCoA struct {
+	mutex     sync.Mutex
+	endpoints map[string]*cocoaEndpoint
+	now       func() time.Time
+}
+
+type cocoaEndpoint struct {
+	strong, weak rttEstimate
+	rto          time.Duration // Overall RTO, blending both estimates
+	updated      time.Time
+}
+
+// Smoothed round trip time and its variation, like RFC 6298.
+type rttEstimate struct {
+	srtt, rttvar time.Duration
+	measured     bool
+}
+
+// NewCoCoA creates an estimator without measurements.
+func NewCoCoA() *CoCoA {
+	return &CoCoA{
+		endpoints: make(map[string]*cocoaEndpoint),
+		now:       time.Now,
+	}
+}
+
+// Timeout returns the overall RTO of the endpoint, starting at the ACK
+// timeout, times a random factor up to the ACK random factor.
+func (c *CoCoA) Timeout(addr string, params messages.TransmissionParams) time.Duration {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	e := c.endpoint(addr, params)
+	c.age(e, params)
+
+	spread := float64(e.rto) * (params.AckRandomFactor - 1)
+	return e.rto + time.Duration(rand.Float64()*spread)
+}
+
+// Backoff multiplies the timeout by a factor that's larger for short
+// initial timeouts, so retransmissions don't come too fast, and smaller for
+// long ones, so they don't come too slow.
+func (c *CoCoA) Backoff(initial, timeout time.Duration) time.Duration {
+	switch {
+	case initial < cocoaLowRTO:
+		return 3 * timeout
+	case initial > cocoaHighRTO:
+		return timeout * 3 / 2
+	default:
+		return 2 * timeout
+	}
+}
+
+// Measure updates the strong or weak estimate of the endpoint, and the
+// overall RTO with it. Strong estimates make up half of the new RTO and weak
+// ones a quarter. Messages retransmitted more than twice are ignored.
+func (c *CoCoA) Measure(addr string, params messages.TransmissionParams, rtt time.Duration, retransmissions int) {
+	if retransmissions > cocoaWeakSamples {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	e := c.endpoint(addr, params)
+
+	if retransmissions == 0 {
+		e.rto = (e.rto + e.strong.update(rtt, cocoaStrongK)) / 2
+	} else {
+		e.rto = e.rto*3/4 + e.weak.update(rtt, cocoaWeakK)/4
+	}
+	if e.rto > cocoaMaxRTO {
+		e.rto = cocoaMaxRTO
+	}
+	e.updated = c.now()
+}
+
+// RTO returns the overall RTO of the endpoint at addr, and whether it has
+// been measured.
+func (c *CoCoA) RTO(addr string) (time.Duration, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	e, ok := c.endpoints[addr]
+	if !ok {
+		return 0, false
+	}
+	return e.rto, e.strong.measured || e.weak.measured
+}
+
+func (c *CoCoA) endpoint(addr string, params messages.TransmissionParams) *cocoaEndpoint {
+	e, ok := c.endpoints[addr]
+	if !ok {
+		e = &cocoaEndpoint{rto: params.AckTimeout, updated: c.now()}
+		c.endpoints[addr] = e
+	}
+	return e
+}
+
+// Moves RTOs that haven't been updated for a while back towards the ACK
+// timeout, as they may no longer reflect the network.
+func (c *CoCoA) age(e *cocoaEndpoint, params messages.TransmissionParams) {
+	now := c.now()
+	idle := now.Sub(e.updated)
+
+	switch {
+	case e.rto < cocoaLowRTO && idle > 16*e.rto:
+		e.rto *= 2
+	case e.rto > cocoaHighRTO && idle > 4*e.rto:
+		e.rto = (e.rto + params.AckTimeout) / 2
+	default:
+		return
+	}
+	e.updated = now
+}
+
+// Updates the estimate with a round trip, returning the RTO with k times
+// the variation.
+func (r *rttEstimate) update(rtt time.Duration, k time.Duration) time.Duration {
+	if !r.measured {
+		r.srtt, r.rttvar, r.measured = rtt, rtt/2, true
+	} else {
+		delta := r.srtt - rtt
+		if delta < 0 {
+			delta = -delta
+		}
+		r.rttvar = r.rttvar*3/4 + delta/4
+		r.srtt = r.srtt*7/8 + rtt/8
+	}
+	return r.srtt + k*r.rttvar
+}
@@ -0,0 +1,148 @@
+package client
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	messages "github.com/naspinall/GoAP/pkg/message"
+)
+
+func TestCoCoA_Measure(t *testing.T) {
+	type sample struct {
+		rtt             time.Duration
+		retransmissions int
+	}
+	tests := []struct {
+		name       string
+		ackTimeout time.Duration
+		samples    []sample
+		want       time.Duration
+	}{
+		{
+			name:    "Strong",
+			samples: []sample{{100 * time.Millisecond, 0}},
+			want:    1150 * time.Millisecond, // (2s + 100ms + 4 * 50ms) / 2
+		},
+		{
+			name:    "Strong Then Weak",
+			samples: []sample{{100 * time.Millisecond, 0}, {400 * time.Millisecond, 1}},
+			want:    1012500 * time.Microsecond, // 1150ms * 3/4 + (400ms + 200ms) / 4
+		},
+		{
+			name:    "Strong Twice",
+			samples: []sample{{100 * time.Millisecond, 0}, {100 * time.Millisecond, 0}},
+			want:    700 * time.Millisecond, // (1150ms + 100ms + 4 * 37.5ms) / 2
+		},
+		{
+			name:    "Too Many Retransmissions",
+			samples: []sample{{100 * time.Millisecond, 0}, {5 * time.Second, 3}},
+			want:    1150 * time.Millisecond,
+		},
+		{
+			name:       "Configured ACK Timeout",
+			ackTimeout: time.Second,
+			samples:    []sample{{100 * time.Millisecond, 0}},
+			want:       650 * time.Millisecond, // (1s + 100ms + 4 * 50ms) / 2
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params := messages.DefaultTransmissionParams
+			if tt.ackTimeout != 0 {
+				params.AckTimeout = tt.ackTimeout
+			}
+
+			c := NewCoCoA()
+			for _, s := range tt.samples {
+				c.Measure("endpoint", params, s.rtt, s.retransmissions)
+			}
+			if got, _ := c.RTO("endpoint"); got != tt.want {
+				t.Errorf("CoCoA.RTO() = %v, want %v", got, tt.want)
+			}
+			if _, measured := c.RTO("other"); measured {
+				t.Error("CoCoA.RTO() of another endpoint measured")
+			}
+		})
+	}
+}
+
+func TestCoCoA_Backoff(t *testing.T) {
+	tests := []struct {
+		name    string
+		initial time.Duration
+		want    time.Duration
+	}{
+		{name: "Short", initial: 500 * time.Millisecond, want: 3 * time.Second},
+		{name: "Default", initial: 2 * time.Second, want: 2 * time.Second},
+		{name: "Long", initial: 4 * time.Second, want: 1500 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NewCoCoA().Backoff(tt.initial, time.Second); got != tt.want {
+				t.Errorf("CoCoA.Backoff() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCoCoA_Timeout(t *testing.T) {
+	tests := []struct {
+		name       string
+		ackTimeout time.Duration
+		rto        time.Duration
+		idle       time.Duration
+		want       time.Duration
+	}{
+		{name: "Short", rto: 500 * time.Millisecond, idle: 7 * time.Second, want: 500 * time.Millisecond},
+		{name: "Short Aged", rto: 500 * time.Millisecond, idle: 9 * time.Second, want: time.Second},
+		{name: "Long", rto: 6 * time.Second, idle: 20 * time.Second, want: 6 * time.Second},
+		{name: "Long Aged", rto: 6 * time.Second, idle: 25 * time.Second, want: 4 * time.Second},
+		{name: "Long Aged Configured", ackTimeout: 4 * time.Second, rto: 6 * time.Second, idle: 25 * time.Second, want: 5 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := time.Now()
+			c := NewCoCoA()
+			c.now = func() time.Time { return now }
+			c.endpoints["endpoint"] = &cocoaEndpoint{rto: tt.rto, updated: now}
+
+			params := messages.DefaultTransmissionParams
+			params.AckRandomFactor = 1
+			if tt.ackTimeout != 0 {
+				params.AckTimeout = tt.ackTimeout
+			}
+
+			now = now.Add(tt.idle)
+			if got := c.Timeout("endpoint", params); got != tt.want {
+				t.Errorf("CoCoA.Timeout() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClient_SetRTOEstimator(t *testing.T) {
+	conn := echoServer(t)
+	defer conn.Close()
+
+	c, err := NewClient("127.0.0.1", conn.LocalAddr().(*net.UDPAddr).Port)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	estimator := NewCoCoA()
+	c.SetRTOEstimator(estimator)
+
+	for i := 0; i < 4; i++ {
+		if _, err := c.Get("coap://127.0.0.1/things"); err != nil {
+			t.Fatalf("Client.Get() error = %v", err)
+		}
+	}
+
+	// Quick local round trips bring the RTO well under the ACK timeout
+	rto, measured := estimator.RTO(conn.LocalAddr().String())
+	if !measured || rto >= messages.DefaultTransmissionParams.AckTimeout/4 {
+		t.Errorf("CoCoA.RTO() = %v, %v, want under %v", rto, measured, messages.DefaultTransmissionParams.AckTimeout/4)
+	}
+}
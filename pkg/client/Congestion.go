@@ -0,0 +1,162 @@
+package client
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// endpoint is the congestion control state of a destination (RFC 7252 4.7),
+// shared by every client sending to it.
+type endpoint struct {
+	key  string
+	refs int // Clients sending to the endpoint
+
+	mutex       sync.Mutex
+	outstanding int             // Interactions waiting for an acknowledgement or response
+	waiting     []chan struct{} // Interactions queued for a free slot, first come first served
+
+	// Endpoints that stopped responding get messages no faster than the
+	// probing rate, until they respond again
+	unresponsive bool
+	next         time.Time
+}
+
+var endpoints = struct {
+	sync.Mutex
+	m map[string]*endpoint
+}{m: make(map[string]*endpoint)}
+
+// Returns the state of the endpoint at addr, which must be released once
+// the client is done with it.
+func acquireEndpoint(addr string) *endpoint {
+	endpoints.Lock()
+	defer endpoints.Unlock()
+
+	e, ok := endpoints.m[addr]
+	if !ok {
+		e = &endpoint{key: addr}
+		endpoints.m[addr] = e
+	}
+	e.refs++
+	return e
+}
+
+func releaseEndpoint(e *endpoint) {
+	endpoints.Lock()
+	defer endpoints.Unlock()
+
+	if e.refs--; e.refs == 0 {
+		delete(endpoints.m, e.key)
+	}
+}
+
+// start waits until fewer than nstart interactions with the endpoint are
+// outstanding. Interactions that start must end with finish.
+func (e *endpoint) start(ctx context.Context, nstart int, closed <-chan struct{}) error {
+	e.mutex.Lock()
+	if e.outstanding < nstart && len(e.waiting) == 0 {
+		e.outstanding++
+		e.mutex.Unlock()
+		return nil
+	}
+
+	ready := make(chan struct{})
+	e.waiting = append(e.waiting, ready)
+	e.mutex.Unlock()
+
+	var err error
+	select {
+	case <-ready:
+		return nil
+	case <-ctx.Done():
+		err = ctx.Err()
+	case <-closed:
+		err = ErrClosed
+	}
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	for index, waiting := range e.waiting {
+		if waiting == ready {
+			e.waiting = append(e.waiting[:index], e.waiting[index+1:]...)
+			return err
+		}
+	}
+
+	// Slot was handed over while giving up, passing it on
+	e.finishLocked()
+	return err
+}
+
+// finish ends an outstanding interaction, handing its slot to the next
+// one queued.
+func (e *endpoint) finish() {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	e.finishLocked()
+}
+
+func (e *endpoint) finishLocked() {
+	if len(e.waiting) > 0 {
+		ready := e.waiting[0]
+		e.waiting = e.waiting[1:]
+		close(ready)
+		return
+	}
+	e.outstanding--
+}
+
+// pace waits until size bytes can be sent without exceeding the probing
+// rate, if the endpoint isn't responding.
+func (e *endpoint) pace(ctx context.Context, size int, probingRate float64, closed <-chan struct{}) error {
+	e.mutex.Lock()
+	if !e.unresponsive {
+		e.mutex.Unlock()
+		return nil
+	}
+
+	now := time.Now()
+	if e.next.Before(now) {
+		e.next = now
+	}
+	wait := e.next.Sub(now)
+	e.next = e.next.Add(time.Duration(float64(size) / probingRate * float64(time.Second)))
+	e.mutex.Unlock()
+
+	if wait <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-closed:
+		return ErrClosed
+	}
+}
+
+// responded records the endpoint answered a message.
+func (e *endpoint) responded() {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	e.unresponsive = false
+}
+
+// timedOut records the endpoint never answered a confirmable message.
+func (e *endpoint) timedOut() {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if !e.unresponsive {
+		e.unresponsive, e.next = true, time.Now()
+	}
+}
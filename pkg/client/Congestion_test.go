@@ -0,0 +1,162 @@
+package client
+
+import (
+	"context"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	messages "github.com/naspinall/GoAP/pkg/message"
+)
+
+// Replies to every request after delay, recording the most requests it was
+// answering at once.
+func slowServer(t *testing.T, delay time.Duration, most *int32) *net.UDPConn {
+	var outstanding int32
+	return testServer(t, func(request *messages.Message, reply func(*messages.Message)) {
+		now := atomic.AddInt32(&outstanding, 1)
+		for {
+			seen := atomic.LoadInt32(most)
+			if now <= seen || atomic.CompareAndSwapInt32(most, seen, now) {
+				break
+			}
+		}
+
+		go func() {
+			time.Sleep(delay)
+			atomic.AddInt32(&outstanding, -1)
+			reply(piggyback(request, messages.Content))
+		}()
+	})
+}
+
+func TestClient_Nstart(t *testing.T) {
+	tests := []struct {
+		name   string
+		nstart int
+	}{
+		{name: "One", nstart: 1},
+		{name: "Two", nstart: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var most int32
+			conn := slowServer(t, 20*time.Millisecond, &most)
+			defer conn.Close()
+
+			// Clients of the same server share the limit
+			var clients []*Client
+			for i := 0; i < 2; i++ {
+				c, err := NewClient("127.0.0.1", conn.LocalAddr().(*net.UDPAddr).Port)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer c.Close()
+
+				params := messages.DefaultTransmissionParams
+				params.Nstart = tt.nstart
+				if err := c.SetTransmissionParams(params); err != nil {
+					t.Fatal(err)
+				}
+				clients = append(clients, c)
+			}
+
+			var wg sync.WaitGroup
+			for i := 0; i < 8; i++ {
+				wg.Add(1)
+				go func(c *Client) {
+					defer wg.Done()
+					if _, err := c.Get("coap://127.0.0.1/slow"); err != nil {
+						t.Errorf("Client.Get() error = %v", err)
+					}
+				}(clients[i%len(clients)])
+			}
+			wg.Wait()
+
+			if got := atomic.LoadInt32(&most); got != int32(tt.nstart) {
+				t.Errorf("Client.Get() had %d requests outstanding at once, want %d", got, tt.nstart)
+			}
+		})
+	}
+}
+
+func TestClient_NstartCancelled(t *testing.T) {
+	// Server that never answers
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	c, err := NewClient("127.0.0.1", conn.LocalAddr().(*net.UDPAddr).Port)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	// Taking the only slot
+	outstanding, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go c.GetContext(outstanding, "coap://127.0.0.1/lost")
+	time.Sleep(10 * time.Millisecond)
+
+	ctx, cancelQueued := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancelQueued()
+	if _, err := c.GetContext(ctx, "coap://127.0.0.1/queued"); err != context.DeadlineExceeded {
+		t.Fatalf("Client.GetContext() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	// Slot goes to the next request once the outstanding one gives up
+	cancel()
+	ctx, cancelNext := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancelNext()
+	var sent int32
+	go func() {
+		b := make([]byte, messages.MaxMessageSize)
+		if _, _, err := conn.ReadFrom(b); err == nil {
+			atomic.StoreInt32(&sent, 1)
+		}
+	}()
+	c.GetContext(ctx, "coap://127.0.0.1/next")
+	if atomic.LoadInt32(&sent) == 0 {
+		t.Error("Client.GetContext() never sent the request after the outstanding one was cancelled")
+	}
+}
+
+func TestClient_ProbingRate(t *testing.T) {
+	// Server that never answers
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	c, err := NewClient("127.0.0.1", conn.LocalAddr().(*net.UDPAddr).Port)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	params := messages.DefaultTransmissionParams
+	params.AckTimeout, params.MaxRetransmit, params.ProbingRate = 5*time.Millisecond, 0, 200
+	if err := c.SetTransmissionParams(params); err != nil {
+		t.Fatal(err)
+	}
+
+	// Responsive servers get requests straight away
+	start := time.Now()
+	c.Get("coap://127.0.0.1/lost")
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Fatalf("Client.Get() took %v to time out, want no pacing", elapsed)
+	}
+
+	// Once timed out, requests of over 20 bytes go out every 100ms or more
+	start = time.Now()
+	c.Get("coap://127.0.0.1/lost")
+	c.Get("coap://127.0.0.1/lost")
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("Client.Get() sent to an unresponsive server after %v, want at least %v", elapsed, 100*time.Millisecond)
+	}
+}
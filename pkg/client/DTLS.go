@@ -0,0 +1,28 @@
+package client
+
+import (
+	"net"
+
+	"github.com/pion/dtls/v2"
+)
+
+// NewDTLSClient connects to a coaps server, securing the exchanges with
+// DTLS 1.2. The security package has configurations for the pre-shared key
+// and certificate modes of RFC 7252 9, and for certificates with pinned
+// public keys.
+func NewDTLSClient(address string, port int, config *dtls.Config) (*Client, error) {
+	ips, err := net.LookupIP(address)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := dtls.Dial("udp", &net.UDPAddr{
+		IP:   ips[0],
+		Port: port,
+	}, config)
+	if err != nil {
+		return nil, err
+	}
+
+	return newClient(conn), nil
+}
@@ -0,0 +1,206 @@
+package client
+
+import (
+	"errors"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/naspinall/GoAP/pkg/link"
+	messages "github.com/naspinall/GoAP/pkg/message"
+)
+
+// Lifetime of registrations without one, the directory's default (RFC 9176
+// 5.3).
+const defaultRegistrationLifetime = 90000 * time.Second
+
+// ErrRegistrationFailed is returned when a resource directory rejects a
+// registration or an update.
+var ErrRegistrationFailed = errors.New("Registration Failed")
+
+// Registration keeps an endpoint registered with a resource directory (RFC
+// 9176), updating it before its lifetime ends until it is closed.
+type Registration struct {
+	Endpoint string        // Name of the endpoint, required
+	Sector   string        // Optional
+	Base     string        // URI the links are relative to, the client's address if empty
+	Lifetime time.Duration // Whole seconds, 90000 seconds if zero
+	Links    link.Links
+
+	client    *Client
+	directory *url.URL
+
+	mutex    sync.Mutex
+	location *url.URL
+
+	done chan struct{}
+	once sync.Once
+}
+
+// Register registers an endpoint with the registration interface of a
+// resource directory, such as "coap://rd.example.com/rd", and keeps it
+// registered until the registration is closed.
+func (c *Client) Register(directory string, r *Registration) error {
+	u, err := url.Parse(directory)
+	if err != nil {
+		return err
+	}
+	if r.Endpoint == "" {
+		return errors.New("Endpoint Name Required")
+	}
+
+	r.client, r.directory, r.done = c, u, make(chan struct{})
+	if err := r.register(); err != nil {
+		return err
+	}
+
+	go r.refresh()
+	return nil
+}
+
+// Location is the URI of the registration resource in the directory.
+func (r *Registration) Location() string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.location == nil {
+		return ""
+	}
+	return r.location.String()
+}
+
+func (r *Registration) lifetime() time.Duration {
+	if r.Lifetime == 0 {
+		return defaultRegistrationLifetime
+	}
+	return r.Lifetime
+}
+
+func (r *Registration) register() error {
+	queries := []string{"ep=" + r.Endpoint}
+	if r.Sector != "" {
+		queries = append(queries, "d="+r.Sector)
+	}
+	if r.Base != "" {
+		queries = append(queries, "base="+r.Base)
+	}
+	queries = append(queries, "lt="+strconv.FormatInt(int64(r.lifetime()/time.Second), 10))
+
+	m, err := r.request(messages.Post(), r.directory, queries)
+	if err != nil {
+		return err
+	}
+	m.Payload = r.Links.Bytes()
+	m.Options.SetContentFormat(messages.LinkFormat)
+
+	response, err := r.client.Do(m)
+	if err != nil {
+		return err
+	}
+	if response.Code != messages.Created {
+		return ErrRegistrationFailed
+	}
+
+	location, err := Location(r.directory.String(), response)
+	if err != nil {
+		return err
+	}
+
+	r.mutex.Lock()
+	r.location = location
+	r.mutex.Unlock()
+
+	return nil
+}
+
+// Update refreshes the registration, restarting its lifetime. Registrations
+// the directory no longer has, say after a restart, are made again.
+func (r *Registration) Update() error {
+	r.mutex.Lock()
+	location := r.location
+	r.mutex.Unlock()
+
+	m, err := r.request(messages.Post(), location, nil)
+	if err != nil {
+		return err
+	}
+
+	response, err := r.client.Do(m)
+	if err != nil {
+		return err
+	}
+
+	switch response.Code {
+	case messages.Changed:
+		return nil
+	case messages.NotFound:
+		return r.register()
+	default:
+		return ErrRegistrationFailed
+	}
+}
+
+// Updates the registration a tenth of its lifetime before it ends, trying
+// again sooner when updates fail.
+func (r *Registration) refresh() {
+	lifetime := r.lifetime()
+	wait := lifetime - lifetime/10
+
+	for {
+		select {
+		case <-time.After(wait):
+			wait = lifetime - lifetime/10
+			if err := r.Update(); err != nil {
+				wait = lifetime / 20
+			}
+
+		case <-r.done:
+			return
+		}
+	}
+}
+
+// Close stops updating the registration and removes it from the directory.
+func (r *Registration) Close() error {
+	closed := false
+	r.once.Do(func() {
+		close(r.done)
+		closed = true
+	})
+	if !closed {
+		return nil
+	}
+
+	r.mutex.Lock()
+	location := r.location
+	r.mutex.Unlock()
+
+	m, err := r.request(messages.Delete(), location, nil)
+	if err != nil {
+		return err
+	}
+
+	response, err := r.client.Do(m)
+	if err != nil {
+		return err
+	}
+	if response.Code != messages.Deleted && response.Code != messages.NotFound {
+		return ErrRegistrationFailed
+	}
+	return nil
+}
+
+func (r *Registration) request(method messages.MessagesConfig, u *url.URL, queries []string) (*messages.Message, error) {
+	messageID, token, err := r.client.ids()
+	if err != nil {
+		return nil, err
+	}
+
+	m := messages.NewMessage(method, messages.WithMessageID(messageID), messages.WithToken(token), messages.WithURI(u.String()))
+	if m == nil {
+		return nil, errors.New("Bad Request URI")
+	}
+	m.Options.URIQuery = queries
+	return m, nil
+}
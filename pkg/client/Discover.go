@@ -0,0 +1,54 @@
+package client
+
+import (
+	"errors"
+	"net/url"
+
+	"github.com/naspinall/GoAP/pkg/link"
+	messages "github.com/naspinall/GoAP/pkg/message"
+)
+
+var (
+	ErrDiscoveryFailed = errors.New("Discovery Failed")            // Server responded with an error
+	ErrNotLinkFormat   = errors.New("Response Not In Link Format") // Server responded with something other than links
+)
+
+// Discover fetches the links to the resources of the server at URI from
+// /.well-known/core (RFC 6690 4). Queries like "rt=temperature*" are sent to
+// the server, and applied to the links again as servers needn't filter.
+func (c *Client) Discover(URI string, queries ...string) (link.Links, error) {
+	u, err := url.Parse(URI)
+	if err != nil {
+		return nil, err
+	}
+	u.Path, u.RawQuery = link.WellKnownCore, ""
+
+	messageID, token, err := c.ids()
+	if err != nil {
+		return nil, err
+	}
+
+	m := messages.NewMessage(messages.Get(), messages.WithMessageID(messageID), messages.WithToken(token), messages.WithURI(u.String()))
+	if m == nil {
+		return nil, errors.New("Bad Request URI")
+	}
+	m.Options.URIQuery = queries
+
+	m, err = c.Do(m)
+	if err != nil {
+		return nil, err
+	}
+
+	if m.Code != messages.Content {
+		return nil, ErrDiscoveryFailed
+	}
+	if m.Options.ContentFormat == nil || *m.Options.ContentFormat != messages.LinkFormat {
+		return nil, ErrNotLinkFormat
+	}
+
+	links, err := link.Parse(m.Payload)
+	if err != nil {
+		return nil, err
+	}
+	return links.Filter(queries...), nil
+}
@@ -0,0 +1,102 @@
+package client
+
+import (
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/naspinall/GoAP/pkg/link"
+	messages "github.com/naspinall/GoAP/pkg/message"
+)
+
+func TestClient_Discover(t *testing.T) {
+	links := link.Links{
+		link.New("/sensors/light", link.ResourceType("light-lux")),
+		link.New("/sensors/temp", link.ContentFormat(messages.TextPlain), link.Observable(), link.ResourceType("temperature-c")),
+	}
+
+	// Servers needn't filter, so this one sends every link whatever the
+	// queries, unless asked to fail
+	queries := make(chan []string, 1)
+	conn := testServer(t, func(request *messages.Message, reply func(*messages.Message)) {
+		queries <- request.Options.URIQuery
+
+		switch {
+		case strings.Join(request.Options.URIPath, "/") != ".well-known/core":
+			reply(piggyback(request, messages.NotFound))
+		case reflect.DeepEqual(request.Options.URIQuery, []string{"rt=missing"}):
+			reply(piggyback(request, messages.NotFound))
+		case reflect.DeepEqual(request.Options.URIQuery, []string{"rt=text"}):
+			reply(piggyback(request, messages.Content, messages.WithContentFormat(messages.TextPlain), messages.WithPayload(links.Bytes())))
+		default:
+			reply(piggyback(request, messages.Content, messages.WithContentFormat(messages.LinkFormat), messages.WithPayload(links.Bytes())))
+		}
+	})
+	defer conn.Close()
+
+	c, err := NewClient("127.0.0.1", conn.LocalAddr().(*net.UDPAddr).Port)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	tests := []struct {
+		name    string
+		queries []string
+		want    []string
+		wantErr error
+	}{
+		{
+			name: "Every Resource",
+			want: []string{"/sensors/light", "/sensors/temp"},
+		},
+		{
+			name:    "Resource Type",
+			queries: []string{"rt=temp*"},
+			want:    []string{"/sensors/temp"},
+		},
+		{
+			name:    "Observable",
+			queries: []string{"obs"},
+			want:    []string{"/sensors/temp"},
+		},
+		{
+			name:    "No Match",
+			queries: []string{"rt=humidity"},
+			want:    []string{},
+		},
+		{
+			name:    "Failed",
+			queries: []string{"rt=missing"},
+			wantErr: ErrDiscoveryFailed,
+		},
+		{
+			name:    "Not Link Format",
+			queries: []string{"rt=text"},
+			wantErr: ErrNotLinkFormat,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			links, err := c.Discover("coap://127.0.0.1/sensors?rt=ignored", tt.queries...)
+			if sent := <-queries; !reflect.DeepEqual(sent, tt.queries) {
+				t.Errorf("Client.Discover() sent queries %v, want %v", sent, tt.queries)
+			}
+			if err != tt.wantErr {
+				t.Fatalf("Client.Discover() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+
+			got := []string{}
+			for _, l := range links {
+				got = append(got, l.Target)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Client.Discover() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
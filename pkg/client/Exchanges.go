@@ -0,0 +1,206 @@
+package client
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"sync"
+
+	messages "github.com/naspinall/GoAP/pkg/message"
+)
+
+// Length of the random tokens of requests, long enough that responses
+// can't be guessed (RFC 7252 5.3.1)
+const tokenLength = 8
+
+// receiver is where the messages of an exchange are delivered.
+type receiver struct {
+	messages chan *messages.Message
+	done     <-chan struct{} // Closed once nobody reads messages anymore
+	drop     bool            // Dropping messages there is no room for, instead of waiting
+}
+
+// Delivers a message, waiting until it is read or the receiver is done.
+// Observations never hold up the listener, dropping notifications when they
+// fall behind.
+func (r *receiver) deliver(m *messages.Message) {
+	if r.drop {
+		select {
+		case r.messages <- m:
+		default:
+		}
+		return
+	}
+
+	select {
+	case r.messages <- m:
+	case <-r.done:
+	}
+}
+
+// exchanges is the table of a client's outstanding exchanges. Requests are
+// added and removed by the goroutines sending them while the listener looks
+// up replies, so every access holds the mutex.
+type exchanges struct {
+	mutex        sync.Mutex
+	next         uint16               // Next message ID
+	replies      map[uint16]*receiver // Acknowledgements and resets, by message ID
+	responses    map[string]*receiver // Responses and notifications, by token bytes
+	observations map[string]*Observation
+}
+
+func newExchanges() *exchanges {
+	e := &exchanges{
+		replies:      make(map[uint16]*receiver),
+		responses:    make(map[string]*receiver),
+		observations: make(map[string]*Observation),
+	}
+
+	// Message IDs count up from a random start (RFC 7252 4.4)
+	b := make([]byte, 2)
+	rand.Read(b)
+	e.next = binary.BigEndian.Uint16(b)
+
+	return e
+}
+
+// ids takes a message ID and a random token that no exchange is using.
+func (e *exchanges) ids() (uint16, []byte, error) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	for {
+		token := make([]byte, tokenLength)
+		if _, err := rand.Read(token); err != nil {
+			return 0, nil, err
+		}
+		if _, ok := e.responses[string(token)]; !ok {
+			return e.nextMessageID(), token, nil
+		}
+	}
+}
+
+// messageID takes a message ID that no exchange is using.
+func (e *exchanges) messageID() uint16 {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	return e.nextMessageID()
+}
+
+func (e *exchanges) nextMessageID() uint16 {
+	for {
+		messageID := e.next
+		e.next++
+		if _, ok := e.replies[messageID]; !ok {
+			return messageID
+		}
+	}
+}
+
+// open adds an exchange, returning the channels its reply and response
+// arrive on, and the channel closing it. Responses to observation requests
+// go to the observation.
+func (e *exchanges) open(messageID uint16, token []byte) (replies, responses <-chan *messages.Message, done chan struct{}) {
+	done = make(chan struct{})
+	reply := &receiver{messages: make(chan *messages.Message, 1), done: done}
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	e.replies[messageID] = reply
+	return reply.messages, e.openResponse(token, done), done
+}
+
+// openToken adds an exchange matched on its token alone, for reliable
+// transports without message IDs.
+func (e *exchanges) openToken(token []byte) (responses <-chan *messages.Message, done chan struct{}) {
+	done = make(chan struct{})
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	return e.openResponse(token, done), done
+}
+
+func (e *exchanges) openResponse(token []byte, done chan struct{}) <-chan *messages.Message {
+	if _, ok := e.observations[string(token)]; ok {
+		return e.responses[string(token)].messages
+	}
+
+	response := &receiver{messages: make(chan *messages.Message, 1), done: done}
+	e.responses[string(token)] = response
+	return response.messages
+}
+
+// close removes an exchange once it is over, unblocking the listener if it
+// is delivering to it.
+func (e *exchanges) close(messageID uint16, token []byte, done chan struct{}) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if reply, ok := e.replies[messageID]; ok && reply.done == done {
+		delete(e.replies, messageID)
+	}
+	e.closeResponse(token, done)
+}
+
+func (e *exchanges) closeToken(token []byte, done chan struct{}) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	e.closeResponse(token, done)
+}
+
+func (e *exchanges) closeResponse(token []byte, done chan struct{}) {
+	close(done)
+
+	// Observations keep receiving notifications for the token
+	if response, ok := e.responses[string(token)]; ok && response.done == done {
+		delete(e.responses, string(token))
+	}
+}
+
+// observe sends every response with the observation's token to it.
+func (e *exchanges) observe(o *Observation) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	e.observations[string(o.token)] = o
+	e.responses[string(o.token)] = &receiver{messages: o.notifications, done: o.done, drop: true}
+}
+
+func (e *exchanges) unobserve(o *Observation) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if e.observations[string(o.token)] == o {
+		delete(e.observations, string(o.token))
+		delete(e.responses, string(o.token))
+	}
+}
+
+// reply finds the exchange waiting for an acknowledgement or reset.
+func (e *exchanges) reply(messageID uint16) (*receiver, bool) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	r, ok := e.replies[messageID]
+	return r, ok
+}
+
+// response finds the exchange or observation waiting for a response.
+func (e *exchanges) response(token []byte) (*receiver, bool) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	r, ok := e.responses[string(token)]
+	return r, ok
+}
+
+// Returns the number of outstanding exchanges and observations.
+func (e *exchanges) len() int {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	return len(e.replies) + len(e.responses)
+}
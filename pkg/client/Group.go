@@ -0,0 +1,212 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	messages "github.com/naspinall/GoAP/pkg/message"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// All CoAP Nodes multicast addresses (RFC 7252 12.8)
+const (
+	AllCoAPNodesIPv4     = "224.0.1.187"
+	AllCoAPNodesLinkIPv6 = "ff02::fd"
+	AllCoAPNodesSiteIPv6 = "ff05::fd"
+)
+
+// ErrNotMulticast is returned for group requests to unicast addresses.
+var ErrNotMulticast = errors.New("Not A Multicast Address")
+
+// GroupResponse is the response of one member of a group.
+type GroupResponse struct {
+	*messages.Message
+	From net.Addr
+}
+
+// Group sends requests to every CoAP node in a multicast group (RFC 7252 8),
+// collecting the responses of each member.
+type Group struct {
+	Addr *net.UDPAddr
+
+	// Interface to send requests on, chosen by the system if nil
+	Interface *net.Interface
+
+	// Set for groups on a packet connection of their own
+	conn net.PacketConn
+	to   net.Addr
+}
+
+// NewGroup creates a group for the multicast address, which may have a
+// zone for link local IPv6 groups such as "ff02::fd%eth0".
+func NewGroup(address string, port int) (*Group, error) {
+	addr, err := net.ResolveUDPAddr("udp", net.JoinHostPort(address, strconv.Itoa(port)))
+	if err != nil {
+		return nil, err
+	}
+
+	if !addr.IP.IsMulticast() {
+		return nil, ErrNotMulticast
+	}
+
+	return &Group{Addr: addr}, nil
+}
+
+// NewPacketGroup sends group requests over conn to addr, which can be any
+// packet connection delivering datagrams to addr to every member, like one
+// of an in-memory network for tests. The caller closes conn.
+func NewPacketGroup(conn net.PacketConn, addr net.Addr) *Group {
+	return &Group{conn: conn, to: addr}
+}
+
+// Get sends a GET to every member of the group, returning the responses
+// that arrive within wait. Members delay their responses by up to their
+// leisure, DefaultLeisure seconds unless configured otherwise.
+func (g *Group) Get(URI string, wait time.Duration) ([]*GroupResponse, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), wait)
+	defer cancel()
+	return g.GetContext(ctx, URI)
+}
+
+// GetContext is Get collecting responses until the context is done.
+func (g *Group) GetContext(ctx context.Context, URI string) ([]*GroupResponse, error) {
+	// Every group request has a socket of its own, so there are no other
+	// exchanges to avoid
+	messageID, token, err := newExchanges().ids()
+	if err != nil {
+		return nil, err
+	}
+
+	m := messages.NewMessage(messages.Get(), messages.WithMessageID(messageID), messages.WithToken(token), messages.WithURI(URI))
+	if m == nil {
+		return nil, errors.New("Bad Request URI")
+	}
+
+	// Zones of link local addresses mean nothing to the members
+	if host := m.Options.URIHost; host != nil {
+		if i := strings.IndexByte(*host, '%'); i >= 0 {
+			zoneless := (*host)[:i]
+			m.Options.URIHost = &zoneless
+		}
+	}
+
+	return g.DoContext(ctx, m)
+}
+
+// Do sends a request to the group as a non-confirmable message, as group
+// requests are never acknowledged. Responses are matched to the request by
+// token until wait has passed.
+func (g *Group) Do(message *messages.Message, wait time.Duration) ([]*GroupResponse, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), wait)
+	defer cancel()
+	return g.DoContext(ctx, message)
+}
+
+// DoContext is Do collecting responses until the context is done, which
+// ends the request without an error.
+func (g *Group) DoContext(ctx context.Context, message *messages.Message) ([]*GroupResponse, error) {
+	message.SetType(messages.NonConfirmable)
+
+	if g.conn != nil {
+		return collect(ctx, g.conn, g.to, message)
+	}
+
+	network := "udp4"
+	if g.Addr.IP.To4() == nil {
+		network = "udp6"
+	}
+
+	conn, err := net.ListenUDP(network, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if err := g.setInterface(conn); err != nil {
+		return nil, err
+	}
+
+	return collect(ctx, conn, g.Addr, message)
+}
+
+// Sends the request to the group at addr, collecting the responses of its
+// members until the context is done.
+func collect(ctx context.Context, conn net.PacketConn, addr net.Addr, message *messages.Message) ([]*GroupResponse, error) {
+	if err := message.Encode(); err != nil {
+		return nil, err
+	}
+	if _, err := conn.WriteTo(message.Bytes(), addr); err != nil {
+		return nil, err
+	}
+
+	// Reads end when the context does, leaving the connection without a
+	// deadline afterwards
+	stop, stopped := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(stopped)
+		select {
+		case <-ctx.Done():
+			conn.SetReadDeadline(time.Now())
+		case <-stop:
+		}
+	}()
+	defer func() {
+		close(stop)
+		<-stopped
+		conn.SetReadDeadline(time.Time{})
+	}()
+
+	var responses []*GroupResponse
+	seen := make(map[string]bool)
+
+	for {
+		b := make([]byte, messages.MaxMessageSize)
+		n, addr, err := conn.ReadFrom(b)
+		if err != nil {
+			if ctx.Err() != nil {
+				return responses, nil
+			}
+			return responses, err
+		}
+
+		m, err := messages.FromBytes(b[:n])
+		if err != nil || !bytes.Equal(m.Token, message.Token) || m.Code == messages.Empty {
+			// Dropping messages that aren't responses to the request
+			continue
+		}
+
+		// Separate responses can be confirmable
+		if m.Type == messages.Confirmable {
+			ack := messages.NewMessage(messages.WithMessageID(m.MessageID), messages.WithType(messages.Acknowledgement))
+			if err := ack.Encode(); err == nil {
+				conn.WriteTo(ack.Bytes(), addr)
+			}
+		}
+
+		// Members may send a response more than once
+		key := addr.String() + "/" + strconv.Itoa(int(m.MessageID))
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		responses = append(responses, &GroupResponse{Message: m, From: addr})
+	}
+}
+
+func (g *Group) setInterface(conn *net.UDPConn) error {
+	if g.Interface == nil {
+		return nil
+	}
+
+	if g.Addr.IP.To4() != nil {
+		return ipv4.NewPacketConn(conn).SetMulticastInterface(g.Interface)
+	}
+	return ipv6.NewPacketConn(conn).SetMulticastInterface(g.Interface)
+}
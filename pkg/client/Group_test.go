@@ -0,0 +1,131 @@
+package client
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/naspinall/GoAP/pkg/memnet"
+	messages "github.com/naspinall/GoAP/pkg/message"
+)
+
+// groupConn stands in for a multicast socket, sending every datagram to
+// each member.
+type groupConn struct {
+	*memnet.Conn
+	members []net.Addr
+}
+
+func (c *groupConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	for _, member := range c.members {
+		if _, err := c.Conn.WriteTo(b, member); err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
+
+// Answers the first request from the group with each of responses, which
+// get its token, returning the next datagram that arrives.
+func groupMember(t *testing.T, conn *memnet.Conn, responses ...*messages.Message) <-chan *messages.Message {
+	next := make(chan *messages.Message, 1)
+	go func() {
+		b := make([]byte, messages.MaxMessageSize)
+		n, addr, err := conn.ReadFrom(b)
+		if err != nil {
+			return
+		}
+		request, err := messages.FromBytes(b[:n])
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		for _, response := range responses {
+			response.Token = request.Token
+			if err := response.Encode(); err != nil {
+				t.Error(err)
+				return
+			}
+			conn.WriteTo(response.Bytes(), addr)
+		}
+
+		n, _, err = conn.ReadFrom(b)
+		if err != nil {
+			return
+		}
+		if m, err := messages.FromBytes(b[:n]); err == nil {
+			next <- m
+		}
+	}()
+	return next
+}
+
+func TestGroup_DoContext(t *testing.T) {
+	network := memnet.NewNetwork(1)
+
+	listen := func(addr string) *memnet.Conn {
+		conn, err := network.Listen(addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return conn
+	}
+	response := func(kind messages.MessageType, messageID uint16, payload string) *messages.Message {
+		m := messages.NewMessage(messages.WithType(kind), messages.WithMessageID(messageID), messages.WithPayload([]byte(payload)))
+		m.Code = messages.Content
+		return m
+	}
+
+	first, second, silent := listen("first"), listen("second"), listen("silent")
+	defer first.Close()
+	defer second.Close()
+	defer silent.Close()
+
+	// The first member sends its response twice, the second confirmably
+	groupMember(t, first, response(messages.NonConfirmable, 1, "first"), response(messages.NonConfirmable, 1, "first"))
+	acks := groupMember(t, second, response(messages.Confirmable, 1, "second"))
+	groupMember(t, silent)
+
+	conn := &groupConn{Conn: listen("requester"), members: []net.Addr{first.LocalAddr(), second.LocalAddr(), silent.LocalAddr()}}
+	defer conn.Close()
+	g := NewPacketGroup(conn, memnet.Addr("group"))
+
+	request := messages.NewMessage(messages.Get(), messages.WithMessageID(7), messages.WithToken([]byte{7}), messages.WithURI("coap://group/hello"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	responses, err := g.DoContext(ctx, request)
+	if err != nil {
+		t.Fatalf("Group.DoContext() error = %v", err)
+	}
+
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond || elapsed > time.Second {
+		t.Errorf("Group.DoContext() returned after %v, want at the deadline", elapsed)
+	}
+
+	got := make(map[string]string)
+	for _, response := range responses {
+		got[response.From.String()] = string(response.Payload)
+	}
+	want := map[string]string{"first": "first", "second": "second"}
+	if len(responses) != len(want) {
+		t.Fatalf("Group.DoContext() got %d responses %v, want %v", len(responses), got, want)
+	}
+	for from, payload := range want {
+		if got[from] != payload {
+			t.Errorf("Group.DoContext() response from %v = %q, want %q", from, got[from], payload)
+		}
+	}
+
+	select {
+	case ack := <-acks:
+		if ack.Type != messages.Acknowledgement || ack.MessageID != 1 {
+			t.Errorf("Group.DoContext() sent %v %v, want acknowledgement of 1", ack.Type, ack.MessageID)
+		}
+	case <-time.After(time.Second):
+		t.Error("Group.DoContext() didn't acknowledge the confirmable response")
+	}
+}
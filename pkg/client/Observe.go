@@ -0,0 +1,241 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	messages "github.com/naspinall/GoAP/pkg/message"
+	"github.com/naspinall/GoAP/pkg/oscore"
+)
+
+const (
+	ObserveSequenceWindow = 1 << 23           // Half of the 24 bit Observe sequence space
+	ObserveFreshness      = 128 * time.Second // Notifications this much newer are always fresh
+)
+
+// Notifications waiting to be checked, and fresh ones waiting for the
+// handler, before older ones are dropped.
+const notificationQueue = 8
+
+// Observation is a registration for notifications of changes to a resource.
+type Observation struct {
+	client  *Client
+	request *messages.Message
+	token   []byte
+	handler func(*messages.Message)
+
+	// Notifications are protected like the response to the registration
+	security *oscore.Context
+	exchange *oscore.Exchange
+
+	notifications chan *messages.Message // Received, not yet checked
+	pending       chan *messages.Message // Fresh, not yet handled
+	done          chan struct{}
+	once          sync.Once
+
+	// Sequence number and arrival time of the newest notification
+	sequence uint
+	received time.Time
+}
+
+// Observe registers interest in the resource at URI. The handler is called
+// with the current representation and then with every fresh notification
+// until the observation is cancelled or the server ends it. Handlers run on
+// a goroutine of their own, one call at a time, so slow ones don't hold up
+// the client; notifications arriving faster than they are handled replace
+// the oldest ones waiting.
+func (c *Client) Observe(URI string, handler func(*messages.Message)) (*Observation, error) {
+	messageID, token, err := c.ids()
+	if err != nil {
+		return nil, err
+	}
+
+	request := messages.NewMessage(messages.Get(), messages.WithMessageID(messageID), messages.WithToken(token), messages.WithURI(URI), messages.WithObserve(messages.ObserveRegister))
+	if request == nil {
+		return nil, errors.New("Bad Request URI")
+	}
+
+	o := &Observation{
+		client:        c,
+		request:       request,
+		token:         token,
+		handler:       handler,
+		notifications: make(chan *messages.Message, notificationQueue),
+		pending:       make(chan *messages.Message, notificationQueue),
+		done:          make(chan struct{}),
+	}
+
+	// Listening for notifications under the registration token, before any
+	// can arrive.
+	c.exchanges.observe(o)
+
+	o.security = c.SecurityContext()
+	m, exchange, err := c.secureExchange(context.Background(), o.security, request)
+	if err != nil {
+		o.stop()
+		return nil, err
+	}
+	o.exchange = exchange
+
+	// Server doesn't support observing the resource
+	if m.Options.Observe == nil {
+		o.stop()
+		o.deliver(m)
+		return o, nil
+	}
+
+	o.sequence, o.received = *m.Options.Observe, time.Now()
+	go o.listen()
+
+	o.deliver(m)
+	go o.handle()
+
+	return o, nil
+}
+
+// Done is closed once the observation has ended.
+func (o *Observation) Done() <-chan struct{} {
+	return o.done
+}
+
+// Cancel deregisters the observation with a GET carrying Observe 1. Any
+// notification arriving afterwards is rejected with a Reset.
+func (o *Observation) Cancel() error {
+	select {
+	case <-o.done:
+		return nil
+	default:
+	}
+
+	o.stop()
+
+	messageID := o.client.exchanges.messageID()
+
+	// Deregistering with the same token as the registration
+	options := *o.request.Options
+	deregister := messages.ObserveDeregister
+	options.Observe = &deregister
+
+	request := messages.NewMessage(messages.Get(), messages.WithMessageID(messageID), messages.WithToken(o.token))
+	request.Options = &options
+
+	_, err := o.client.exchange(context.Background(), request)
+	return err
+}
+
+func (o *Observation) stop() {
+	o.once.Do(func() {
+		o.client.exchanges.unobserve(o)
+		close(o.done)
+	})
+}
+
+func (o *Observation) listen() {
+	for {
+		select {
+		case m := <-o.notifications:
+
+			if o.exchange != nil {
+				var err error
+				if m, err = unprotect(o.security, m, o.exchange); err != nil {
+					// Dropping notifications that aren't authentic
+					continue
+				}
+			}
+
+			// Notifications with critical options we don't recognize were
+			// rejected by the listener
+			if len(m.Options.BadOptions()) > 0 {
+				continue
+			}
+
+			// Notifications without the Observe option end the observation
+			if m.Options.Observe == nil {
+				o.queue(m)
+				return
+			}
+
+			if !o.fresh(*m.Options.Observe, time.Now()) {
+				continue
+			}
+
+			o.queue(m)
+
+		case <-o.done:
+			return
+		}
+	}
+}
+
+// Queues a fresh notification for the handler, dropping the oldest waiting
+// one, which it supersedes, if the handler is behind.
+func (o *Observation) queue(m *messages.Message) {
+	for {
+		select {
+		case o.pending <- m:
+			return
+		default:
+		}
+
+		select {
+		case <-o.pending:
+		default:
+		}
+	}
+}
+
+// Calls the handler with queued notifications, ending the observation after
+// the one without the Observe option.
+func (o *Observation) handle() {
+	for {
+		select {
+		case m := <-o.pending:
+			final := m.Options.Observe == nil
+			o.deliver(m)
+			if final {
+				o.stop()
+				return
+			}
+
+		case <-o.done:
+			return
+		}
+	}
+}
+
+// Checks a notification is newer than the last one delivered (RFC 7641 3.4).
+func (o *Observation) fresh(sequence uint, received time.Time) bool {
+	v1, v2 := o.sequence, sequence
+
+	if (v1 < v2 && v2-v1 < ObserveSequenceWindow) ||
+		(v1 > v2 && v1-v2 > ObserveSequenceWindow) ||
+		received.After(o.received.Add(ObserveFreshness)) {
+		o.sequence, o.received = sequence, received
+		return true
+	}
+
+	return false
+}
+
+func (o *Observation) deliver(m *messages.Message) {
+	// Fetching the rest of notifications split into blocks
+	if m.Options.Block2 != nil && m.Options.Block2.More {
+		options := *o.request.Options
+		options.Observe = nil
+
+		request := messages.NewMessage(messages.Get())
+		request.Options = &options
+
+		full, err := o.client.download(context.Background(), request, m)
+		if err != nil {
+			return
+		}
+		m = full
+	}
+
+	if o.handler != nil {
+		o.handler(m)
+	}
+}
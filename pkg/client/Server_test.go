@@ -0,0 +1,49 @@
+package client
+
+import (
+	"net"
+	"testing"
+
+	messages "github.com/naspinall/GoAP/pkg/message"
+)
+
+// testServer is a UDP server on the loopback interface for client tests. It
+// passes every request it can decode to handle, which sends messages back
+// to the request's sender with reply, from any goroutine.
+func testServer(t *testing.T, handle func(request *messages.Message, reply func(*messages.Message))) *net.UDPConn {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		for {
+			b := make([]byte, messages.MaxMessageSize)
+			n, raddr, err := conn.ReadFrom(b)
+			if err != nil {
+				return
+			}
+
+			request, err := messages.FromBytes(b[:n])
+			if err != nil {
+				continue
+			}
+
+			handle(request, func(m *messages.Message) {
+				if err := m.Encode(); err == nil {
+					conn.WriteTo(m.Bytes(), raddr)
+				}
+			})
+		}
+	}()
+
+	return conn
+}
+
+// Creates a response piggybacked on the acknowledgement of request.
+func piggyback(request *messages.Message, code uint8, cfgs ...messages.MessagesConfig) *messages.Message {
+	cfgs = append([]messages.MessagesConfig{messages.WithType(messages.Acknowledgement), messages.WithMessageID(request.MessageID), messages.WithToken(request.Token)}, cfgs...)
+	response := messages.NewMessage(cfgs...)
+	response.Code = code
+	return response
+}
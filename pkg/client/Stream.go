@@ -0,0 +1,111 @@
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"strconv"
+
+	messages "github.com/naspinall/GoAP/pkg/message"
+	"github.com/naspinall/GoAP/pkg/stream"
+)
+
+// ErrClosed is returned for exchanges on a closed client.
+var ErrClosed = errors.New("Client Closed")
+
+// NewTCPClient connects to a server with CoAP over TCP (RFC 8323).
+func NewTCPClient(address string, port int) (*Client, error) {
+	conn, err := stream.DialTCP(net.JoinHostPort(address, strconv.Itoa(port)))
+	if err != nil {
+		return nil, err
+	}
+	return NewStreamClient(conn)
+}
+
+// NewTLSClient connects to a server with CoAP over TLS (RFC 8323).
+func NewTLSClient(address string, port int, config *tls.Config) (*Client, error) {
+	conn, err := stream.DialTLS(net.JoinHostPort(address, strconv.Itoa(port)), config)
+	if err != nil {
+		return nil, err
+	}
+	return NewStreamClient(conn)
+}
+
+// NewWebSocketClient connects to a server with CoAP over WebSockets (RFC 8323
+// 4), given a coap+ws or coaps+ws URI of its endpoint. The config is used for
+// coaps+ws.
+func NewWebSocketClient(URI string, config *tls.Config) (*Client, error) {
+	conn, err := stream.DialWebSocket(URI, config)
+	if err != nil {
+		return nil, err
+	}
+	return NewStreamClient(conn)
+}
+
+// NewStreamClient uses an established reliable connection, starting the
+// session with a Capabilities and Settings Message.
+func NewStreamClient(conn stream.Conn) (*Client, error) {
+	session, err := stream.NewSession(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	c := &Client{
+		session:   session,
+		exchanges: newExchanges(),
+		blockSZX:  messages.MaxBlockSZX,
+		params:    messages.DefaultTransmissionParams,
+		done:      make(chan struct{}),
+	}
+
+	// Listener for responses
+	go c.listenStream()
+
+	return c, nil
+}
+
+// Ping checks the server is still there, waiting for its Pong until the
+// exchange lifetime.
+func (c *Client) Ping() error {
+	if c.session == nil {
+		return errors.New("Ping Requires A Reliable Transport")
+	}
+	return c.session.Ping(c.TransmissionParams().ExchangeLifetime())
+}
+
+func (c *Client) listenStream() {
+	for {
+		m, err := c.session.ReadMessage()
+		if err != nil {
+			// Connection gone, ending every exchange
+			c.once.Do(func() {
+				close(c.done)
+				c.session.Close()
+			})
+			return
+		}
+
+		// Responses are matched on token alone
+		if r, ok := c.exchanges.response(m.Token); ok {
+			r.deliver(m)
+		}
+	}
+}
+
+func (c *Client) exchangeStream(ctx context.Context, message *messages.Message) (*messages.Message, error) {
+	// Peers only take tokens as long as their CSM said
+	if uint(len(message.Token)) > c.session.PeerMaxTokenLength() {
+		return nil, messages.ErrTokenTooLong
+	}
+
+	responses, done := c.exchanges.openToken(message.Token)
+	defer c.exchanges.closeToken(message.Token, done)
+
+	if err := c.session.WriteMessage(message); err != nil {
+		return nil, err
+	}
+
+	return c.waitForResponse(ctx, nil, responses)
+}
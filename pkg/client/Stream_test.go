@@ -0,0 +1,47 @@
+package client
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	messages "github.com/naspinall/GoAP/pkg/message"
+	"github.com/naspinall/GoAP/pkg/stream"
+)
+
+func TestClient_StreamResponseTimeout(t *testing.T) {
+	// Reading requests without ever responding
+	local, remote := net.Pipe()
+	go func() {
+		server := stream.NewTCPConn(remote)
+		for {
+			if _, err := server.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+	defer remote.Close()
+
+	c, err := NewStreamClient(stream.NewTCPConn(local))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	params := messages.DefaultTransmissionParams
+	params.AckTimeout, params.MaxLatency, params.ProcessingDelay = 10*time.Millisecond, 20*time.Millisecond, 10*time.Millisecond
+	if err := c.SetTransmissionParams(params); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	if _, err := c.Get("coap+tcp://127.0.0.1/slow"); err != ErrTimeout {
+		t.Errorf("Client.Get() error = %v, want %v", err, ErrTimeout)
+	}
+	if elapsed := time.Since(start); elapsed < params.ExchangeLifetime() || elapsed > time.Second {
+		t.Errorf("Client.Get() gave up after %v, want about %v", elapsed, params.ExchangeLifetime())
+	}
+	if n := c.exchanges.len(); n != 0 {
+		t.Errorf("Client exchanges = %d, want none left", n)
+	}
+}
@@ -0,0 +1,39 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+
+	messages "github.com/naspinall/GoAP/pkg/message"
+)
+
+// SupportsTokenLength checks if the server takes tokens of length bytes,
+// longer than messages.MaxTokenLength with the extended token length of RFC
+// 8974. It sends a GET of the root resource with such a token: servers that
+// can't parse it reject it with a reset, and servers that can respond with
+// the same token, whatever the response code.
+func (c *Client) SupportsTokenLength(ctx context.Context, length int) (bool, error) {
+	if length > messages.MaxExtendedTokenLength {
+		return false, messages.ErrTokenTooLong
+	}
+	if c.session != nil {
+		return uint(length) <= c.session.PeerMaxTokenLength(), nil
+	}
+
+	token := make([]byte, length)
+	if _, err := rand.Read(token); err != nil {
+		return false, err
+	}
+
+	m := messages.NewMessage(messages.Get(), messages.WithMessageID(c.exchanges.messageID()), messages.WithToken(token))
+	response, err := c.transmit(ctx, m)
+	if errors.Is(err, ErrReset) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(response.Token, token), nil
+}
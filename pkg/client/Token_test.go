@@ -0,0 +1,53 @@
+package client
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	messages "github.com/naspinall/GoAP/pkg/message"
+)
+
+func TestClient_SupportsTokenLength(t *testing.T) {
+	tests := []struct {
+		name           string
+		maxTokenLength int
+		length         int
+		want           bool
+		wantErr        error
+	}{
+		{name: "Short", maxTokenLength: messages.MaxExtendedTokenLength, length: messages.MaxTokenLength, want: true},
+		{name: "Extended", maxTokenLength: messages.MaxExtendedTokenLength, length: 300, want: true},
+		{name: "Turned Off", maxTokenLength: messages.MaxTokenLength, length: 9},
+		{name: "Limited", maxTokenLength: 16, length: 17},
+		{name: "Too Long", maxTokenLength: messages.MaxExtendedTokenLength, length: messages.MaxExtendedTokenLength + 1, wantErr: messages.ErrTokenTooLong},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Rejecting longer tokens with a reset, like servers that can't
+			// parse them
+			conn := testServer(t, func(request *messages.Message, reply func(*messages.Message)) {
+				if len(request.Token) > tt.maxTokenLength {
+					reply(messages.NewMessage(messages.WithType(messages.Reset), messages.WithMessageID(request.MessageID)))
+					return
+				}
+				reply(piggyback(request, messages.NotFound))
+			})
+			defer conn.Close()
+
+			c, err := NewClient("127.0.0.1", conn.LocalAddr().(*net.UDPAddr).Port)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer c.Close()
+
+			got, err := c.SupportsTokenLength(context.Background(), tt.length)
+			if err != tt.wantErr {
+				t.Fatalf("Client.SupportsTokenLength() error = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Client.SupportsTokenLength() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package client
+
+import (
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	messages "github.com/naspinall/GoAP/pkg/message"
+)
+
+func TestClient_SetTransmissionParams(t *testing.T) {
+	// Counting transmissions of requests that never get an answer
+	var transmissions int32
+	conn := testServer(t, func(request *messages.Message, reply func(*messages.Message)) {
+		atomic.AddInt32(&transmissions, 1)
+	})
+	defer conn.Close()
+
+	c, err := NewClient("127.0.0.1", conn.LocalAddr().(*net.UDPAddr).Port)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if err := c.SetTransmissionParams(messages.TransmissionParams{}); err != messages.ErrBadTransmissionParams {
+		t.Errorf("Client.SetTransmissionParams() error = %v, want %v", err, messages.ErrBadTransmissionParams)
+	}
+
+	params := messages.DefaultTransmissionParams
+	params.AckTimeout, params.MaxRetransmit = 10*time.Millisecond, 2
+	if err := c.SetTransmissionParams(params); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	if _, err := c.Get("coap://127.0.0.1/lost"); err == nil {
+		t.Fatal("Client.Get() error = nil, want timeout")
+	}
+
+	if elapsed := time.Since(start); elapsed < params.MaxTransmitSpan() || elapsed > time.Second {
+		t.Errorf("Client.Get() gave up after %v, want about %v", elapsed, params.MaxTransmitWait())
+	}
+	if got := atomic.LoadInt32(&transmissions); got != int32(params.MaxRetransmit+1) {
+		t.Errorf("Client.Get() sent %d times, want %d", got, params.MaxRetransmit+1)
+	}
+}
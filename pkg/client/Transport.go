@@ -0,0 +1,40 @@
+package client
+
+import (
+	"net"
+)
+
+// NewPacketClient exchanges datagrams with the server at addr over conn,
+// which can be any packet connection, like a socket of an in-memory network
+// for tests. Datagrams from anywhere else are ignored. Closing the client
+// closes conn.
+func NewPacketClient(conn net.PacketConn, addr net.Addr) *Client {
+	return newClient(&peerConn{PacketConn: conn, peer: addr})
+}
+
+// peerConn lets a packet connection be used like a connected socket, with
+// every datagram to and from a single peer.
+type peerConn struct {
+	net.PacketConn
+	peer net.Addr
+}
+
+func (c *peerConn) Read(b []byte) (int, error) {
+	for {
+		n, addr, err := c.ReadFrom(b)
+		if err != nil {
+			return n, err
+		}
+		if addr.String() == c.peer.String() {
+			return n, nil
+		}
+	}
+}
+
+func (c *peerConn) Write(b []byte) (int, error) {
+	return c.WriteTo(b, c.peer)
+}
+
+func (c *peerConn) RemoteAddr() net.Addr {
+	return c.peer
+}
@@ -1,67 +1,94 @@
 package client
 
 import (
-	"log"
+	"context"
+	"errors"
+	"net/url"
 
 	messages "github.com/naspinall/GoAP/pkg/message"
 )
 
-func (c *Client) Get(URI string) (*messages.Message, error) {
-	messageID, token, err := c.randomIDs()
-	if err != nil {
-		return nil, err
-	}
+// ErrNoLocation is returned for responses without a Location-Path or
+// Location-Query option.
+var ErrNoLocation = errors.New("Response Has No Location")
 
-	m := messages.NewMessage(messages.Get(), messages.WithMessageID(messageID), messages.WithToken(token), messages.WithURI(URI))
-	m, err = c.Do(m)
-	if err != nil {
-		log.Fatal(err)
-	}
+// Get fetches the resource at URI. Options change the request, like
+// messages.WithObserve.
+func (c *Client) Get(URI string, options ...messages.MessagesConfig) (*messages.Message, error) {
+	return c.GetContext(context.Background(), URI, options...)
+}
 
-	return m, nil
+// GetContext is Get with a context for cancelling the exchange.
+func (c *Client) GetContext(ctx context.Context, URI string, options ...messages.MessagesConfig) (*messages.Message, error) {
+	return c.request(ctx, messages.Get(), URI, options)
 }
 
-func (c *Client) Post(URI string) (*messages.Message, error) {
-	messageID, token, err := c.randomIDs()
-	if err != nil {
-		return nil, err
-	}
+// Post sends a payload to the resource at URI for processing. The payload
+// is set with messages.WithPayload or messages.WithBody, and its format with
+// messages.WithContentFormat.
+func (c *Client) Post(URI string, options ...messages.MessagesConfig) (*messages.Message, error) {
+	return c.PostContext(context.Background(), URI, options...)
+}
 
-	m := messages.NewMessage(messages.Get(), messages.WithMessageID(messageID), messages.WithToken(token), messages.WithURI(URI))
-	m, err = c.Do(m)
-	if err != nil {
-		log.Fatal(err)
-	}
+// PostContext is Post with a context for cancelling the exchange.
+func (c *Client) PostContext(ctx context.Context, URI string, options ...messages.MessagesConfig) (*messages.Message, error) {
+	return c.request(ctx, messages.Post(), URI, options)
+}
 
-	return m, nil
+// Put creates or replaces the resource at URI with the payload, set like
+// the payload of Post.
+func (c *Client) Put(URI string, options ...messages.MessagesConfig) (*messages.Message, error) {
+	return c.PutContext(context.Background(), URI, options...)
 }
 
-func (c *Client) Put(URI string) (*messages.Message, error) {
-	messageID, token, err := c.randomIDs()
+// PutContext is Put with a context for cancelling the exchange.
+func (c *Client) PutContext(ctx context.Context, URI string, options ...messages.MessagesConfig) (*messages.Message, error) {
+	return c.request(ctx, messages.Put(), URI, options)
+}
+
+// Delete deletes the resource at URI.
+func (c *Client) Delete(URI string, options ...messages.MessagesConfig) (*messages.Message, error) {
+	return c.DeleteContext(context.Background(), URI, options...)
+}
+
+// DeleteContext is Delete with a context for cancelling the exchange.
+func (c *Client) DeleteContext(ctx context.Context, URI string, options ...messages.MessagesConfig) (*messages.Message, error) {
+	return c.request(ctx, messages.Delete(), URI, options)
+}
+
+// Sends a request with the method to URI, returning the first error of the
+// options if there is one.
+func (c *Client) request(ctx context.Context, method messages.MessagesConfig, URI string, options []messages.MessagesConfig) (*messages.Message, error) {
+	messageID, token, err := c.ids()
 	if err != nil {
 		return nil, err
 	}
 
-	m := messages.NewMessage(messages.Get(), messages.WithMessageID(messageID), messages.WithToken(token), messages.WithURI(URI))
-	m, err = c.Do(m)
-	if err != nil {
-		log.Fatal(err)
+	m := messages.NewMessage(method, messages.WithMessageID(messageID), messages.WithToken(token))
+	if err := m.Options.SetURI(URI); err != nil {
+		return nil, err
+	}
+	for _, option := range options {
+		if err := option(m); err != nil {
+			return nil, err
+		}
 	}
 
-	return m, nil
+	return c.DoContext(ctx, m)
 }
 
-func (c *Client) Delete(URI string) (*messages.Message, error) {
-	messageID, token, err := c.randomIDs()
-	if err != nil {
-		return nil, err
+// Location resolves the Location-Path and Location-Query options of a 2.01
+// Created response against the URI of its request, giving the URI of the
+// created resource.
+func Location(URI string, response *messages.Message) (*url.URL, error) {
+	location := response.Options.Location()
+	if location == nil {
+		return nil, ErrNoLocation
 	}
 
-	m := messages.NewMessage(messages.Get(), messages.WithMessageID(messageID), messages.WithToken(token), messages.WithURI(URI))
-	m, err = c.Do(m)
+	base, err := url.Parse(URI)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
-
-	return m, nil
+	return base.ResolveReference(location), nil
 }
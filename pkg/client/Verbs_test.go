@@ -0,0 +1,129 @@
+package client
+
+import (
+	"bytes"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+
+	messages "github.com/naspinall/GoAP/pkg/message"
+)
+
+// Replies to every request with a copy of it, created at /things/1 for
+// POST requests.
+func echoServer(t *testing.T) *net.UDPConn {
+	return testServer(t, func(request *messages.Message, reply func(*messages.Message)) {
+		// Method goes back in the payload, everything else as it was
+		response := piggyback(request, messages.Content, messages.WithPayload(append([]byte{request.Code}, request.Payload...)))
+		response.Options.ContentFormat = request.Options.ContentFormat
+		if request.Code == messages.POST {
+			response.Code = messages.Created
+			response.Options.LocationPath = []string{"things", "1"}
+			response.Options.LocationQuery = []string{"new"}
+		}
+		reply(response)
+	})
+}
+
+func TestClient_Verbs(t *testing.T) {
+	conn := echoServer(t)
+	defer conn.Close()
+
+	c, err := NewClient("127.0.0.1", conn.LocalAddr().(*net.UDPAddr).Port)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	uri := "coap://127.0.0.1/things"
+	contentFormat := func(format uint) *uint { return &format }
+
+	tests := []struct {
+		name              string
+		do                func() (*messages.Message, error)
+		wantMethod        uint8
+		wantContentFormat *uint
+		wantPayload       string
+	}{
+		{
+			name:       "Get",
+			do:         func() (*messages.Message, error) { return c.Get(uri) },
+			wantMethod: messages.GET,
+		},
+		{
+			name: "Post Bytes",
+			do: func() (*messages.Message, error) {
+				return c.Post(uri, messages.WithContentFormat(messages.JSON), messages.WithPayload([]byte(`{"a":1}`)))
+			},
+			wantMethod:        messages.POST,
+			wantContentFormat: contentFormat(messages.JSON),
+			wantPayload:       `{"a":1}`,
+		},
+		{
+			name: "Put Reader",
+			do: func() (*messages.Message, error) {
+				return c.Put(uri, messages.WithContentFormat(messages.TextPlain), messages.WithBody(strings.NewReader("hello")))
+			},
+			wantMethod:        messages.PUT,
+			wantContentFormat: contentFormat(messages.TextPlain),
+			wantPayload:       "hello",
+		},
+		{
+			name:       "Delete",
+			do:         func() (*messages.Message, error) { return c.Delete(uri) },
+			wantMethod: messages.DELETE,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := tt.do()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(m.Payload) == 0 || m.Payload[0] != tt.wantMethod {
+				t.Fatalf("request method = %v, want %v", m.Payload, tt.wantMethod)
+			}
+			if got := string(m.Payload[1:]); got != tt.wantPayload {
+				t.Errorf("request payload = %q, want %q", got, tt.wantPayload)
+			}
+			if !reflect.DeepEqual(m.Options.ContentFormat, tt.wantContentFormat) {
+				t.Errorf("request content format = %v, want %v", m.Options.ContentFormat, tt.wantContentFormat)
+			}
+		})
+	}
+
+	t.Run("Location", func(t *testing.T) {
+		m, err := c.Post(uri, messages.WithPayload([]byte("thing")))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		location, err := Location(uri, m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := location.String(), "coap://127.0.0.1/things/1?new"; got != want {
+			t.Errorf("Location() = %v, want %v", got, want)
+		}
+
+		if _, err := Location(uri, messages.NewMessage()); err != ErrNoLocation {
+			t.Errorf("Location() error = %v, want %v", err, ErrNoLocation)
+		}
+	})
+
+	t.Run("Bad Option", func(t *testing.T) {
+		if _, err := c.Put(uri, messages.WithBody(failingReader{})); err != errRead {
+			t.Errorf("Client.Put() error = %v, want %v", err, errRead)
+		}
+	})
+}
+
+var errRead = bytes.ErrTooLarge
+
+type failingReader struct{}
+
+func (failingReader) Read([]byte) (int, error) {
+	return 0, errRead
+}
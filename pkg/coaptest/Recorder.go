@@ -0,0 +1,49 @@
+package coaptest
+
+import (
+	"bytes"
+
+	messages "github.com/naspinall/GoAP/pkg/message"
+)
+
+// ResponseRecorder is a server.ResponseWriter recording what a handler
+// responds with, for inspection in tests.
+type ResponseRecorder struct {
+	Code uint8         // 2.05 Content unless the handler writes another
+	Body *bytes.Buffer // Payload written by the handler
+
+	options *messages.Options
+}
+
+// NewRecorder returns a recorder of a 2.05 Content response without options.
+func NewRecorder() *ResponseRecorder {
+	return &ResponseRecorder{
+		Code:    messages.Content,
+		Body:    new(bytes.Buffer),
+		options: &messages.Options{},
+	}
+}
+
+// Options of the response.
+func (rw *ResponseRecorder) Options() *messages.Options {
+	return rw.options
+}
+
+// WriteCode sets the response code.
+func (rw *ResponseRecorder) WriteCode(code uint8) {
+	rw.Code = code
+}
+
+// Write appends to the payload.
+func (rw *ResponseRecorder) Write(b []byte) (int, error) {
+	return rw.Body.Write(b)
+}
+
+// Result returns the response the handler wrote, as a server would send it
+// for a non-confirmable request.
+func (rw *ResponseRecorder) Result() *messages.Message {
+	m := messages.NewMessage(messages.WithType(messages.NonConfirmable), messages.WithPayload(rw.Body.Bytes()))
+	m.Code = rw.Code
+	m.Options = rw.options
+	return m
+}
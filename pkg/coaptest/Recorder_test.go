@@ -0,0 +1,102 @@
+package coaptest
+
+import (
+	"reflect"
+	"testing"
+
+	messages "github.com/naspinall/GoAP/pkg/message"
+	"github.com/naspinall/GoAP/pkg/server"
+)
+
+func TestResponseRecorder(t *testing.T) {
+	mux := server.NewServeMux()
+	mux.HandleMethod(messages.POST, "/things", server.HandlerFunc(func(w server.ResponseWriter, r *server.Request) {
+		w.WriteCode(messages.Created)
+		w.Options().LocationPath = []string{"things", r.Options.URIQuery[0]}
+		w.Write(r.Payload)
+	}))
+	mux.Handle("/temperature", server.NewResource([]byte("20"), messages.TextPlain))
+	contentFormat := func(format uint) *uint { return &format }
+
+	tests := []struct {
+		name              string
+		request           *server.Request
+		wantCode          uint8
+		wantPayload       string
+		wantLocation      string
+		wantContentFormat *uint
+	}{
+		{
+			name:         "Created",
+			request:      NewRequest(messages.POST, "coap://example.com/things?1", messages.WithPayload([]byte("thing"))),
+			wantCode:     messages.Created,
+			wantPayload:  "thing",
+			wantLocation: "/things/1",
+		},
+		{
+			name:     "Not Found",
+			request:  NewRequest(messages.GET, "/nothing"),
+			wantCode: messages.NotFound,
+		},
+		{
+			name:              "Observe Without A Server",
+			request:           NewRequest(messages.GET, "/temperature", messages.WithObserve(messages.ObserveRegister)),
+			wantCode:          messages.Content,
+			wantPayload:       "20",
+			wantContentFormat: contentFormat(messages.TextPlain),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rw := NewRecorder()
+			mux.ServeCOAP(rw, tt.request)
+
+			if rw.Code != tt.wantCode {
+				t.Errorf("ResponseRecorder.Code = %v, want %v", rw.Code, tt.wantCode)
+			}
+			if rw.Body.String() != tt.wantPayload {
+				t.Errorf("ResponseRecorder.Body = %q, want %q", rw.Body.String(), tt.wantPayload)
+			}
+
+			m := rw.Result()
+			if m.Code != tt.wantCode || string(m.Payload) != tt.wantPayload {
+				t.Errorf("ResponseRecorder.Result() = %v %q, want %v %q", m.Code, m.Payload, tt.wantCode, tt.wantPayload)
+			}
+			if !reflect.DeepEqual(m.Options.ContentFormat, tt.wantContentFormat) {
+				t.Errorf("ResponseRecorder.Result() content format = %v, want %v", m.Options.ContentFormat, tt.wantContentFormat)
+			}
+			if m.Options.MaxAge != nil {
+				t.Errorf("ResponseRecorder.Result() Max-Age = %v, want none", *m.Options.MaxAge)
+			}
+			if tt.wantLocation != "" {
+				if location := m.Options.Location(); location == nil || location.String() != tt.wantLocation {
+					t.Errorf("ResponseRecorder.Result() location = %v, want %v", location, tt.wantLocation)
+				}
+			}
+		})
+	}
+}
+
+func TestNewRequest(t *testing.T) {
+	r := NewRequest(messages.PUT, "coap://example.com/a/b?c=d", messages.WithPayload([]byte("e")))
+
+	if r.Code != messages.PUT || r.Type != messages.Confirmable {
+		t.Errorf("NewRequest() = %v %v, want %v %v", r.Code, r.Type, messages.PUT, messages.Confirmable)
+	}
+	if r.Path() != "a/b" || len(r.Options.URIQuery) != 1 || r.Options.URIQuery[0] != "c=d" {
+		t.Errorf("NewRequest() path = %q query = %q, want %q %q", r.Path(), r.Options.URIQuery, "a/b", "c=d")
+	}
+	if string(r.Payload) != "e" {
+		t.Errorf("NewRequest() payload = %q, want %q", r.Payload, "e")
+	}
+	if r.RemoteAddr.String() != DefaultRemoteAddr {
+		t.Errorf("NewRequest() remote address = %v, want %v", r.RemoteAddr, DefaultRemoteAddr)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("NewRequest() didn't panic on a bad target")
+		}
+	}()
+	NewRequest(messages.GET, "%zz")
+}
@@ -0,0 +1,53 @@
+package coaptest
+
+import (
+	"fmt"
+	"math/rand"
+	"net"
+
+	messages "github.com/naspinall/GoAP/pkg/message"
+	"github.com/naspinall/GoAP/pkg/server"
+)
+
+// DefaultRemoteAddr is the address requests from NewRequest come from, in
+// the documentation range of RFC 5737.
+const DefaultRemoteAddr = "192.0.2.1:5683"
+
+// NewRequest returns a confirmable request with the method to target, for
+// passing straight to a handler. Options change the request like they do
+// for client requests, such as messages.WithPayload. NewRequest panics on a
+// bad target or option, as it's meant for tests.
+func NewRequest(method uint8, target string, options ...messages.MessagesConfig) *server.Request {
+	m := NewMessage(method, target, options...)
+
+	addr, err := net.ResolveUDPAddr("udp", DefaultRemoteAddr)
+	if err != nil {
+		panic(fmt.Sprintf("coaptest: bad remote address: %v", err))
+	}
+
+	return &server.Request{Message: m, RemoteAddr: addr}
+}
+
+// NewMessage returns a confirmable request message with the method to
+// target, for sending with a client or encoding. It panics like NewRequest.
+func NewMessage(method uint8, target string, options ...messages.MessagesConfig) *messages.Message {
+	token := make([]byte, 8)
+	rand.Read(token)
+
+	m := messages.NewMessage(
+		messages.WithType(messages.Confirmable),
+		messages.WithMessageID(uint16(rand.Uint32())),
+		messages.WithToken(token),
+	)
+	m.Code = method
+
+	if err := m.Options.SetURI(target); err != nil {
+		panic(fmt.Sprintf("coaptest: bad target %q: %v", target, err))
+	}
+	for _, option := range options {
+		if err := option(m); err != nil {
+			panic(fmt.Sprintf("coaptest: bad option: %v", err))
+		}
+	}
+	return m
+}
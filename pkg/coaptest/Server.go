@@ -0,0 +1,97 @@
+// Package coaptest provides utilities for testing CoAP handlers and clients,
+// like net/http/httptest.
+package coaptest
+
+import (
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/naspinall/GoAP/pkg/client"
+	"github.com/naspinall/GoAP/pkg/server"
+)
+
+// Server is a CoAP server listening on a loopback UDP port, for end-to-end
+// tests.
+type Server struct {
+	URL      string         // Base URL of the server, like coap://127.0.0.1:5683
+	Listener net.PacketConn // Connection the server reads requests from
+
+	// Config may be changed after NewUnstartedServer and before Start.
+	Config *server.Server
+
+	mutex  sync.Mutex
+	client *client.Client
+	closed bool
+}
+
+// NewServer starts a server serving requests with handler. The caller should
+// call Close when finished.
+func NewServer(handler server.Handler) *Server {
+	s := NewUnstartedServer(handler)
+	s.Start()
+	return s
+}
+
+// NewUnstartedServer returns a server that isn't serving yet, so its config
+// can be changed. The caller should call Start, and Close when finished.
+func NewUnstartedServer(handler server.Handler) *Server {
+	return &Server{
+		Listener: newLocalListener(),
+		Config:   &server.Server{Handler: handler},
+	}
+}
+
+// Start serves requests from the listener.
+func (s *Server) Start() {
+	if s.URL != "" {
+		panic("coaptest: Server already started")
+	}
+	s.URL = "coap://" + s.Listener.LocalAddr().String()
+
+	go s.Config.Serve(s.Listener)
+}
+
+// Client returns a client sending requests to the server, closed with the
+// server.
+func (s *Server) Client() *client.Client {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.client == nil {
+		addr := s.Listener.LocalAddr().(*net.UDPAddr)
+		c, err := client.NewClient(addr.IP.String(), addr.Port)
+		if err != nil {
+			panic(fmt.Sprintf("coaptest: failed to create client: %v", err))
+		}
+		s.client = c
+	}
+	return s.client
+}
+
+// Close stops the server and closes its client.
+func (s *Server) Close() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.closed {
+		return
+	}
+	s.closed = true
+
+	s.Config.Close()
+	s.Listener.Close()
+	if s.client != nil {
+		s.client.Close()
+	}
+}
+
+func newLocalListener() net.PacketConn {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		if conn, err = net.ListenPacket("udp6", "[::1]:0"); err != nil {
+			panic(fmt.Sprintf("coaptest: failed to listen on a port: %v", err))
+		}
+	}
+	return conn
+}
@@ -0,0 +1,53 @@
+package coaptest
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	messages "github.com/naspinall/GoAP/pkg/message"
+	"github.com/naspinall/GoAP/pkg/server"
+)
+
+func TestServer(t *testing.T) {
+	ts := NewServer(server.HandlerFunc(func(w server.ResponseWriter, r *server.Request) {
+		w.Write([]byte("hello " + r.Path()))
+	}))
+	defer ts.Close()
+
+	if !strings.HasPrefix(ts.URL, "coap://127.0.0.1:") {
+		t.Errorf("Server.URL = %q, want a loopback coap URL", ts.URL)
+	}
+
+	m, err := ts.Client().Get(ts.URL + "/world")
+	if err != nil {
+		t.Fatalf("Client.Get() error = %v", err)
+	}
+	if m.Code != messages.Content || string(m.Payload) != "hello world" {
+		t.Errorf("Client.Get() = %v %q, want %v %q", m.Code, m.Payload, messages.Content, "hello world")
+	}
+}
+
+func TestNewUnstartedServer(t *testing.T) {
+	ts := NewUnstartedServer(server.HandlerFunc(func(w server.ResponseWriter, r *server.Request) {}))
+	ts.Config.TransmissionParams = messages.DefaultTransmissionParams
+	ts.Config.TransmissionParams.MaxRetransmit = 1
+	ts.Start()
+	defer ts.Close()
+
+	params := messages.DefaultTransmissionParams
+	params.AckTimeout = 100 * time.Millisecond
+	if err := ts.Client().SetTransmissionParams(params); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ts.Client().Get(ts.URL + "/"); err != nil {
+		t.Fatalf("Client.Get() error = %v", err)
+	}
+
+	// Requests fail once closed
+	ts.Close()
+	if _, err := ts.Client().Get(ts.URL + "/"); err == nil {
+		t.Error("Client.Get() error = nil after Server.Close()")
+	}
+}
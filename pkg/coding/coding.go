@@ -31,21 +31,22 @@ func EncodeUint(value uint) (b []byte) {
 		}
 	}
 
-	return
+	// Zero is encoded as an empty value
+	return b[:0]
 }
 
 func DecodeUint16(input []byte) (value uint16) {
-	input = ZeroPad(input, 2)
+	input = LeftPad(input, 2)
 	return binary.BigEndian.Uint16(input)
 }
 
 func DecodeUint32(input []byte) (value uint32) {
-	input = ZeroPad(input, 4)
+	input = LeftPad(input, 4)
 	return binary.BigEndian.Uint32(input)
 }
 
 func DecodeUint64(input []byte) (value uint64) {
-	input = ZeroPad(input, 8)
+	input = LeftPad(input, 8)
 	return binary.BigEndian.Uint64(input)
 }
 
@@ -63,3 +64,14 @@ func ZeroPad(input []byte, length int) []byte {
 
 	return input
 }
+
+// LeftPad pads a big endian value with leading zeros, so shortened
+// unsigned integers decode to the same value.
+func LeftPad(input []byte, length int) []byte {
+	diff := length - len(input)
+	if diff <= 0 {
+		return input[len(input)-length:]
+	}
+
+	return append(make([]byte, diff), input...)
+}
@@ -0,0 +1,403 @@
+// Package link reads and writes the CoRE Link Format (RFC 6690), used by
+// servers to describe their resources at /.well-known/core.
+package link
+
+import (
+	"bytes"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// WellKnownCore is the path of the resource listing the links of a server.
+const WellKnownCore = "/.well-known/core"
+
+// Target attributes of RFC 6690 and RFC 7252
+const (
+	ResourceTypeAttribute  = "rt"
+	InterfaceAttribute     = "if"
+	ContentFormatAttribute = "ct"
+	SizeAttribute          = "sz"
+	ObservableAttribute    = "obs"
+	TitleAttribute         = "title"
+	HrefAttribute          = "href" // Only for filtering on the target
+)
+
+// ErrMalformed is returned for documents that aren't in the link format.
+var ErrMalformed = errors.New("Malformed Link Format")
+
+// Attribute is a link parameter. Attributes without a value, such as obs,
+// have an empty value.
+type Attribute struct {
+	Name  string
+	Value string
+}
+
+// ResourceType is the rt attribute for space separated resource types.
+func ResourceType(types ...string) Attribute {
+	return Attribute{Name: ResourceTypeAttribute, Value: strings.Join(types, " ")}
+}
+
+// Interface is the if attribute for space separated interface descriptions.
+func Interface(interfaces ...string) Attribute {
+	return Attribute{Name: InterfaceAttribute, Value: strings.Join(interfaces, " ")}
+}
+
+// ContentFormat is the ct attribute for the content formats of a resource.
+func ContentFormat(formats ...uint) Attribute {
+	values := make([]string, len(formats))
+	for i, format := range formats {
+		values[i] = strconv.FormatUint(uint64(format), 10)
+	}
+	return Attribute{Name: ContentFormatAttribute, Value: strings.Join(values, " ")}
+}
+
+// Size is the sz attribute for the size of a representation in bytes.
+func Size(size uint) Attribute {
+	return Attribute{Name: SizeAttribute, Value: strconv.FormatUint(uint64(size), 10)}
+}
+
+// Observable is the obs attribute for resources supporting Observe.
+func Observable() Attribute {
+	return Attribute{Name: ObservableAttribute}
+}
+
+// Title is the title attribute for a human readable label.
+func Title(title string) Attribute {
+	return Attribute{Name: TitleAttribute, Value: title}
+}
+
+// Link is a link to a resource, usually its path, with attributes
+// describing it.
+type Link struct {
+	Target     string
+	Attributes []Attribute
+}
+
+// New creates a link to target.
+func New(target string, attributes ...Attribute) *Link {
+	return &Link{Target: target, Attributes: attributes}
+}
+
+// Get returns the value of the first attribute called name, reporting if
+// the link has one.
+func (l *Link) Get(name string) (string, bool) {
+	for _, attribute := range l.Attributes {
+		if attribute.Name == name {
+			return attribute.Value, true
+		}
+	}
+	return "", false
+}
+
+// Values returns the space separated values of every attribute called name.
+func (l *Link) Values(name string) []string {
+	var values []string
+	for _, attribute := range l.Attributes {
+		if attribute.Name == name {
+			values = append(values, strings.Fields(attribute.Value)...)
+		}
+	}
+	return values
+}
+
+// ResourceTypes returns the values of the rt attributes.
+func (l *Link) ResourceTypes() []string {
+	return l.Values(ResourceTypeAttribute)
+}
+
+// Interfaces returns the values of the if attributes.
+func (l *Link) Interfaces() []string {
+	return l.Values(InterfaceAttribute)
+}
+
+// ContentFormats returns the values of the ct attributes, skipping any that
+// aren't numbers.
+func (l *Link) ContentFormats() []uint {
+	var formats []uint
+	for _, value := range l.Values(ContentFormatAttribute) {
+		format, err := strconv.ParseUint(value, 10, 16)
+		if err != nil {
+			continue
+		}
+		formats = append(formats, uint(format))
+	}
+	return formats
+}
+
+// Size returns the value of the sz attribute, reporting if there is one.
+func (l *Link) Size() (uint, bool) {
+	value, ok := l.Get(SizeAttribute)
+	if !ok {
+		return 0, false
+	}
+	size, err := strconv.ParseUint(value, 10, 32)
+	if err != nil {
+		return 0, false
+	}
+	return uint(size), true
+}
+
+// Observable reports if the link has the obs attribute.
+func (l *Link) Observable() bool {
+	_, ok := l.Get(ObservableAttribute)
+	return ok
+}
+
+func (l *Link) String() string {
+	var b strings.Builder
+
+	b.WriteByte('<')
+	b.WriteString(l.Target)
+	b.WriteByte('>')
+
+	for _, attribute := range l.Attributes {
+		b.WriteByte(';')
+		b.WriteString(attribute.Name)
+		if attribute.Value == "" {
+			continue
+		}
+
+		b.WriteByte('=')
+		if isToken(attribute.Value) {
+			b.WriteString(attribute.Value)
+		} else {
+			b.WriteString(quote(attribute.Value))
+		}
+	}
+
+	return b.String()
+}
+
+// Numbers go without quotes, like ct=40, everything else is quoted.
+func isToken(value string) bool {
+	for _, c := range value {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// Quoted strings only escape quotes and backslashes.
+func quote(value string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value) + `"`
+}
+
+// Links is a link format document.
+type Links []*Link
+
+// Bytes serializes the links as application/link-format.
+func (links Links) Bytes() []byte {
+	var b bytes.Buffer
+	for i, l := range links {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(l.String())
+	}
+	return b.Bytes()
+}
+
+func (links Links) String() string {
+	return string(links.Bytes())
+}
+
+// Find returns the link to target, or nil if there isn't one.
+func (links Links) Find(target string) *Link {
+	for _, l := range links {
+		if l.Target == target {
+			return l
+		}
+	}
+	return nil
+}
+
+// Filter returns the links matching every query (RFC 6690 4.1). Queries
+// are name=value pairs, where a value ending in * matches any value with the
+// prefix before it. The name href matches the target, and attributes with
+// space separated values like rt match if any of their values does.
+func (links Links) Filter(queries ...string) Links {
+	filtered := Links{}
+	for _, l := range links {
+		if l.Matches(queries...) {
+			filtered = append(filtered, l)
+		}
+	}
+	return filtered
+}
+
+// Matches reports if the link matches every query, as in Filter.
+func (l *Link) Matches(queries ...string) bool {
+	for _, query := range queries {
+		if query == "" {
+			continue
+		}
+
+		name, pattern := query, ""
+		if i := strings.IndexByte(query, '='); i >= 0 {
+			name, pattern = query[:i], query[i+1:]
+		}
+
+		var values []string
+		if name == HrefAttribute {
+			values = []string{l.Target}
+		} else {
+			for _, attribute := range l.Attributes {
+				if attribute.Name != name {
+					continue
+				}
+				values = append(values, attribute.Value)
+				values = append(values, strings.Fields(attribute.Value)...)
+			}
+		}
+
+		if !matchAny(values, pattern) {
+			return false
+		}
+	}
+	return true
+}
+
+func matchAny(values []string, pattern string) bool {
+	for _, value := range values {
+		if strings.HasSuffix(pattern, "*") {
+			if strings.HasPrefix(value, pattern[:len(pattern)-1]) {
+				return true
+			}
+		} else if value == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+// Parse reads a link format document.
+func Parse(b []byte) (Links, error) {
+	p := &parser{s: string(b)}
+
+	links := Links{}
+	if p.skipSpace(); p.done() {
+		return links, nil
+	}
+
+	for {
+		l, err := p.link()
+		if err != nil {
+			return nil, err
+		}
+		links = append(links, l)
+
+		if p.skipSpace(); p.done() {
+			return links, nil
+		}
+		if !p.consume(',') {
+			return nil, ErrMalformed
+		}
+		p.skipSpace()
+	}
+}
+
+type parser struct {
+	s string
+	i int
+}
+
+func (p *parser) done() bool {
+	return p.i >= len(p.s)
+}
+
+func (p *parser) skipSpace() {
+	for !p.done() && (p.s[p.i] == ' ' || p.s[p.i] == '\t' || p.s[p.i] == '\r' || p.s[p.i] == '\n') {
+		p.i++
+	}
+}
+
+func (p *parser) consume(c byte) bool {
+	if p.done() || p.s[p.i] != c {
+		return false
+	}
+	p.i++
+	return true
+}
+
+func (p *parser) link() (*Link, error) {
+	if !p.consume('<') {
+		return nil, ErrMalformed
+	}
+	end := strings.IndexByte(p.s[p.i:], '>')
+	if end < 0 {
+		return nil, ErrMalformed
+	}
+
+	l := &Link{Target: p.s[p.i : p.i+end]}
+	p.i += end + 1
+
+	for {
+		p.skipSpace()
+		if !p.consume(';') {
+			return l, nil
+		}
+		p.skipSpace()
+
+		attribute, err := p.attribute()
+		if err != nil {
+			return nil, err
+		}
+		l.Attributes = append(l.Attributes, attribute)
+	}
+}
+
+func (p *parser) attribute() (Attribute, error) {
+	start := p.i
+	for !p.done() && isNameChar(p.s[p.i]) {
+		p.i++
+	}
+	if p.i == start {
+		return Attribute{}, ErrMalformed
+	}
+
+	attribute := Attribute{Name: p.s[start:p.i]}
+	if p.skipSpace(); !p.consume('=') {
+		return attribute, nil
+	}
+	p.skipSpace()
+
+	// Quoted strings may contain separators and escaped quotes
+	if p.consume('"') {
+		var value strings.Builder
+		for {
+			if p.done() {
+				return Attribute{}, ErrMalformed
+			}
+			c := p.s[p.i]
+			p.i++
+
+			if c == '"' {
+				break
+			}
+			if c == '\\' {
+				if p.done() {
+					return Attribute{}, ErrMalformed
+				}
+				c = p.s[p.i]
+				p.i++
+			}
+			value.WriteByte(c)
+		}
+		attribute.Value = value.String()
+		return attribute, nil
+	}
+
+	start = p.i
+	for !p.done() && p.s[p.i] != ';' && p.s[p.i] != ',' && p.s[p.i] != ' ' {
+		p.i++
+	}
+	attribute.Value = p.s[start:p.i]
+	return attribute, nil
+}
+
+func isNameChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' ||
+		strings.IndexByte("!#$&+-.^_`|~*", c) >= 0
+}
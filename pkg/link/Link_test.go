@@ -0,0 +1,189 @@
+package link
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		b       string
+		want    Links
+		wantErr bool
+	}{
+		{
+			name: "Empty",
+			b:    "",
+			want: Links{},
+		},
+		{
+			name: "RFC 6690 Example",
+			b:    `</sensors/temp>;rt="temperature-c";if="sensor",</sensors/light>;rt="light-lux";if="sensor"`,
+			want: Links{
+				New("/sensors/temp", ResourceType("temperature-c"), Interface("sensor")),
+				New("/sensors/light", ResourceType("light-lux"), Interface("sensor")),
+			},
+		},
+		{
+			name: "Unquoted Values and Flags",
+			b:    "</temp>;ct=0;obs;sz=12, </light> ; title=\"a, \\\"b\\\"; c\"",
+			want: Links{
+				New("/temp", ContentFormat(0), Observable(), Size(12)),
+				New("/light", Title(`a, "b"; c`)),
+			},
+		},
+		{
+			name:    "Missing Target",
+			b:       `/temp;rt="temperature"`,
+			wantErr: true,
+		},
+		{
+			name:    "Unterminated Quote",
+			b:       `</temp>;rt="temperature`,
+			wantErr: true,
+		},
+		{
+			name:    "Missing Separator",
+			b:       `</temp></light>`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse([]byte(tt.b))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) && !tt.wantErr {
+				t.Errorf("Parse() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLinks_Bytes(t *testing.T) {
+	tests := []struct {
+		name  string
+		links Links
+		want  string
+	}{
+		{
+			name:  "Empty",
+			links: Links{},
+			want:  "",
+		},
+		{
+			name: "Attributes",
+			links: Links{
+				New("/temp", ResourceType("temperature-c", "core.s"), ContentFormat(0, 50), Observable()),
+				New("/light", Title(`"lux"`)),
+			},
+			want: `</temp>;rt="temperature-c core.s";ct="0 50";obs,</light>;title="\"lux\""`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(tt.links.Bytes()); got != tt.want {
+				t.Errorf("Links.Bytes() = %v, want %v", got, tt.want)
+			}
+
+			parsed, err := Parse(tt.links.Bytes())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(parsed, tt.links) {
+				t.Errorf("Parse() = %v, want %v", parsed, tt.links)
+			}
+		})
+	}
+}
+
+func TestLink_Attributes(t *testing.T) {
+	l := New("/temp", ResourceType("temperature-c", "core.s"), Interface("sensor"), ContentFormat(0, 50), Size(12), Observable())
+
+	if got, want := l.ResourceTypes(), []string{"temperature-c", "core.s"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Link.ResourceTypes() = %v, want %v", got, want)
+	}
+	if got, want := l.Interfaces(), []string{"sensor"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Link.Interfaces() = %v, want %v", got, want)
+	}
+	if got, want := l.ContentFormats(), []uint{0, 50}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Link.ContentFormats() = %v, want %v", got, want)
+	}
+	if got, ok := l.Size(); !ok || got != 12 {
+		t.Errorf("Link.Size() = %v, %v, want 12, true", got, ok)
+	}
+	if !l.Observable() {
+		t.Errorf("Link.Observable() = false, want true")
+	}
+	if _, ok := New("/light").Size(); ok {
+		t.Errorf("Link.Size() ok = true, want false")
+	}
+}
+
+func TestLinks_Filter(t *testing.T) {
+	links := Links{
+		New("/sensors/temp", ResourceType("temperature-c", "core.s"), Observable()),
+		New("/sensors/light", ResourceType("light-lux"), Title("Light Level")),
+		New("/actuators/led", Interface("core.a")),
+	}
+
+	tests := []struct {
+		name    string
+		queries []string
+		want    []string
+	}{
+		{
+			name: "No Query",
+			want: []string{"/sensors/temp", "/sensors/light", "/actuators/led"},
+		},
+		{
+			name:    "Resource Type",
+			queries: []string{"rt=light-lux"},
+			want:    []string{"/sensors/light"},
+		},
+		{
+			name:    "One of Several Values",
+			queries: []string{"rt=core.s"},
+			want:    []string{"/sensors/temp"},
+		},
+		{
+			name:    "Prefix",
+			queries: []string{"href=/sensors/*"},
+			want:    []string{"/sensors/temp", "/sensors/light"},
+		},
+		{
+			name:    "Value With Spaces",
+			queries: []string{"title=Light Level"},
+			want:    []string{"/sensors/light"},
+		},
+		{
+			name:    "Flag",
+			queries: []string{"obs"},
+			want:    []string{"/sensors/temp"},
+		},
+		{
+			name:    "Every Query",
+			queries: []string{"href=/sensors/*", "rt=temp*"},
+			want:    []string{"/sensors/temp"},
+		},
+		{
+			name:    "No Match",
+			queries: []string{"if=sensor"},
+			want:    []string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := []string{}
+			for _, l := range links.Filter(tt.queries...) {
+				got = append(got, l.Target)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Links.Filter() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,348 @@
+// Package memnet is an in-memory datagram network for testing exchanges
+// without sockets. Its connections are net.PacketConns, so they can be served
+// by server.Serve and used by client.NewPacketClient, and the network can
+// lose, delay, duplicate and reorder datagrams like a constrained link.
+//
+// Delays and held back datagrams run on a virtual clock that only moves when
+// Advance or Flush is called, so what arrives when never depends on the
+// scheduler.
+package memnet
+
+import (
+	"errors"
+	"math/rand"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	queueSize = 256                   // Datagrams queued for a connection before more are dropped
+	holdTime  = 50 * time.Millisecond // Longest a datagram is held back on the clock if nothing overtakes it
+)
+
+var (
+	ErrAddrInUse = errors.New("Address In Use")
+	ErrClosed    = errors.New("Connection Closed")
+)
+
+var _ net.PacketConn = (*Conn)(nil)
+
+// Addr is the address of a connection on a network.
+type Addr string
+
+func (a Addr) Network() string { return "memnet" }
+func (a Addr) String() string  { return string(a) }
+
+// Network connects the connections listening on it. Its fields shouldn't be
+// changed while datagrams are being sent. Random choices come from the seed
+// of the network, so the same datagrams sent in the same order are lost,
+// duplicated and reordered the same way every time.
+type Network struct {
+	Loss      float64       // Chance a datagram is dropped
+	Duplicate float64       // Chance a datagram arrives twice
+	Reorder   float64       // Chance a datagram is held back until the next one to its destination overtakes it
+	Delay     time.Duration // Time every datagram takes to arrive, on the clock of the network
+
+	// Drop is asked about every datagram before the random choices, dropping
+	// it if true. Useful for losing particular messages.
+	Drop func(from, to net.Addr, b []byte) bool
+
+	mutex sync.Mutex
+	rand  *rand.Rand
+	conns map[Addr]*Conn
+	now   time.Duration    // Clock of the network, moved on by Advance
+	queue []*flight        // Datagrams on their way, in the order sent
+	held  map[Addr]*flight // Datagrams held back, by destination
+	next  int
+}
+
+type datagram struct {
+	b    []byte
+	from Addr
+}
+
+// A datagram on its way, arriving when the clock reaches due.
+type flight struct {
+	datagram
+	to  *Conn
+	due time.Duration
+}
+
+// NewNetwork creates a network that delivers every datagram, until its
+// fields say otherwise.
+func NewNetwork(seed int64) *Network {
+	return &Network{
+		rand:  rand.New(rand.NewSource(seed)),
+		conns: make(map[Addr]*Conn),
+		held:  make(map[Addr]*flight),
+	}
+}
+
+// Listen creates a connection at addr, or at a new address if empty.
+func (n *Network) Listen(addr string) (*Conn, error) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	if addr == "" {
+		n.next++
+		addr = "endpoint-" + strconv.Itoa(n.next)
+	}
+	if _, ok := n.conns[Addr(addr)]; ok {
+		return nil, ErrAddrInUse
+	}
+
+	c := &Conn{
+		network: n,
+		addr:    Addr(addr),
+		queue:   make(chan datagram, queueSize),
+		closed:  make(chan struct{}),
+		changed: make(chan struct{}),
+	}
+	n.conns[c.addr] = c
+
+	return c, nil
+}
+
+// Sends a datagram, silently dropping it like UDP if lost or nobody is
+// listening at to. Datagrams without a delay arrive straight away.
+func (n *Network) send(from Addr, to net.Addr, b []byte) {
+	if n.Drop != nil && n.Drop(Addr(from), to, b) {
+		return
+	}
+
+	n.mutex.Lock()
+	dst, ok := n.conns[Addr(to.String())]
+	if !ok || n.chance(n.Loss) {
+		n.mutex.Unlock()
+		return
+	}
+
+	f := &flight{datagram: datagram{b: b, from: from}, to: dst, due: n.now + n.Delay}
+	flights := []*flight{f}
+	if n.chance(n.Duplicate) {
+		duplicate := *f
+		flights = append(flights, &duplicate)
+	}
+
+	// Overtaking a held back datagram, or being held back
+	if held, ok := n.held[dst.addr]; ok {
+		n.unqueue(held)
+		held.due = f.due
+		flights = append(flights, held)
+	} else if n.chance(n.Reorder) {
+		f.due += holdTime
+		n.held[dst.addr] = f
+	}
+	n.queue = append(n.queue, flights...)
+
+	arrived := n.arrived()
+	n.mutex.Unlock()
+
+	for _, f := range arrived {
+		f.to.enqueue(f.datagram)
+	}
+}
+
+// Advance moves the clock of the network on by d, delivering the delayed and
+// held back datagrams that arrive by then.
+func (n *Network) Advance(d time.Duration) {
+	n.mutex.Lock()
+	n.now += d
+	arrived := n.arrived()
+	n.mutex.Unlock()
+
+	for _, f := range arrived {
+		f.to.enqueue(f.datagram)
+	}
+}
+
+// Flush delivers every datagram still on its way, moving the clock on to
+// when the last one arrives.
+func (n *Network) Flush() {
+	n.mutex.Lock()
+	for _, f := range n.queue {
+		if f.due > n.now {
+			n.now = f.due
+		}
+	}
+	arrived := n.arrived()
+	n.mutex.Unlock()
+
+	for _, f := range arrived {
+		f.to.enqueue(f.datagram)
+	}
+}
+
+// Now is the time on the clock of the network, the total it was advanced.
+func (n *Network) Now() time.Duration {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	return n.now
+}
+
+// Takes the datagrams due by now off the queue, in the order they arrive.
+// Datagrams due at the same time arrive in the order sent.
+func (n *Network) arrived() []*flight {
+	var arrived, waiting []*flight
+	for _, f := range n.queue {
+		if f.due <= n.now {
+			arrived = append(arrived, f)
+			if n.held[f.to.addr] == f {
+				delete(n.held, f.to.addr)
+			}
+		} else {
+			waiting = append(waiting, f)
+		}
+	}
+	n.queue = waiting
+
+	sort.SliceStable(arrived, func(i, j int) bool { return arrived[i].due < arrived[j].due })
+	return arrived
+}
+
+func (n *Network) unqueue(f *flight) {
+	for i := range n.queue {
+		if n.queue[i] == f {
+			n.queue = append(n.queue[:i], n.queue[i+1:]...)
+			return
+		}
+	}
+}
+
+func (n *Network) chance(p float64) bool {
+	return p > 0 && n.rand.Float64() < p
+}
+
+func (n *Network) remove(c *Conn) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	delete(n.conns, c.addr)
+	delete(n.held, c.addr)
+
+	waiting := n.queue[:0]
+	for _, f := range n.queue {
+		if f.to != c {
+			waiting = append(waiting, f)
+		}
+	}
+	n.queue = waiting
+}
+
+// Conn is a connection listening on a network.
+type Conn struct {
+	network *Network
+	addr    Addr
+	queue   chan datagram // Datagrams that arrived
+
+	mutex    sync.Mutex
+	closed   chan struct{}
+	once     sync.Once
+	deadline time.Time
+	changed  chan struct{} // Closed when the deadline changes
+}
+
+// ReadFrom reads the next datagram sent to the connection.
+func (c *Conn) ReadFrom(b []byte) (int, net.Addr, error) {
+	for {
+		c.mutex.Lock()
+		deadline, changed := c.deadline, c.changed
+		c.mutex.Unlock()
+
+		var timer *time.Timer
+		var expired <-chan time.Time
+		if !deadline.IsZero() {
+			wait := time.Until(deadline)
+			if wait <= 0 {
+				return 0, nil, timeoutError{}
+			}
+			timer = time.NewTimer(wait)
+			expired = timer.C
+		}
+
+		n, addr, ok, err := c.read(b, expired, changed)
+		if timer != nil {
+			timer.Stop()
+		}
+		if ok {
+			return n, addr, err
+		}
+	}
+}
+
+// Waits for a datagram until the connection closes or expired fires, or
+// not ok if the deadline changed first.
+func (c *Conn) read(b []byte, expired <-chan time.Time, changed <-chan struct{}) (int, net.Addr, bool, error) {
+	select {
+	case d := <-c.queue:
+		return copy(b, d.b), d.from, true, nil
+	case <-c.closed:
+		return 0, nil, true, ErrClosed
+	case <-expired:
+		return 0, nil, true, timeoutError{}
+	case <-changed:
+		return 0, nil, false, nil
+	}
+}
+
+// WriteTo sends a datagram to addr.
+func (c *Conn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	select {
+	case <-c.closed:
+		return 0, ErrClosed
+	default:
+	}
+
+	c.network.send(c.addr, addr, append([]byte(nil), b...))
+	return len(b), nil
+}
+
+// Close stops the connection listening, unblocking reads.
+func (c *Conn) Close() error {
+	err := ErrClosed
+	c.once.Do(func() {
+		close(c.closed)
+		c.network.remove(c)
+		err = nil
+	})
+	return err
+}
+
+func (c *Conn) LocalAddr() net.Addr { return c.addr }
+
+// SetDeadline sets the read deadline, as writes never block.
+func (c *Conn) SetDeadline(t time.Time) error {
+	return c.SetReadDeadline(t)
+}
+
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.deadline = t
+	close(c.changed)
+	c.changed = make(chan struct{})
+	return nil
+}
+
+func (c *Conn) SetWriteDeadline(t time.Time) error {
+	return nil
+}
+
+// Queues a datagram, dropping it if the reader is too far behind.
+func (c *Conn) enqueue(d datagram) {
+	select {
+	case <-c.closed:
+	case c.queue <- d:
+	default:
+	}
+}
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "Timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
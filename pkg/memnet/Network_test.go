@@ -0,0 +1,211 @@
+package memnet
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+)
+
+// Sends the datagrams from a new connection to another, returning what
+// arrived in order once the network is flushed.
+func exchange(t *testing.T, n *Network, datagrams ...string) []string {
+	from, err := n.Listen("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer from.Close()
+
+	to, err := n.Listen("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer to.Close()
+
+	for _, d := range datagrams {
+		if _, err := from.WriteTo([]byte(d), to.LocalAddr()); err != nil {
+			t.Fatalf("Conn.WriteTo() error = %v", err)
+		}
+	}
+
+	n.Flush()
+	return received(t, to, from.LocalAddr())
+}
+
+// Reads the datagrams that already arrived at a connection.
+func received(t *testing.T, to *Conn, from net.Addr) []string {
+	var got []string
+	b := make([]byte, 64)
+	for {
+		to.SetReadDeadline(time.Now().Add(10 * time.Millisecond))
+		size, addr, err := to.ReadFrom(b)
+		if err != nil {
+			if e, ok := err.(net.Error); !ok || !e.Timeout() {
+				t.Fatalf("Conn.ReadFrom() error = %v, want timeout", err)
+			}
+			return got
+		}
+		if addr != from {
+			t.Errorf("Conn.ReadFrom() addr = %v, want %v", addr, from)
+		}
+		got = append(got, string(b[:size]))
+	}
+}
+
+func TestNetwork(t *testing.T) {
+	tests := []struct {
+		name    string
+		network func(n *Network)
+		want    []string
+	}{
+		{
+			name:    "Reliable",
+			network: func(n *Network) {},
+			want:    []string{"a", "b", "c"},
+		},
+		{
+			name:    "Lossy",
+			network: func(n *Network) { n.Loss = 1 },
+		},
+		{
+			name:    "Duplicating",
+			network: func(n *Network) { n.Duplicate = 1 },
+			want:    []string{"a", "a", "b", "b", "c", "c"},
+		},
+		{
+			name:    "Reordering",
+			network: func(n *Network) { n.Reorder = 1 },
+			want:    []string{"b", "a", "c"}, // Nothing overtakes c, so it arrives late
+		},
+		{
+			name:    "Delayed",
+			network: func(n *Network) { n.Delay = 5 * time.Millisecond },
+			want:    []string{"a", "b", "c"},
+		},
+		{
+			name: "Dropping",
+			network: func(n *Network) {
+				n.Drop = func(from, to net.Addr, b []byte) bool { return bytes.Equal(b, []byte("b")) }
+			},
+			want: []string{"a", "c"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n := NewNetwork(1)
+			tt.network(n)
+
+			got := exchange(t, n, "a", "b", "c")
+			if len(got) != len(tt.want) {
+				t.Fatalf("Conn.ReadFrom() got %q, want %q", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("Conn.ReadFrom() got %q, want %q", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestNetwork_Advance(t *testing.T) {
+	n := NewNetwork(1)
+	n.Delay = 5 * time.Millisecond
+
+	from, err := n.Listen("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	to, err := n.Listen("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	send := func(d string) {
+		if _, err := from.WriteTo([]byte(d), to.LocalAddr()); err != nil {
+			t.Fatalf("Conn.WriteTo() error = %v", err)
+		}
+	}
+	check := func(want ...string) {
+		t.Helper()
+		got := received(t, to, from.LocalAddr())
+		if len(got) != len(want) {
+			t.Fatalf("Conn.ReadFrom() got %q, want %q at %v", got, want, n.Now())
+		}
+		for i := range got {
+			if got[i] != want[i] {
+				t.Fatalf("Conn.ReadFrom() got %q, want %q at %v", got, want, n.Now())
+			}
+		}
+	}
+
+	send("a")
+	n.Advance(2 * time.Millisecond)
+	send("b")
+	check()
+
+	n.Advance(3 * time.Millisecond)
+	check("a")
+
+	// Held back datagrams arrive late when nothing overtakes them
+	n.Reorder = 1
+	n.Advance(2 * time.Millisecond)
+	check("b")
+	send("c")
+	n.Advance(n.Delay)
+	check()
+	n.Advance(holdTime)
+	check("c")
+
+	if got, want := n.Now(), 62*time.Millisecond; got != want {
+		t.Errorf("Network.Now() = %v, want %v", got, want)
+	}
+}
+
+func TestNetwork_Seed(t *testing.T) {
+	datagrams := []string{"a", "b", "c", "d", "e", "f", "g", "h"}
+
+	lossy := func() *Network {
+		n := NewNetwork(42)
+		n.Loss, n.Duplicate = 0.4, 0.3
+		return n
+	}
+
+	first, second := exchange(t, lossy(), datagrams...), exchange(t, lossy(), datagrams...)
+	if len(first) != len(second) {
+		t.Fatalf("Network with the same seed delivered %q then %q", first, second)
+	}
+	for i := range first {
+		if first[i] != second[i] {
+			t.Fatalf("Network with the same seed delivered %q then %q", first, second)
+		}
+	}
+}
+
+func TestNetwork_Listen(t *testing.T) {
+	n := NewNetwork(1)
+
+	c, err := n.Listen("server")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := n.Listen("server"); err != ErrAddrInUse {
+		t.Errorf("Network.Listen() error = %v, want %v", err, ErrAddrInUse)
+	}
+
+	// Closing unblocks reads and frees the address
+	done := make(chan error)
+	go func() {
+		_, _, err := c.ReadFrom(make([]byte, 1))
+		done <- err
+	}()
+	c.Close()
+	if err := <-done; err != ErrClosed {
+		t.Errorf("Conn.ReadFrom() error = %v, want %v", err, ErrClosed)
+	}
+
+	if _, err := n.Listen("server"); err != nil {
+		t.Errorf("Network.Listen() error = %v", err)
+	}
+}
@@ -0,0 +1,87 @@
+package messages
+
+import (
+	"errors"
+
+	"github.com/naspinall/GoAP/pkg/coding"
+)
+
+const (
+	MaxBlockNumber = 0xFFFFF // Block numbers are 20 bit unsigned integers
+	MaxBlockSZX    = 6       // Largest block size exponent, 1024 bytes
+)
+
+// Block is the value of a Block1 or Block2 option (RFC 7959).
+type Block struct {
+	Num  uint  // Relative number of the block within the sequence
+	More bool  // More blocks follow this one
+	SZX  uint8 // Size exponent, the block size is 2**(SZX + 4)
+}
+
+// NewBlock creates a block descriptor for the given block size in bytes.
+func NewBlock(num uint, more bool, size int) (*Block, error) {
+	szx, err := SZXFromSize(size)
+	if err != nil {
+		return nil, err
+	}
+
+	if num > MaxBlockNumber {
+		return nil, errors.New("Block Number Too Large")
+	}
+
+	return &Block{
+		Num:  num,
+		More: more,
+		SZX:  szx,
+	}, nil
+}
+
+// SZXFromSize converts a block size in bytes to its size exponent.
+func SZXFromSize(size int) (uint8, error) {
+	for szx := uint8(0); szx <= MaxBlockSZX; szx++ {
+		if 1<<(szx+4) == size {
+			return szx, nil
+		}
+	}
+	return 0, errors.New("Invalid Block Size")
+}
+
+// Size of the block in bytes.
+func (b *Block) Size() int {
+	return 1 << (b.SZX + 4)
+}
+
+// Offset of the block within the complete body.
+func (b *Block) Offset() int {
+	return int(b.Num) * b.Size()
+}
+
+// Encode the block as an option value.
+func (b *Block) Encode() []byte {
+	value := b.Num<<4 | uint(b.SZX&0x07)
+	if b.More {
+		value |= 0x08
+	}
+	return coding.EncodeUint(value)
+}
+
+// DecodeBlock decodes a Block1 or Block2 option value.
+func DecodeBlock(b []byte) (*Block, error) {
+	if len(b) > 3 {
+		return nil, errors.New("Malformed Block Option")
+	}
+
+	value := coding.DecodeUint(b)
+	block := &Block{
+		Num:  value >> 4,
+		More: value&0x08 != 0,
+		SZX:  uint8(value & 0x07),
+	}
+
+	// Size exponent 7 is reserved
+	if block.SZX > MaxBlockSZX {
+		return nil, errors.New("Reserved Block Size")
+	}
+
+	return block, nil
+}
@@ -0,0 +1,185 @@
+package messages
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestBlock_Encode(t *testing.T) {
+	tests := []struct {
+		name  string
+		block Block
+		want  []byte
+	}{
+		{
+			name:  "First Block, 16 Bytes",
+			block: Block{Num: 0, More: false, SZX: 0},
+			want:  []byte{},
+		},
+		{
+			name:  "First Block With More, 1024 Bytes",
+			block: Block{Num: 0, More: true, SZX: 6},
+			want:  []byte{0x0E},
+		},
+		{
+			name:  "Two Byte Block Number",
+			block: Block{Num: 0x10, More: false, SZX: 2},
+			want:  []byte{0x01, 0x02},
+		},
+		{
+			name:  "Largest Block Number",
+			block: Block{Num: MaxBlockNumber, More: true, SZX: 6},
+			want:  []byte{0xFF, 0xFF, 0xFE},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.block.Encode(); !bytes.Equal(got, tt.want) {
+				t.Errorf("Block.Encode() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeBlock(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   []byte
+		want    *Block
+		wantErr bool
+	}{
+		{
+			name:  "Empty Value",
+			input: []byte{},
+			want:  &Block{},
+		},
+		{
+			name:  "More Blocks",
+			input: []byte{0x2A},
+			want:  &Block{Num: 2, More: true, SZX: 2},
+		},
+		{
+			name:  "Three Byte Value",
+			input: []byte{0x01, 0x00, 0x06},
+			want:  &Block{Num: 0x1000, More: false, SZX: 6},
+		},
+		{
+			name:    "Reserved Size",
+			input:   []byte{0x07},
+			wantErr: true,
+		},
+		{
+			name:    "Too Long",
+			input:   []byte{0x01, 0x00, 0x00, 0x06},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DecodeBlock(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("DecodeBlock() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DecodeBlock() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewBlock(t *testing.T) {
+	tests := []struct {
+		name       string
+		num        uint
+		size       int
+		wantOffset int
+		wantErr    bool
+	}{
+		{
+			name:       "Smallest Block",
+			num:        3,
+			size:       16,
+			wantOffset: 48,
+		},
+		{
+			name:       "Largest Block",
+			num:        2,
+			size:       1024,
+			wantOffset: 2048,
+		},
+		{
+			name:    "Invalid Size",
+			num:     0,
+			size:    100,
+			wantErr: true,
+		},
+		{
+			name:    "Number Too Large",
+			num:     MaxBlockNumber + 1,
+			size:    16,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewBlock(tt.num, false, tt.size)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewBlock() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err != nil {
+				return
+			}
+			if got.Size() != tt.size {
+				t.Errorf("NewBlock() size = %v, want %v", got.Size(), tt.size)
+			}
+			if got.Offset() != tt.wantOffset {
+				t.Errorf("NewBlock() offset = %v, want %v", got.Offset(), tt.wantOffset)
+			}
+		})
+	}
+}
+
+func TestOptions_Block(t *testing.T) {
+	options := &Options{
+		Block2: &Block{Num: 5, More: true, SZX: 4},
+		Block1: &Block{Num: 1, More: false, SZX: 6},
+		Size2:  4000,
+		Size1:  1100,
+	}
+
+	m := &Message{
+		Version:   1,
+		Code:      Content,
+		MessageID: 1,
+		Options:   options,
+		Payload:   []byte("block"),
+		buff:      &bytes.Buffer{},
+	}
+	if err := m.Encode(); err != nil {
+		t.Fatalf("Message.Encode() error = %v", err)
+	}
+
+	decoded, err := FromBytes(m.Bytes())
+	if err != nil {
+		t.Fatalf("FromBytes() error = %v", err)
+	}
+
+	if !reflect.DeepEqual(decoded.Options.Block2, options.Block2) {
+		t.Errorf("Decoded Block2 = %+v, want %+v", decoded.Options.Block2, options.Block2)
+	}
+	if !reflect.DeepEqual(decoded.Options.Block1, options.Block1) {
+		t.Errorf("Decoded Block1 = %+v, want %+v", decoded.Options.Block1, options.Block1)
+	}
+	if decoded.Options.Size1 != options.Size1 {
+		t.Errorf("Decoded Size1 = %v, want %v", decoded.Options.Size1, options.Size1)
+	}
+	if decoded.Options.Size2 != options.Size2 {
+		t.Errorf("Decoded Size2 = %v, want %v", decoded.Options.Size2, options.Size2)
+	}
+	if !bytes.Equal(decoded.Payload, m.Payload) {
+		t.Errorf("Decoded Payload = %v, want %v", decoded.Payload, m.Payload)
+	}
+}
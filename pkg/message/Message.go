@@ -4,7 +4,6 @@ import (
 	"bytes"
 	"encoding/binary"
 	"errors"
-	"fmt"
 	"io"
 	"io/ioutil"
 	"log"
@@ -14,6 +13,10 @@ import (
 
 type MessageType uint8
 
+// MaxMessageSize is the upper bound for a message and its payload, leaving
+// room for a 1024 byte block after the header and options.
+const MaxMessageSize = 1152
+
 // Type Values
 const (
 	Confirmable     MessageType = 0
@@ -34,6 +37,7 @@ const (
 	POST   uint8 = 2
 	PUT    uint8 = 3
 	DELETE uint8 = 4
+	FETCH  uint8 = 5
 
 	//Response Values
 	Created               uint8 = 65
@@ -41,6 +45,7 @@ const (
 	Valid                 uint8 = 67
 	Changed               uint8 = 68
 	Content               uint8 = 69
+	Continue              uint8 = 95
 	Bad                   uint8 = 128
 	Unauthorized          uint8 = 129
 	BadOption             uint8 = 130
@@ -72,8 +77,9 @@ type Message struct {
 	Type      MessageType // 2 bit unsigned integer, 0 Confirmable, 1 Non-Confirmable, 2 Acknowledgement (2), or Reset (3).
 	Code      uint8       // Request type (GET,POST,PUT) or response type.
 	MessageID uint16
-	Token     uint64
+	Token     []byte // Up to MaxExtendedTokenLength bytes, matching responses to requests
 	Options   *Options
+	Signal    *Signal // Signaling options, for signaling codes over reliable transports
 	Payload   []byte
 	buff      *bytes.Buffer
 }
@@ -86,16 +92,21 @@ func (m *Message) SetNonConfirmable() *Message {
 // Encoding a message
 func (m *Message) EncodeHeader() error {
 
-	token := coding.EncodeUint(uint(m.Token))
-	fmt.Println(byte(0x0F & len(token)))
+	token := m.Token
+	tkl, extended, err := encodeTokenLength(len(token))
+	if err != nil {
+		return err
+	}
+
 	// Version, Type and Token Length Encoding
-	b := (m.Version << 6) | (byte(m.Type)&0x03)<<4 | byte(0x0F&len(token))
+	b := (m.Version << 6) | (byte(m.Type)&0x03)<<4 | tkl
 
 	// Adding header byte
 	binary.Write(m.buff, binary.BigEndian, []byte{b, m.Code})
 
-	// Encoding message id
+	// Encoding message id, then any extended token length
 	m.buff.Write(coding.EncodeUint16(m.MessageID))
+	m.buff.Write(extended)
 
 	// Only encode token if required
 	if len(token) > 0 {
@@ -107,10 +118,12 @@ func (m *Message) EncodeHeader() error {
 
 func (m *Message) EncodePayload() error {
 
-	// Write Payload Marker if Options are present
-	if m.Options != nil {
-		m.buff.WriteByte(0xFF)
+	// Payload Marker is only written when there is a payload
+	if len(m.Payload) == 0 {
+		return nil
 	}
+	m.buff.WriteByte(0xFF)
+
 	// Adding padding byte and writing to buffer
 	_, err := m.buff.Write(m.Payload)
 	if err != nil {
@@ -121,15 +134,22 @@ func (m *Message) EncodePayload() error {
 }
 
 func (m *Message) Encode() error {
+	// Messages can be encoded multiple times when retransmitting
+	m.buff.Reset()
+
 	if err := m.EncodeHeader(); err != nil {
 		return err
 	}
 
+	// Empty messages are only the header
+	if m.Code == Empty {
+		return nil
+	}
+
 	b, err := m.Options.EncodeOptions()
 	if err != nil {
 		return err
 	}
-	fmt.Println(b)
 
 	m.buff.Write(b)
 
@@ -184,14 +204,26 @@ func (m *Message) DecodeHeader() error {
 
 	m.MessageID = coding.DecodeUint16(b[2:])
 
-	b = make([]byte, tokenLength)
-	n, err = m.buff.Read(b)
+	// Extended token lengths follow the message ID, 15 is reserved
+	size, err := extendedTokenLengthSize(tokenLength)
 	if err != nil {
 		return err
 	}
+	extended := m.buff.Next(size)
+	if len(extended) != size {
+		return errMalformedTokenLength
+	}
+	length := decodeTokenLength(tokenLength, extended)
 
-	// Reading the token
-	m.Token = coding.DecodeUint64(b)
+	// Reading the token, exactly as sent
+	m.Token = nil
+	if length == 0 {
+		return nil
+	}
+	if m.buff.Len() < length {
+		return errMalformedTokenLength
+	}
+	m.Token = append([]byte(nil), m.buff.Next(length)...)
 	return nil
 
 }
@@ -202,18 +234,20 @@ func (m *Message) OneByteOption() (uint16, error) {
 	if err != nil {
 		return 0, err
 	}
-	return uint16(b - 13), nil
+	return uint16(b) + 13, nil
 
 }
 
 func (m *Message) TwoByteOption() (uint16, error) {
 	b := make([]byte, 2)
-	_, err := m.buff.Read(b)
+	n, err := m.buff.Read(b)
 	if err != nil {
 		return 0, err
 	}
-	option, _ := binary.Uvarint(b)
-	return uint16(option - 269), nil
+	if n != 2 {
+		return 0, errors.New("Malformed Option")
+	}
+	return coding.DecodeUint16(b) + 269, nil
 }
 
 func (m *Message) DecodeOptions() error {
@@ -224,6 +258,11 @@ func (m *Message) DecodeOptions() error {
 
 	// Holds the option header
 	b, err := m.buff.ReadByte()
+	if err == io.EOF {
+		// No options or payload
+		m.Options = options
+		return nil
+	}
 	if err != nil {
 		return err
 	}
@@ -239,13 +278,13 @@ func (m *Message) DecodeOptions() error {
 		case 13:
 			delta, err = m.OneByteOption()
 			if err != nil {
-				return nil
+				return err
 			}
 
 		case 14:
 			delta, err = m.TwoByteOption()
 			if err != nil {
-				return nil
+				return err
 			}
 		}
 
@@ -253,25 +292,36 @@ func (m *Message) DecodeOptions() error {
 		case 13:
 			length, err = m.OneByteOption()
 			if err != nil {
-				return nil
+				return err
 			}
 
 		case 14:
 			length, err = m.TwoByteOption()
 			if err != nil {
-				return nil
+				return err
 			}
 		}
 
 		// Getting option data
 		val := make([]byte, length)
-		_, err := m.buff.Read(val)
-		if err != nil {
+		n, err := m.buff.Read(val)
+		if err != nil && length > 0 {
 			return err
 		}
+		if n != int(length) {
+			return errors.New("Malformed Option")
+		}
 
 		// Setting Option
-		err = options.DecodeOption(uint(delta+prevDelta), val)
+		if IsSignal(m.Code) {
+			if m.Signal == nil {
+				m.Signal = &Signal{}
+			}
+			err = m.Signal.DecodeOption(m.Code, uint(delta+prevDelta), val)
+		} else {
+			err = options.DecodeOption(uint(delta+prevDelta), val)
+			options.Raw = append(options.Raw, Option{Number: uint(delta + prevDelta), Value: val})
+		}
 		if err != nil {
 			return err
 		}
@@ -279,6 +329,10 @@ func (m *Message) DecodeOptions() error {
 		prevDelta += delta
 		// Reading next header or payload indicator byte
 		b, err = m.buff.ReadByte()
+		if err == io.EOF {
+			// Options without a payload
+			break
+		}
 		if err != nil {
 			return err
 		}
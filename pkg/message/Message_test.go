@@ -13,7 +13,7 @@ func TestMessage_DecodeHeader(t *testing.T) {
 		TokenLength uint8
 		Code        uint8
 		MessageID   uint16
-		Token       uint64
+		Token       []byte
 		Options     *Options
 		Payload     []byte
 		buff        *bytes.Buffer
@@ -27,7 +27,7 @@ func TestMessage_DecodeHeader(t *testing.T) {
 		wantTokenLength uint8
 		wantCode        uint8
 		wantMessageID   uint16
-		wantToken       uint64
+		wantToken       []byte
 	}{
 		{
 			name: "Version and Type, No Header",
@@ -40,7 +40,7 @@ func TestMessage_DecodeHeader(t *testing.T) {
 			wantTokenLength: 0x1,
 			wantCode:        0x11,
 			wantMessageID:   0x1111,
-			wantToken:       0x01,
+			wantToken:       []byte{0x01},
 		},
 		{
 			name: "Version and Type, No Header",
@@ -53,7 +53,7 @@ func TestMessage_DecodeHeader(t *testing.T) {
 			wantTokenLength: 0x2,
 			wantCode:        0x11,
 			wantMessageID:   0x2222,
-			wantToken:       0x0101,
+			wantToken:       []byte{0x01, 0x01},
 		},
 	}
 	for _, tt := range tests {
@@ -215,7 +215,7 @@ func TestMessage_DecodePayload(t *testing.T) {
 		TokenLength uint8
 		Code        uint8
 		MessageID   uint16
-		Token       uint64
+		Token       []byte
 		Options     *Options
 		Payload     []byte
 		buff        *bytes.Buffer
@@ -278,7 +278,7 @@ func TestMessage_EncodePayload(t *testing.T) {
 		TokenLength uint8
 		Code        uint8
 		MessageID   uint16
-		Token       uint64
+		Token       []byte
 		Options     *Options
 		Payload     []byte
 		buff        *bytes.Buffer
@@ -335,7 +335,7 @@ func TestMessage_EncodeHeader(t *testing.T) {
 		TokenLength uint8
 		Code        uint8
 		MessageID   uint16
-		Token       uint64
+		Token       []byte
 		Options     *Options
 		Payload     []byte
 		buff        *bytes.Buffer
@@ -355,7 +355,7 @@ func TestMessage_EncodeHeader(t *testing.T) {
 				TokenLength: 1,
 				Code:        1,
 				MessageID:   1,
-				Token:       1,
+				Token:       []byte{1},
 			},
 			wantHeader: []byte{0x15, 0x01, 0x01, 0x00, 0x01},
 		},
@@ -403,7 +403,7 @@ func TestMessage_Encode(t *testing.T) {
 		TokenLength uint8
 		Code        uint8
 		MessageID   uint16
-		Token       uint64
+		Token       []byte
 		Options     *Options
 		Payload     []byte
 		buff        *bytes.Buffer
@@ -421,7 +421,7 @@ func TestMessage_Encode(t *testing.T) {
 				TokenLength: 2,
 				Code:        4,
 				MessageID:   3,
-				Token:       0x0101,
+				Token:       []byte{0x01, 0x01},
 				Options:     &Options{},
 			},
 		},
@@ -475,3 +475,64 @@ func TestMessage_Encode(t *testing.T) {
 		})
 	}
 }
+
+func TestMessage_Token(t *testing.T) {
+	tests := []struct {
+		name    string
+		token   []byte
+		wantErr bool
+	}{
+		{name: "No Token"},
+		{name: "Leading Zero", token: []byte{0x00, 0x01}},
+		{name: "All Zeros", token: []byte{0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}},
+		{name: "Eight Bytes", token: []byte{1, 2, 3, 4, 5, 6, 7, 8}},
+		{name: "Twelve Bytes", token: bytes.Repeat([]byte{0x12}, 12)},
+		{name: "One Byte Extended Length", token: bytes.Repeat([]byte{0x13}, 268)},
+		{name: "Two Byte Extended Length", token: bytes.Repeat([]byte{0x14}, 269)},
+		{name: "Longest", token: bytes.Repeat([]byte{0x15}, MaxExtendedTokenLength)},
+		{name: "Too Long", token: bytes.Repeat([]byte{0x16}, MaxExtendedTokenLength+1), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewMessage(Get(), WithMessageID(1))
+			m.Token = tt.token
+
+			if err := m.Encode(); (err != nil) != tt.wantErr {
+				t.Fatalf("Message.Encode() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				if NewMessage(WithToken(tt.token)) != nil {
+					t.Error("NewMessage() with a long token != nil")
+				}
+				return
+			}
+
+			got, err := FromBytes(m.Bytes())
+			if err != nil {
+				t.Fatalf("FromBytes() error = %v", err)
+			}
+			if !bytes.Equal(got.Token, tt.token) || len(got.Token) != len(tt.token) {
+				t.Errorf("FromBytes() Token = %X, want %X", got.Token, tt.token)
+			}
+		})
+	}
+}
+
+func TestFromBytes_TokenLength(t *testing.T) {
+	tests := []struct {
+		name string
+		b    []byte
+	}{
+		{name: "Reserved Length", b: []byte{0x4F, 0x01, 0x00, 0x01, 1, 2, 3, 4, 5, 6, 7, 8, 9}},
+		{name: "Missing Extended Length", b: []byte{0x4E, 0x01, 0x00, 0x01, 0x00}},
+		{name: "Missing Token", b: []byte{0x44, 0x01, 0x00, 0x01, 1, 2}},
+		{name: "Missing Extended Token", b: []byte{0x4D, 0x01, 0x00, 0x01, 0x00, 1, 2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := FromBytes(tt.b); err == nil {
+				t.Error("FromBytes() error = nil, want malformed token length")
+			}
+		})
+	}
+}
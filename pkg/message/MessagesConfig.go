@@ -3,6 +3,8 @@ package messages
 import (
 	"bytes"
 	"errors"
+	"io"
+	"io/ioutil"
 )
 
 func (m *Message) AsAcknowledge() *Message {
@@ -10,7 +12,7 @@ func (m *Message) AsAcknowledge() *Message {
 	// Reusing memory, clearing values
 	m.Type = Acknowledgement
 	m.Code = Empty
-	m.Token = 0
+	m.Token = nil
 	//m.Options = nil
 	m.Payload = nil
 
@@ -25,9 +27,7 @@ func NewMessage(cfgs ...MessagesConfig) *Message {
 	m := &Message{
 		Version: 1,
 		buff:    &bytes.Buffer{},
-		Options: &Options{
-			MaxAge: 60,
-		},
+		Options: &Options{},
 	}
 
 	for _, cfg := range cfgs {
@@ -58,7 +58,7 @@ func (m *Message) DELETE() *Message {
 	return m
 }
 
-func (m *Message) SetToken(token uint64) *Message {
+func (m *Message) SetToken(token []byte) *Message {
 	m.Token = token
 	return m
 }
@@ -82,17 +82,17 @@ func WithContentType(contentType string) MessagesConfig {
 	return func(m *Message) error {
 
 		if contentType == "text/plain" {
-			m.Options.ContentFormat = TextPlain
+			m.Options.SetContentFormat(TextPlain)
 		} else if contentType == "application/link-format" {
-			m.Options.ContentFormat = LinkFormat
+			m.Options.SetContentFormat(LinkFormat)
 		} else if contentType == "application/xml" {
-			m.Options.ContentFormat = XML
+			m.Options.SetContentFormat(XML)
 		} else if contentType == "application/octet-stream" {
-			m.Options.ContentFormat = OctetStream
+			m.Options.SetContentFormat(OctetStream)
 		} else if contentType == "application/exi" {
-			m.Options.ContentFormat = EXI
+			m.Options.SetContentFormat(EXI)
 		} else if contentType == "application/json" {
-			m.Options.ContentFormat = JSON
+			m.Options.SetContentFormat(JSON)
 		} else {
 			return errors.New("Bad Content Format Provided")
 		}
@@ -114,8 +114,13 @@ func WithType(Type MessageType) MessagesConfig {
 	}
 }
 
-func WithToken(token uint64) MessagesConfig {
+// WithToken sets the token, of up to MaxExtendedTokenLength bytes. Tokens
+// over MaxTokenLength bytes need a peer supporting RFC 8974.
+func WithToken(token []byte) MessagesConfig {
 	return func(m *Message) error {
+		if len(token) > MaxExtendedTokenLength {
+			return ErrTokenTooLong
+		}
 		m.SetToken(token)
 		return nil
 	}
@@ -128,6 +133,13 @@ func WithMessageID(id uint16) MessagesConfig {
 	}
 }
 
+func WithObserve(observe uint) MessagesConfig {
+	return func(m *Message) error {
+		m.Options.Observe = &observe
+		return nil
+	}
+}
+
 func WithPayload(b []byte) MessagesConfig {
 	return func(m *Message) error {
 		m.SetPayload(b)
@@ -135,6 +147,40 @@ func WithPayload(b []byte) MessagesConfig {
 	}
 }
 
+// WithBody reads the payload from r.
+func WithBody(r io.Reader) MessagesConfig {
+	return func(m *Message) error {
+		b, err := ioutil.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		m.SetPayload(b)
+		return nil
+	}
+}
+
+func WithContentFormat(contentFormat uint) MessagesConfig {
+	return func(m *Message) error {
+		m.Options.SetContentFormat(contentFormat)
+		return nil
+	}
+}
+
+// WithAccept asks for a response in the content format.
+func WithAccept(contentFormat uint) MessagesConfig {
+	return func(m *Message) error {
+		m.Options.SetAccept(contentFormat)
+		return nil
+	}
+}
+
+// WithOption adds a registered option, see RegisterOption.
+func WithOption(number uint, value []byte) MessagesConfig {
+	return func(m *Message) error {
+		return m.Options.Add(number, value)
+	}
+}
+
 func Get() MessagesConfig {
 	return func(m *Message) error {
 		m.GET()
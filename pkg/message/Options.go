@@ -1,7 +1,9 @@
 package messages
 
 import (
+	"errors"
 	"net/url"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -13,17 +15,36 @@ const (
 	URIHost       uint = 3
 	ETag          uint = 4
 	IfNoneMatch   uint = 5
+	Observe       uint = 6
 	URIPort       uint = 7
 	LocationPath  uint = 8
+	OSCORE        uint = 9
 	URIPath       uint = 11
 	ContentFormat uint = 12
 	MaxAge        uint = 14
 	URIQuery      uint = 15
 	Accept        uint = 17
 	LocationQuery uint = 20
+	Block2        uint = 23
+	Block1        uint = 27
+	Size2         uint = 28
 	ProxyURI      uint = 35
 	ProxyScheme   uint = 39
 	Size1         uint = 60
+	NoResponse    uint = 258
+)
+
+// No-Response option bits, suppressing responses of a class (RFC 7967)
+const (
+	NoResponseSuccess     uint = 2
+	NoResponseClientError uint = 8
+	NoResponseServerError uint = 16
+)
+
+// Observe option values in requests (RFC 7641)
+const (
+	ObserveRegister   uint = 0
+	ObserveDeregister uint = 1
 )
 
 // Options Data Types
@@ -33,21 +54,52 @@ const (
 // string  UTF8 string
 
 type Options struct {
-	ContentFormat uint
+	ContentFormat *uint
 	ETag          [][]byte
 	LocationPath  []string
 	LocationQuery []string
-	MaxAge        uint
+	MaxAge        *uint // Seconds, 60 when absent
 	ProxyURI      *string
 	ProxyScheme   *string
 	URIHost       *string
 	URIPath       []string
 	URIPort       uint
 	URIQuery      []string
-	Accept        uint
+	Accept        *uint
 	IfMatch       [][]byte
 	IfNoneMatch   bool
+	Observe       *uint
 	Size1         uint
+	Block2        *Block
+	Block1        *Block
+	Size2         uint
+	OSCORE        []byte // Set for messages protected with OSCORE, may be empty
+	NoResponse    *uint
+
+	// Every option of a decoded message in the order received, including
+	// the ones without a field. Options without a field are encoded from
+	// here.
+	Raw []Option
+}
+
+// Option is a single option as it is encoded.
+type Option struct {
+	Number uint
+	Value  []byte
+}
+
+// DefaultPort returns the default port for a URI scheme.
+func DefaultPort(scheme string) int {
+	switch scheme {
+	case "coaps", "coaps+tcp":
+		return 5684
+	case "coap+ws":
+		return 80
+	case "coaps+ws":
+		return 443
+	default:
+		return 5683
+	}
 }
 
 func (o *Options) SetURI(rawurl string) error {
@@ -58,7 +110,7 @@ func (o *Options) SetURI(rawurl string) error {
 
 	parsedPort := parsedURL.Port()
 	if parsedPort == "" {
-		parsedPort = "5683"
+		parsedPort = strconv.Itoa(DefaultPort(parsedURL.Scheme))
 	}
 
 	// Getting port
@@ -67,7 +119,11 @@ func (o *Options) SetURI(rawurl string) error {
 		return err
 	}
 
+	// Default ports go without the option (RFC 7252 6.4)
 	o.URIPort = uint(portInt)
+	if portInt == DefaultPort(parsedURL.Scheme) {
+		o.URIPort = 0
+	}
 
 	// Getting Host
 	host := parsedURL.Hostname()
@@ -80,9 +136,62 @@ func (o *Options) SetURI(rawurl string) error {
 	}
 	o.URIPath = path[1:len(path)]
 
+	// Getting queries, each argument in an option of its own
+	o.URIQuery = nil
+	if parsedURL.RawQuery != "" {
+		for _, query := range strings.Split(parsedURL.RawQuery, "&") {
+			if unescaped, err := url.PathUnescape(query); err == nil {
+				query = unescaped
+			}
+			o.URIQuery = append(o.URIQuery, query)
+		}
+	}
+
 	return nil
 }
 
+// SetContentFormat sets the Content-Format option.
+func (o *Options) SetContentFormat(contentFormat uint) {
+	o.ContentFormat = &contentFormat
+}
+
+// SetAccept sets the Accept option, the content format wanted in the
+// response.
+func (o *Options) SetAccept(contentFormat uint) {
+	o.Accept = &contentFormat
+}
+
+// SetMaxAge sets the Max-Age option, in seconds.
+func (o *Options) SetMaxAge(maxAge uint) {
+	o.MaxAge = &maxAge
+}
+
+// Location is the relative URI in the Location-Path and Location-Query
+// options of a 2.01 Created response, or nil if there are neither.
+func (o *Options) Location() *url.URL {
+	if o.LocationPath == nil && o.LocationQuery == nil {
+		return nil
+	}
+
+	location := &url.URL{}
+	if o.LocationPath != nil {
+		segments := make([]string, len(o.LocationPath))
+		for index, segment := range o.LocationPath {
+			segments[index] = url.PathEscape(segment)
+		}
+		location.Path = "/" + strings.Join(o.LocationPath, "/")
+		location.RawPath = "/" + strings.Join(segments, "/")
+	}
+
+	queries := make([]string, len(o.LocationQuery))
+	for index, query := range o.LocationQuery {
+		queries[index] = url.PathEscape(query)
+	}
+	location.RawQuery = strings.Join(queries, "&")
+
+	return location
+}
+
 func (o *Options) DecodeOption(number uint, b []byte) error {
 	switch number {
 	// If-Match
@@ -102,6 +211,11 @@ func (o *Options) DecodeOption(number uint, b []byte) error {
 	case IfNoneMatch:
 		o.IfNoneMatch = true
 
+	// Observe
+	case Observe:
+		observe := coding.DecodeUint(b)
+		o.Observe = &observe
+
 	// URI-Port
 	case URIPort:
 		o.URIPort = coding.DecodeUint(b)
@@ -110,23 +224,30 @@ func (o *Options) DecodeOption(number uint, b []byte) error {
 	case LocationPath:
 		o.LocationPath = append(o.LocationPath, string(b))
 
+	// OSCORE
+	case OSCORE:
+		o.OSCORE = append([]byte{}, b...)
+
 	// URI-Path
 	case URIPath:
 		o.URIPath = append(o.URIPath, string(b))
 
 	// Content Format
 	case ContentFormat:
-		o.ContentFormat = coding.DecodeUint(b)
+		contentFormat := coding.DecodeUint(b)
+		o.ContentFormat = &contentFormat
 	//Max-Age
 	case MaxAge:
-		o.MaxAge = coding.DecodeUint(b)
+		maxAge := coding.DecodeUint(b)
+		o.MaxAge = &maxAge
 
 	// URI-Query
 	case URIQuery:
 		o.URIQuery = append(o.URIQuery, string(b))
 	// Accept
 	case Accept:
-		o.Accept = coding.DecodeUint(b)
+		accept := coding.DecodeUint(b)
+		o.Accept = &accept
 
 	// Location Query
 	case LocationQuery:
@@ -142,268 +263,196 @@ func (o *Options) DecodeOption(number uint, b []byte) error {
 		proxyScheme := string(b)
 		o.ProxyScheme = &proxyScheme
 
+	// Block2
+	case Block2:
+		block, err := DecodeBlock(b)
+		if err != nil {
+			return err
+		}
+		o.Block2 = block
+
+	// Block1
+	case Block1:
+		block, err := DecodeBlock(b)
+		if err != nil {
+			return err
+		}
+		o.Block1 = block
+
+	// Size2
+	case Size2:
+		o.Size2 = coding.DecodeUint(b)
+
 	// Size1
 	case Size1:
 		o.Size1 = coding.DecodeUint(b)
+
+	// No-Response
+	case NoResponse:
+		noResponse := coding.DecodeUint(b)
+		o.NoResponse = &noResponse
 	}
 	return nil
 }
 
+// ErrOptionTooLarge is returned for option deltas and lengths that don't
+// fit in the extended fields.
+var ErrOptionTooLarge = errors.New("Option Too Large")
+
 func EncodeSingleOption(delta uint, b []byte) ([]byte, error) {
 	var header byte
 	var extendedOptions []byte
 
 	// Encoding Delta
-	if delta >= 269 {
+	if delta >= 65805 {
+		return nil, ErrOptionTooLarge
+	} else if delta >= 269 {
 		header = 0xE0
-		extendedDelta := uint16(delta - 269)
-		extendedOptions = append(extendedOptions, coding.EncodeUint16(uint16(extendedDelta))[1])
+		extendedOptions = append(extendedOptions, coding.EncodeUint16(uint16(delta-269))...)
 	} else if delta >= 13 {
 		header = 0xD0
-		extendedDelta := uint16(delta - 13)
-		extendedOptions = append(extendedOptions, coding.EncodeUint16(uint16(extendedDelta))[1])
+		extendedOptions = append(extendedOptions, byte(delta-13))
 	} else {
-		header = coding.EncodeUint16(uint16(delta))[1] << 4
+		header = byte(delta) << 4
 	}
 
 	length := uint(len(b))
 
 	// Encoding Length
-	if length >= 269 {
-		header = 0xE0 ^ header
-		extendedLength := uint16(length - 269)
-		extendedOptions = append(extendedOptions, coding.EncodeUint16(uint16(extendedLength))[1])
+	if length >= 65805 {
+		return nil, ErrOptionTooLarge
+	} else if length >= 269 {
+		header |= 0x0E
+		extendedOptions = append(extendedOptions, coding.EncodeUint16(uint16(length-269))...)
 	} else if length >= 13 {
-		header = 0x0D ^ header
-		extendedLength := byte(length - 13)
-		extendedOptions = append(extendedOptions, coding.EncodeUint16(uint16(extendedLength))[1])
+		header |= 0x0D
+		extendedOptions = append(extendedOptions, byte(length-13))
 	} else {
-		header |= coding.EncodeUint16(uint16(length))[1]
+		header |= byte(length)
 	}
 
 	// Adding header to start of slice with extended options or lengths
 	return append(append([]byte{header}, extendedOptions...), b...), nil
 }
 
-func (o *Options) EncodeOptions() ([]byte, error) {
-	var total []byte
-	var previousValue uint = 0
-
-	if o.IfMatch != nil {
-		delta := IfMatch - previousValue
-		previousValue = IfMatch
-
-		for _, match := range o.IfMatch {
-
-			b, err := EncodeSingleOption(delta, match)
-			if err != nil {
-				return nil, err
-			}
-			total = append(total, b...)
-			// If there are more than one eTag then delta is zero.
-			delta = 0
-		}
+// fields lists the options set in the fields, in ascending order.
+func (o *Options) fields() []Option {
+	var options []Option
+	add := func(number uint, value []byte) {
+		options = append(options, Option{Number: number, Value: value})
 	}
 
+	for _, match := range o.IfMatch {
+		add(IfMatch, match)
+	}
 	if o.URIHost != nil {
-		delta := uint(URIHost) - previousValue
-		previousValue = URIHost
-
-		b, err := EncodeSingleOption(delta, []byte(*o.URIHost))
-		if err != nil {
-			return nil, err
-		}
-
-		total = append(total, b...)
-
+		add(URIHost, []byte(*o.URIHost))
 	}
-
-	if o.ETag != nil {
-		delta := ETag - previousValue
-		previousValue = ETag
-
-		for _, eTag := range o.ETag {
-
-			b, err := EncodeSingleOption(delta, eTag)
-			if err != nil {
-				return nil, err
-			}
-			total = append(total, b...)
-			// If there are more than one eTag then delta is zero.
-			delta = 0
-		}
-
+	for _, eTag := range o.ETag {
+		add(ETag, eTag)
 	}
-
 	if o.IfNoneMatch {
-		delta := IfNoneMatch - previousValue
-		previousValue = IfNoneMatch
-
-		b, err := EncodeSingleOption(delta, []byte{})
-		if err != nil {
-			return nil, err
-		}
-		total = append(total, b...)
-		// If there are more than one eTag then delta is zero.
-		delta = 0
-
+		add(IfNoneMatch, []byte{})
 	}
-
-	{
-		delta := URIPort - previousValue
-		previousValue = URIPort
-
-		value := coding.EncodeUint(o.URIPort)
-		b, err := EncodeSingleOption(delta, value)
-		if err != nil {
-			return nil, err
-		}
-
-		total = append(total, b...)
+	if o.Observe != nil {
+		add(Observe, coding.EncodeUint(*o.Observe))
 	}
-
-	if o.LocationPath != nil {
-		delta := LocationPath - previousValue
-		previousValue = LocationPath
-
-		for _, path := range o.LocationPath {
-
-			b, err := EncodeSingleOption(delta, []byte(path))
-			if err != nil {
-				return nil, err
-			}
-			total = append(total, b...)
-			// If there are more than one eTag then delta is zero.
-			delta = 0
-		}
+	if o.URIPort != 0 {
+		add(URIPort, coding.EncodeUint(o.URIPort))
 	}
-
-	if o.URIPath != nil {
-		delta := URIPath - previousValue
-		previousValue = URIPath
-
-		for _, path := range o.URIPath {
-
-			b, err := EncodeSingleOption(delta, []byte(path))
-			if err != nil {
-				return nil, err
-			}
-			total = append(total, b...)
-			// If there are more than one eTag then delta is zero.
-			delta = 0
-		}
+	for _, path := range o.LocationPath {
+		add(LocationPath, []byte(path))
 	}
-
-	{
-		delta := ContentFormat - previousValue
-		previousValue = ContentFormat
-
-		value := coding.EncodeUint(o.ContentFormat)
-		b, err := EncodeSingleOption(delta, value)
-		if err != nil {
-			return nil, err
-		}
-
-		total = append(total, b...)
-
+	if o.OSCORE != nil {
+		add(OSCORE, o.OSCORE)
 	}
-
-	{
-		delta := MaxAge - previousValue
-		previousValue = MaxAge
-
-		value := coding.EncodeUint(o.MaxAge)
-		b, err := EncodeSingleOption(delta, value)
-		if err != nil {
-			return nil, err
-		}
-
-		total = append(total, b...)
+	for _, path := range o.URIPath {
+		add(URIPath, []byte(path))
 	}
-
-	if o.URIQuery != nil {
-		delta := URIQuery - previousValue
-		previousValue = URIQuery
-
-		for _, query := range o.URIQuery {
-
-			b, err := EncodeSingleOption(delta, []byte(query))
-			if err != nil {
-				return nil, err
-			}
-			total = append(total, b...)
-			// If there are more than one eTag then delta is zero.
-			delta = 0
-		}
+	if o.ContentFormat != nil {
+		add(ContentFormat, coding.EncodeUint(*o.ContentFormat))
 	}
-
-	{
-		delta := Accept - previousValue
-		previousValue = Accept
-
-		value := coding.EncodeUint(o.Accept)
-		b, err := EncodeSingleOption(delta, value)
-		if err != nil {
-			return nil, err
-		}
-
-		total = append(total, b...)
-
+	if o.MaxAge != nil {
+		add(MaxAge, coding.EncodeUint(*o.MaxAge))
 	}
-
-	if o.LocationQuery != nil {
-		delta := LocationQuery - previousValue
-		previousValue = LocationQuery
-
-		for _, query := range o.LocationQuery {
-
-			b, err := EncodeSingleOption(delta, []byte(query))
-			if err != nil {
-				return nil, err
-			}
-			total = append(total, b...)
-			// If there are more than one eTag then delta is zero.
-			delta = 0
-		}
-
+	for _, query := range o.URIQuery {
+		add(URIQuery, []byte(query))
+	}
+	if o.Accept != nil {
+		add(Accept, coding.EncodeUint(*o.Accept))
+	}
+	for _, query := range o.LocationQuery {
+		add(LocationQuery, []byte(query))
+	}
+	if o.Block2 != nil {
+		add(Block2, o.Block2.Encode())
+	}
+	if o.Block1 != nil {
+		add(Block1, o.Block1.Encode())
+	}
+	if o.Size2 != 0 {
+		add(Size2, coding.EncodeUint(o.Size2))
 	}
-
 	if o.ProxyURI != nil {
-		delta := ProxyURI - previousValue
-		previousValue = ProxyURI
+		add(ProxyURI, []byte(*o.ProxyURI))
+	}
+	if o.ProxyScheme != nil {
+		add(ProxyScheme, []byte(*o.ProxyScheme))
+	}
+	if o.Size1 != 0 {
+		add(Size1, coding.EncodeUint(o.Size1))
+	}
+	if o.NoResponse != nil {
+		add(NoResponse, coding.EncodeUint(*o.NoResponse))
+	}
 
-		b, err := EncodeSingleOption(delta, []byte(*o.ProxyURI))
-		if err != nil {
-			return nil, err
-		}
+	return options
+}
 
-		total = append(total, b...)
+// hasField checks if an option is kept in a field of Options.
+func hasField(number uint) bool {
+	switch number {
+	case IfMatch, URIHost, ETag, IfNoneMatch, Observe, URIPort, LocationPath, OSCORE, URIPath, ContentFormat,
+		MaxAge, URIQuery, Accept, LocationQuery, Block2, Block1, Size2, ProxyURI, ProxyScheme, Size1, NoResponse:
+		return true
+	default:
+		return false
 	}
+}
 
-	if o.ProxyScheme != nil {
-		delta := ProxyScheme - previousValue
-		previousValue = ProxyScheme
-
-		b, err := EncodeSingleOption(delta, []byte(*o.ProxyScheme))
-		if err != nil {
-			return nil, err
+// List returns every option of the message in the order they are encoded.
+// Options with fields are taken from the fields, the rest from Raw.
+func (o *Options) List() []Option {
+	options := o.fields()
+	for _, option := range o.Raw {
+		if !hasField(option.Number) {
+			options = append(options, option)
 		}
-
-		total = append(total, b...)
 	}
 
-	{
-		delta := Size1 - previousValue
-		previousValue = Size1
+	// Repeated options keep their order
+	sort.SliceStable(options, func(i, j int) bool {
+		return options[i].Number < options[j].Number
+	})
+	return options
+}
+
+func (o *Options) EncodeOptions() ([]byte, error) {
+	return encodeOptionList(o.List())
+}
+
+// Encodes options sorted by number.
+func encodeOptionList(options []Option) ([]byte, error) {
+	var total []byte
+	var previousValue uint = 0
 
-		value := coding.EncodeUint(o.URIPort)
-		b, err := EncodeSingleOption(delta, value)
+	for _, option := range options {
+		b, err := EncodeSingleOption(option.Number-previousValue, option.Value)
 		if err != nil {
 			return nil, err
 		}
+		previousValue = option.Number
 		total = append(total, b...)
-		// If there are more than one eTag then delta is zero.
-		delta = 0
 	}
 
 	return total, nil
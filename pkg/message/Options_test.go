@@ -49,7 +49,7 @@ func TestEncodeSingleOption(t *testing.T) {
 				delta: 0x10E,
 				b:     []byte{0x1},
 			},
-			want:    []byte{0xE1, 0x01, 0x1},
+			want:    []byte{0xE1, 0x00, 0x01, 0x1},
 			wantErr: false,
 		},
 		{
@@ -80,18 +80,18 @@ var testHost = "coap://test.com"
 
 func TestOptions_SetURI(t *testing.T) {
 	type fields struct {
-		ContentFormat uint
+		ContentFormat *uint
 		ETag          [][]byte
 		LocationPath  []string
 		LocationQuery []string
-		MaxAge        uint
+		MaxAge        *uint
 		ProxyURI      *string
 		ProxyScheme   *string
 		URIHost       *string
 		URIPath       []string
 		URIPort       uint
 		URIQuery      []string
-		Accept        uint
+		Accept        *uint
 		IfMatch       [][]byte
 		IfNoneMatch   bool
 		Size1         uint
@@ -100,13 +100,14 @@ func TestOptions_SetURI(t *testing.T) {
 		rawurl string
 	}
 	tests := []struct {
-		name     string
-		fields   fields
-		args     args
-		wantErr  bool
-		wantURL  string
-		wantPort uint
-		wantPath []string
+		name      string
+		fields    fields
+		args      args
+		wantErr   bool
+		wantURL   string
+		wantPort  uint
+		wantPath  []string
+		wantQuery []string
 	}{
 		{
 			name: "Setting Normal URL",
@@ -119,7 +120,7 @@ func TestOptions_SetURI(t *testing.T) {
 			wantErr:  false,
 			wantURL:  "test.com",
 			wantPath: []string{},
-			wantPort: 5683,
+			wantPort: 0, // Default port
 		},
 		{
 			name: "Changing port number",
@@ -145,7 +146,34 @@ func TestOptions_SetURI(t *testing.T) {
 			wantErr:  false,
 			wantURL:  "test.com",
 			wantPath: []string{"a", "path"},
-			wantPort: 5683,
+			wantPort: 0, // Default port
+		},
+		{
+			name: "Secure URL Default Port",
+			fields: fields{
+				URIHost: &testHost,
+			},
+			args: args{
+				rawurl: "coaps://test.com/a",
+			},
+			wantErr:  false,
+			wantURL:  "test.com",
+			wantPath: []string{"a"},
+			wantPort: 0, // Default port
+		},
+		{
+			name: "Setting URL With Query",
+			fields: fields{
+				URIHost: &testHost,
+			},
+			args: args{
+				rawurl: "coap://test.com/.well-known/core?rt=temp%20c*&obs",
+			},
+			wantErr:   false,
+			wantURL:   "test.com",
+			wantPath:  []string{".well-known", "core"},
+			wantPort:  0, // Default port
+			wantQuery: []string{"rt=temp c*", "obs"},
 		},
 	}
 	for _, tt := range tests {
@@ -183,6 +211,51 @@ func TestOptions_SetURI(t *testing.T) {
 				t.Errorf("Options.SetURI() URIPath = %v, wantPath %v", o.URIPath, tt.wantPath)
 			}
 
+			if !reflect.DeepEqual(o.URIQuery, tt.wantQuery) {
+				t.Errorf("Options.SetURI() URIQuery = %v, wantQuery %v", o.URIQuery, tt.wantQuery)
+			}
+
+		})
+	}
+}
+
+func TestOptions_EncodeOptions(t *testing.T) {
+	host := []byte("10.0.0.1")
+	tests := []struct {
+		name    string
+		options *Options
+		want    []byte
+	}{
+		{
+			name:    "Request Without Defaults",
+			options: NewMessage(Get(), WithURI("coap://10.0.0.1/a")).Options,
+			want:    append(append([]byte{0x38}, host...), 0x81, 'a'),
+		},
+		{
+			name:    "Other Port",
+			options: NewMessage(Get(), WithURI("coap://10.0.0.1:5684/a")).Options,
+			want:    append(append([]byte{0x38}, host...), 0x42, 0x16, 0x34, 0x41, 'a'),
+		},
+		{
+			name:    "Zero Content Format And Max Age",
+			options: &Options{ContentFormat: new(uint), MaxAge: new(uint)},
+			want:    []byte{0xC0, 0x20},
+		},
+		{
+			name:    "Zero Accept",
+			options: NewMessage(Get(), WithAccept(TextPlain)).Options,
+			want:    []byte{0xD0, 0x04},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.options.EncodeOptions()
+			if err != nil {
+				t.Fatalf("Options.EncodeOptions() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Options.EncodeOptions() = %X, want %X", got, tt.want)
+			}
 		})
 	}
 }
@@ -0,0 +1,235 @@
+package messages
+
+import (
+	"errors"
+	"sync"
+	"unicode/utf8"
+)
+
+// OptionFormat is the format of an option value (RFC 7252 3.2).
+type OptionFormat int
+
+const (
+	EmptyFormat  OptionFormat = iota // Zero length value
+	OpaqueFormat                     // Bytes
+	UintFormat                       // Unsigned integer, without leading zero bytes
+	StringFormat                     // UTF-8 string
+)
+
+var (
+	ErrOptionRegistered = errors.New("Option Already Registered")
+	ErrBadOptionDef     = errors.New("Bad Option Definition")
+	ErrUnknownOption    = errors.New("Unknown Option")
+	ErrBadOptionValue   = errors.New("Bad Option Value")
+)
+
+// OptionDef describes an option number, so messages with it can be
+// validated. Whether the option is critical, unsafe to forward and part of
+// the cache key follows from its number.
+type OptionDef struct {
+	Number     uint
+	Name       string
+	Format     OptionFormat
+	MinLength  int // Shortest value, in bytes
+	MaxLength  int // Longest value, in bytes
+	Repeatable bool
+}
+
+// IsCritical checks if an option must be understood by recipients, who
+// reject messages with critical options they don't recognize (RFC 7252
+// 5.4.1).
+func IsCritical(number uint) bool {
+	return number&0x01 != 0
+}
+
+// IsUnsafe checks if a proxy that doesn't understand an option can't
+// forward it (RFC 7252 5.4.2).
+func IsUnsafe(number uint) bool {
+	return number&0x02 != 0
+}
+
+// IsNoCacheKey checks if an option is left out of the cache key of
+// requests (RFC 7252 5.4.6).
+func IsNoCacheKey(number uint) bool {
+	return number&0x1E == 0x1C
+}
+
+// Valid checks a value of the option has its format and length.
+func (d OptionDef) Valid(value []byte) bool {
+	if len(value) < d.MinLength || len(value) > d.MaxLength {
+		return false
+	}
+
+	switch d.Format {
+	case EmptyFormat:
+		return len(value) == 0
+	case UintFormat:
+		// Leading zeros are allowed but pointless, accepting them anyway
+		return len(value) <= 8
+	case StringFormat:
+		return utf8.Valid(value)
+	default:
+		return true
+	}
+}
+
+var registry = struct {
+	sync.RWMutex
+	options map[uint]OptionDef
+}{options: make(map[uint]OptionDef)}
+
+// Options of RFC 7252 5.10 and the extensions with fields in Options.
+func init() {
+	for _, def := range []OptionDef{
+		{Number: IfMatch, Name: "If-Match", Format: OpaqueFormat, MaxLength: 8, Repeatable: true},
+		{Number: URIHost, Name: "Uri-Host", Format: StringFormat, MinLength: 1, MaxLength: 255},
+		{Number: ETag, Name: "ETag", Format: OpaqueFormat, MinLength: 1, MaxLength: 8, Repeatable: true},
+		{Number: IfNoneMatch, Name: "If-None-Match", Format: EmptyFormat},
+		{Number: Observe, Name: "Observe", Format: UintFormat, MaxLength: 3},
+		{Number: URIPort, Name: "Uri-Port", Format: UintFormat, MaxLength: 2},
+		{Number: LocationPath, Name: "Location-Path", Format: StringFormat, MaxLength: 255, Repeatable: true},
+		{Number: OSCORE, Name: "OSCORE", Format: OpaqueFormat, MaxLength: 255},
+		{Number: URIPath, Name: "Uri-Path", Format: StringFormat, MaxLength: 255, Repeatable: true},
+		{Number: ContentFormat, Name: "Content-Format", Format: UintFormat, MaxLength: 2},
+		{Number: MaxAge, Name: "Max-Age", Format: UintFormat, MaxLength: 4},
+		{Number: URIQuery, Name: "Uri-Query", Format: StringFormat, MaxLength: 255, Repeatable: true},
+		{Number: Accept, Name: "Accept", Format: UintFormat, MaxLength: 2},
+		{Number: LocationQuery, Name: "Location-Query", Format: StringFormat, MaxLength: 255, Repeatable: true},
+		{Number: Block2, Name: "Block2", Format: UintFormat, MaxLength: 3},
+		{Number: Block1, Name: "Block1", Format: UintFormat, MaxLength: 3},
+		{Number: Size2, Name: "Size2", Format: UintFormat, MaxLength: 4},
+		{Number: ProxyURI, Name: "Proxy-Uri", Format: StringFormat, MinLength: 1, MaxLength: 1034},
+		{Number: ProxyScheme, Name: "Proxy-Scheme", Format: StringFormat, MinLength: 1, MaxLength: 255},
+		{Number: Size1, Name: "Size1", Format: UintFormat, MaxLength: 4},
+		{Number: NoResponse, Name: "No-Response", Format: UintFormat, MaxLength: 1},
+	} {
+		registry.options[def.Number] = def
+	}
+}
+
+// RegisterOption adds an option, so messages with it are no longer
+// rejected for an unrecognized critical option and it can be set with
+// Options.Add. Options can only be registered once.
+func RegisterOption(def OptionDef) error {
+	if def.MinLength < 0 || def.MaxLength < def.MinLength || (def.Format == EmptyFormat && def.MaxLength != 0) {
+		return ErrBadOptionDef
+	}
+
+	registry.Lock()
+	defer registry.Unlock()
+
+	if _, ok := registry.options[def.Number]; ok {
+		return ErrOptionRegistered
+	}
+	registry.options[def.Number] = def
+	return nil
+}
+
+// LookupOption returns the definition of a registered option.
+func LookupOption(number uint) (OptionDef, bool) {
+	registry.RLock()
+	defer registry.RUnlock()
+
+	def, ok := registry.options[number]
+	return def, ok
+}
+
+// Add appends an option, checking its value against the registered
+// definition. Options with a field are also set in the field, and options
+// that can't be repeated replace the one already there.
+func (o *Options) Add(number uint, value []byte) error {
+	def, ok := LookupOption(number)
+	if !ok {
+		return ErrUnknownOption
+	}
+	if !def.Valid(value) {
+		return ErrBadOptionValue
+	}
+
+	if hasField(number) {
+		if err := o.DecodeOption(number, value); err != nil {
+			return err
+		}
+	}
+
+	if !def.Repeatable {
+		raw := o.Raw[:0]
+		for _, option := range o.Raw {
+			if option.Number != number {
+				raw = append(raw, option)
+			}
+		}
+		o.Raw = raw
+	}
+	o.Raw = append(o.Raw, Option{Number: number, Value: append([]byte{}, value...)})
+	return nil
+}
+
+// Values returns the values of an option, in order.
+func (o *Options) Values(number uint) [][]byte {
+	var values [][]byte
+	for _, option := range o.List() {
+		if option.Number == number {
+			values = append(values, option.Value)
+		}
+	}
+	return values
+}
+
+// BadOptions returns the critical options of a decoded message that aren't
+// registered, have a malformed value or are repeated without being
+// repeatable. Messages with any must be rejected (RFC 7252 5.4.1), while
+// elective ones like these are ignored.
+func (o *Options) BadOptions() []uint {
+	if o == nil {
+		return nil
+	}
+
+	var bad []uint
+	seen := make(map[uint]bool)
+
+	for _, option := range o.Raw {
+		if !IsCritical(option.Number) {
+			continue
+		}
+
+		def, ok := LookupOption(option.Number)
+		repeated := seen[option.Number]
+		seen[option.Number] = true
+
+		if !ok || !def.Valid(option.Value) || (repeated && !def.Repeatable) {
+			if !containsNumber(bad, option.Number) {
+				bad = append(bad, option.Number)
+			}
+		}
+	}
+	return bad
+}
+
+func containsNumber(numbers []uint, number uint) bool {
+	for _, n := range numbers {
+		if n == number {
+			return true
+		}
+	}
+	return false
+}
+
+// CacheKey identifies a request for caches by its code and options, leaving
+// out the NoCacheKey options (RFC 7252 5.4.6).
+func (m *Message) CacheKey() (string, error) {
+	var options []Option
+	if m.Options != nil {
+		for _, option := range m.Options.List() {
+			if !IsNoCacheKey(option.Number) {
+				options = append(options, option)
+			}
+		}
+	}
+
+	b, err := encodeOptionList(options)
+	if err != nil {
+		return "", err
+	}
+	return string(append([]byte{m.Code}, b...)), nil
+}
@@ -0,0 +1,176 @@
+package messages
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+// Registers an option, allowing for tests that already did.
+func register(t *testing.T, def OptionDef) {
+	if err := RegisterOption(def); err != nil && err != ErrOptionRegistered {
+		t.Fatalf("RegisterOption() error = %v", err)
+	}
+}
+
+func TestOptionNumber(t *testing.T) {
+	tests := []struct {
+		name           string
+		number         uint
+		wantCritical   bool
+		wantUnsafe     bool
+		wantNoCacheKey bool
+	}{
+		{name: "If-Match", number: IfMatch, wantCritical: true},
+		{name: "ETag", number: ETag},
+		{name: "Max-Age", number: MaxAge, wantUnsafe: true},
+		{name: "Size2", number: Size2, wantNoCacheKey: true},
+		{name: "Proxy-Uri", number: ProxyURI, wantCritical: true, wantUnsafe: true},
+		{name: "Size1", number: Size1, wantNoCacheKey: true},
+		{name: "No-Response", number: NoResponse, wantUnsafe: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsCritical(tt.number); got != tt.wantCritical {
+				t.Errorf("IsCritical() = %v, want %v", got, tt.wantCritical)
+			}
+			if got := IsUnsafe(tt.number); got != tt.wantUnsafe {
+				t.Errorf("IsUnsafe() = %v, want %v", got, tt.wantUnsafe)
+			}
+			if got := IsNoCacheKey(tt.number); got != tt.wantNoCacheKey {
+				t.Errorf("IsNoCacheKey() = %v, want %v", got, tt.wantNoCacheKey)
+			}
+		})
+	}
+}
+
+func TestRegisterOption(t *testing.T) {
+	tests := []struct {
+		name    string
+		def     OptionDef
+		wantErr error
+	}{
+		{name: "Built In", def: OptionDef{Number: URIPath, Format: StringFormat, MaxLength: 255}, wantErr: ErrOptionRegistered},
+		{name: "Bad Lengths", def: OptionDef{Number: 3001, Format: OpaqueFormat, MinLength: 4, MaxLength: 2}, wantErr: ErrBadOptionDef},
+		{name: "Empty With Value", def: OptionDef{Number: 3003, Format: EmptyFormat, MaxLength: 1}, wantErr: ErrBadOptionDef},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := RegisterOption(tt.def); err != tt.wantErr {
+				t.Errorf("RegisterOption() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestOptions_Add(t *testing.T) {
+	register(t, OptionDef{Number: 2049, Name: "Test-Uint", Format: UintFormat, MaxLength: 2})
+	register(t, OptionDef{Number: 65000, Name: "Test-Opaque", Format: OpaqueFormat, MinLength: 1, MaxLength: 300, Repeatable: true})
+
+	m := NewMessage(Get(), WithMessageID(1), WithToken([]byte{0x01}))
+	for _, option := range []Option{
+		{Number: 65000, Value: []byte{0xAA}},
+		{Number: 2049, Value: []byte{0x01}},
+		{Number: 2049, Value: []byte{0x02}},
+		{Number: 65000, Value: bytes.Repeat([]byte{0xBB}, 300)},
+		{Number: URIPath, Value: []byte("test")},
+	} {
+		if err := m.Options.Add(option.Number, option.Value); err != nil {
+			t.Fatalf("Options.Add(%d) error = %v", option.Number, err)
+		}
+	}
+
+	if err := m.Options.Add(2051, []byte{}); err != ErrUnknownOption {
+		t.Errorf("Options.Add() unknown error = %v, want %v", err, ErrUnknownOption)
+	}
+	if err := m.Options.Add(2049, []byte{1, 2, 3}); err != ErrBadOptionValue {
+		t.Errorf("Options.Add() too long error = %v, want %v", err, ErrBadOptionValue)
+	}
+	if !reflect.DeepEqual(m.Options.URIPath, []string{"test"}) {
+		t.Errorf("Options.Add() URIPath = %v, want %v", m.Options.URIPath, []string{"test"})
+	}
+
+	if err := m.Encode(); err != nil {
+		t.Fatal(err)
+	}
+	got, err := FromBytes(m.Bytes())
+	if err != nil {
+		t.Fatalf("FromBytes() error = %v", err)
+	}
+
+	// Non repeatable options are replaced
+	if want := [][]byte{{0x02}}; !reflect.DeepEqual(got.Options.Values(2049), want) {
+		t.Errorf("Options.Values(2049) = %X, want %X", got.Options.Values(2049), want)
+	}
+	if want := [][]byte{{0xAA}, bytes.Repeat([]byte{0xBB}, 300)}; !reflect.DeepEqual(got.Options.Values(65000), want) {
+		t.Errorf("Options.Values(65000) = %X, want %X", got.Options.Values(65000), want)
+	}
+	if bad := got.Options.BadOptions(); bad != nil {
+		t.Errorf("Options.BadOptions() = %v, want none", bad)
+	}
+}
+
+func TestOptions_BadOptions(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  []Option
+		want []uint
+	}{
+		{
+			name: "Known",
+			raw:  []Option{{Number: URIHost, Value: []byte("host")}, {Number: URIPath, Value: []byte("a")}, {Number: URIPath, Value: []byte("b")}},
+		},
+		{
+			name: "Unknown Elective",
+			raw:  []Option{{Number: 2050, Value: []byte{1}}},
+		},
+		{
+			name: "Unknown Critical",
+			raw:  []Option{{Number: 2051, Value: []byte{1}}, {Number: 2051, Value: []byte{2}}},
+			want: []uint{2051},
+		},
+		{
+			name: "Too Short",
+			raw:  []Option{{Number: URIHost, Value: []byte{}}},
+			want: []uint{URIHost},
+		},
+		{
+			name: "Not Repeatable",
+			raw:  []Option{{Number: URIHost, Value: []byte("a")}, {Number: URIHost, Value: []byte("b")}},
+			want: []uint{URIHost},
+		},
+		{
+			name: "Malformed Elective",
+			raw:  []Option{{Number: MaxAge, Value: bytes.Repeat([]byte{1}, 5)}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := &Options{Raw: tt.raw}
+			if got := o.BadOptions(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Options.BadOptions() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMessage_CacheKey(t *testing.T) {
+	request := func(path string, size1 uint) *Message {
+		m := NewMessage(Get(), WithURI("coap://test.com/"+path))
+		m.Options.Size1 = size1
+		return m
+	}
+
+	key, err := request("a", 0).CacheKey()
+	if err != nil {
+		t.Fatalf("Message.CacheKey() error = %v", err)
+	}
+
+	// Size1 is a NoCacheKey option
+	if got, _ := request("a", 1024).CacheKey(); got != key {
+		t.Errorf("Message.CacheKey() = %X, want %X", got, key)
+	}
+	if got, _ := request("b", 0).CacheKey(); got == key {
+		t.Errorf("Message.CacheKey() = %X for another path", got)
+	}
+}
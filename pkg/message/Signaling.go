@@ -0,0 +1,129 @@
+package messages
+
+import (
+	"github.com/naspinall/GoAP/pkg/coding"
+)
+
+// Signaling Codes (RFC 8323 5)
+const (
+	CSM     uint8 = 225
+	Ping    uint8 = 226
+	Pong    uint8 = 227
+	Release uint8 = 228
+	Abort   uint8 = 229
+)
+
+// Signaling option numbers, their meaning depends on the signaling code
+const (
+	SignalMaxMessageSize      uint = 2 // CSM
+	SignalBlockWiseTransfer   uint = 4 // CSM
+	SignalExtendedTokenLength uint = 6 // CSM (RFC 8974)
+	SignalCustody             uint = 2 // Ping and Pong
+	SignalAlternativeAddress  uint = 2 // Release
+	SignalHoldOff             uint = 4 // Release
+	SignalBadCSMOption        uint = 2 // Abort
+)
+
+// Signal holds the options of a signaling message.
+type Signal struct {
+	MaxMessageSize      uint
+	BlockWiseTransfer   bool
+	ExtendedTokenLength uint // Longest token accepted, MaxTokenLength if zero
+	Custody             bool
+	AlternativeAddress  []string
+	HoldOff             uint
+	BadCSMOption        uint
+}
+
+// IsSignal checks if a code is a signaling code, only used with reliable
+// transports.
+func IsSignal(code uint8) bool {
+	return code>>5 == 7
+}
+
+func (s *Signal) DecodeOption(code uint8, number uint, b []byte) error {
+	switch code {
+	case CSM:
+		switch number {
+		case SignalMaxMessageSize:
+			s.MaxMessageSize = coding.DecodeUint(b)
+		case SignalBlockWiseTransfer:
+			s.BlockWiseTransfer = true
+		case SignalExtendedTokenLength:
+			s.ExtendedTokenLength = coding.DecodeUint(b)
+		}
+
+	case Ping, Pong:
+		if number == SignalCustody {
+			s.Custody = true
+		}
+
+	case Release:
+		switch number {
+		case SignalAlternativeAddress:
+			s.AlternativeAddress = append(s.AlternativeAddress, string(b))
+		case SignalHoldOff:
+			s.HoldOff = coding.DecodeUint(b)
+		}
+
+	case Abort:
+		if number == SignalBadCSMOption {
+			s.BadCSMOption = coding.DecodeUint(b)
+		}
+	}
+	return nil
+}
+
+func (s *Signal) EncodeOptions(code uint8) ([]byte, error) {
+	var total []byte
+	var previousValue uint = 0
+
+	add := func(number uint, value []byte) error {
+		b, err := EncodeSingleOption(number-previousValue, value)
+		if err != nil {
+			return err
+		}
+		previousValue = number
+		total = append(total, b...)
+		return nil
+	}
+
+	var err error
+	switch code {
+	case CSM:
+		if s.MaxMessageSize != 0 {
+			err = add(SignalMaxMessageSize, coding.EncodeUint(s.MaxMessageSize))
+		}
+		if err == nil && s.BlockWiseTransfer {
+			err = add(SignalBlockWiseTransfer, []byte{})
+		}
+		if err == nil && s.ExtendedTokenLength > MaxTokenLength {
+			err = add(SignalExtendedTokenLength, coding.EncodeUint(s.ExtendedTokenLength))
+		}
+
+	case Ping, Pong:
+		if s.Custody {
+			err = add(SignalCustody, []byte{})
+		}
+
+	case Release:
+		for _, address := range s.AlternativeAddress {
+			if err = add(SignalAlternativeAddress, []byte(address)); err != nil {
+				break
+			}
+		}
+		if err == nil && s.HoldOff != 0 {
+			err = add(SignalHoldOff, coding.EncodeUint(s.HoldOff))
+		}
+
+	case Abort:
+		if s.BadCSMOption != 0 {
+			err = add(SignalBadCSMOption, coding.EncodeUint(s.BadCSMOption))
+		}
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	return total, nil
+}
@@ -0,0 +1,179 @@
+package messages
+
+import (
+	"bytes"
+	"errors"
+	"io"
+
+	"github.com/naspinall/GoAP/pkg/coding"
+)
+
+// ErrMessageTooLarge is returned when a message is larger than the
+// receiver accepts.
+var ErrMessageTooLarge = errors.New("Message Too Large")
+
+// EncodeBody encodes the options and payload of the message, everything
+// after the header and token. Signaling messages carry signaling options
+// instead of the usual options.
+func (m *Message) EncodeBody() ([]byte, error) {
+	var body []byte
+	var err error
+
+	if IsSignal(m.Code) {
+		signal := m.Signal
+		if signal == nil {
+			signal = &Signal{}
+		}
+		body, err = signal.EncodeOptions(m.Code)
+	} else if m.Options != nil {
+		body, err = m.Options.EncodeOptions()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Payload Marker is only written when there is a payload
+	if len(m.Payload) > 0 {
+		body = append(body, 0xFF)
+		body = append(body, m.Payload...)
+	}
+
+	return body, nil
+}
+
+// EncodeTCP encodes the message with the length prefixed header used by
+// CoAP over TCP and TLS (RFC 8323 3.2).
+func (m *Message) EncodeTCP() ([]byte, error) {
+	body, err := m.EncodeBody()
+	if err != nil {
+		return nil, err
+	}
+
+	token := m.Token
+	tkl, extendedTokenLength, err := encodeTokenLength(len(token))
+	if err != nil {
+		return nil, err
+	}
+	length := len(body)
+
+	// Length and Token Length, with extended lengths for larger messages
+	var header byte
+	var extendedLength []byte
+	switch {
+	case length < 13:
+		header = byte(length) << 4
+	case length < 269:
+		header = 13 << 4
+		extendedLength = []byte{byte(length - 13)}
+	case length < 65805:
+		header = 14 << 4
+		extendedLength = coding.EncodeUint16(uint16(length - 269))
+	default:
+		header = 15 << 4
+		extendedLength = coding.EncodeUint32(uint32(length - 65805))
+	}
+	header |= tkl
+
+	// Extended token lengths follow the code (RFC 8974 2.2)
+	frame := append([]byte{header}, extendedLength...)
+	frame = append(frame, m.Code)
+	frame = append(frame, extendedTokenLength...)
+	frame = append(frame, token...)
+	return append(frame, body...), nil
+}
+
+// WriteTCP writes the message framed for CoAP over TCP and TLS.
+func (m *Message) WriteTCP(w io.Writer) error {
+	frame, err := m.EncodeTCP()
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(frame)
+	return err
+}
+
+// ReadTCP reads a message framed for CoAP over TCP and TLS, rejecting
+// messages with options and payload longer than maxSize bytes.
+func ReadTCP(r io.Reader, maxSize int) (*Message, error) {
+	header := make([]byte, 1)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+
+	length := int(header[0] >> 4)
+	tokenLength := int(header[0] & 0x0F)
+
+	// Extended lengths
+	var extended []byte
+	switch length {
+	case 13:
+		extended = make([]byte, 1)
+	case 14:
+		extended = make([]byte, 2)
+	case 15:
+		extended = make([]byte, 4)
+	}
+
+	if extended != nil {
+		if _, err := io.ReadFull(r, extended); err != nil {
+			return nil, err
+		}
+
+		switch length {
+		case 13:
+			length = int(extended[0]) + 13
+		case 14:
+			length = int(coding.DecodeUint16(extended)) + 269
+		case 15:
+			length = int(coding.DecodeUint32(extended)) + 65805
+		}
+	}
+
+	extendedSize, err := extendedTokenLengthSize(byte(tokenLength))
+	if err != nil {
+		return nil, err
+	}
+
+	if length > maxSize {
+		return nil, ErrMessageTooLarge
+	}
+
+	// Code and any extended token length
+	code := make([]byte, 1+extendedSize)
+	if _, err := io.ReadFull(r, code); err != nil {
+		return nil, err
+	}
+	tokenLength = decodeTokenLength(byte(tokenLength), code[1:])
+
+	// Token, options and payload
+	b := make([]byte, tokenLength+length)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, err
+	}
+
+	return DecodeBody(code[0], b[:tokenLength], b[tokenLength:])
+}
+
+// DecodeBody decodes a message from its code, token, options and payload,
+// for headers without a version, type or message ID.
+func DecodeBody(code uint8, token []byte, body []byte) (*Message, error) {
+	m := &Message{
+		Version: 1,
+		Code:    code,
+		buff:    bytes.NewBuffer(body),
+	}
+	if len(token) > 0 {
+		m.Token = append([]byte(nil), token...)
+	}
+
+	if err := m.DecodeOptions(); err != nil {
+		return nil, err
+	}
+	if err := m.DecodePayload(); err != nil {
+		return nil, err
+	}
+
+	m.buff.Reset()
+	return m, nil
+}
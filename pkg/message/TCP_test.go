@@ -0,0 +1,132 @@
+package messages
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestMessage_EncodeTCP(t *testing.T) {
+	tests := []struct {
+		name    string
+		message *Message
+		want    []byte
+	}{
+		{
+			name:    "Empty Request",
+			message: &Message{Code: GET, Token: []byte{0x01}},
+			want:    []byte{0x01, 0x01, 0x01},
+		},
+		{
+			name:    "Payload",
+			message: &Message{Code: Content, Token: []byte{0x01, 0x02}, Payload: []byte{0xAA, 0xBB}},
+			want:    []byte{0x32, 0x45, 0x01, 0x02, 0xFF, 0xAA, 0xBB},
+		},
+		{
+			name:    "Extended Length",
+			message: &Message{Code: Content, Payload: bytes.Repeat([]byte{0xAA}, 20)},
+			want:    append([]byte{0xD0, 0x08, 0x45, 0xFF}, bytes.Repeat([]byte{0xAA}, 20)...),
+		},
+		{
+			name:    "CSM",
+			message: &Message{Code: CSM, Signal: &Signal{MaxMessageSize: 1152, BlockWiseTransfer: true}},
+			want:    []byte{0x40, 0xE1, 0x22, 0x04, 0x80, 0x20},
+		},
+		{
+			name:    "Extended Token Length",
+			message: &Message{Code: GET, Token: bytes.Repeat([]byte{0x07}, 13)},
+			want:    append([]byte{0x0D, 0x01, 0x00}, bytes.Repeat([]byte{0x07}, 13)...),
+		},
+		{
+			name:    "CSM Extended Token Length",
+			message: &Message{Code: CSM, Signal: &Signal{MaxMessageSize: 1152, BlockWiseTransfer: true, ExtendedTokenLength: MaxExtendedTokenLength}},
+			want:    []byte{0x80, 0xE1, 0x22, 0x04, 0x80, 0x20, 0x23, 0x01, 0x01, 0x0C},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.message.EncodeTCP()
+			if err != nil {
+				t.Fatalf("Message.EncodeTCP() error = %v", err)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("Message.EncodeTCP() = %X, want %X", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadTCP(t *testing.T) {
+	tests := []struct {
+		name    string
+		message *Message
+		maxSize int
+		wantErr error
+	}{
+		{
+			name:    "No Body",
+			message: &Message{Code: GET, Token: []byte{0x42}},
+			maxSize: 1152,
+		},
+		{
+			name:    "One Byte Extended Length",
+			message: &Message{Code: Content, Token: []byte{0x42}, Payload: bytes.Repeat([]byte{1}, 100)},
+			maxSize: 1152,
+		},
+		{
+			name:    "Two Byte Extended Length",
+			message: &Message{Code: Content, Token: []byte{0x42}, Payload: bytes.Repeat([]byte{2}, 1000)},
+			maxSize: 1152,
+		},
+		{
+			name:    "Four Byte Extended Length",
+			message: &Message{Code: Content, Token: []byte{0x42}, Payload: bytes.Repeat([]byte{3}, 70000)},
+			maxSize: 1 << 20,
+		},
+		{
+			name:    "Extended Token Length",
+			message: &Message{Code: Content, Token: bytes.Repeat([]byte{0x42}, 300), Payload: []byte{5}},
+			maxSize: 1152,
+		},
+		{
+			name:    "Too Large",
+			message: &Message{Code: Content, Payload: bytes.Repeat([]byte{4}, 2000)},
+			maxSize: 1152,
+			wantErr: ErrMessageTooLarge,
+		},
+		{
+			name:    "Release",
+			message: &Message{Code: Release, Signal: &Signal{AlternativeAddress: []string{"coap+tcp://other"}, HoldOff: 30}},
+			maxSize: 1152,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := tt.message.EncodeTCP()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := ReadTCP(bytes.NewReader(b), tt.maxSize)
+			if err != tt.wantErr {
+				t.Fatalf("ReadTCP() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			if got.Code != tt.message.Code {
+				t.Errorf("ReadTCP() Code = %v, want %v", got.Code, tt.message.Code)
+			}
+			if !bytes.Equal(got.Token, tt.message.Token) {
+				t.Errorf("ReadTCP() Token = %v, want %v", got.Token, tt.message.Token)
+			}
+			if !bytes.Equal(got.Payload, tt.message.Payload) {
+				t.Errorf("ReadTCP() Payload length = %v, want %v", len(got.Payload), len(tt.message.Payload))
+			}
+			if !reflect.DeepEqual(got.Signal, tt.message.Signal) {
+				t.Errorf("ReadTCP() Signal = %+v, want %+v", got.Signal, tt.message.Signal)
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package messages
+
+import (
+	"errors"
+
+	"github.com/naspinall/GoAP/pkg/coding"
+)
+
+// Token lengths, in bytes. Tokens longer than MaxTokenLength use the
+// extended token length of RFC 8974, which only peers supporting it accept.
+const (
+	MaxTokenLength         = 8
+	MaxExtendedTokenLength = 65804
+)
+
+// ErrTokenTooLong is returned for tokens longer than MaxExtendedTokenLength,
+// or longer than a peer accepts.
+var ErrTokenTooLong = errors.New("Token Too Long")
+
+var errMalformedTokenLength = errors.New("Malformed Token Length")
+
+// IsExtendedToken checks if a token needs the extended token length of
+// RFC 8974.
+func IsExtendedToken(token []byte) bool {
+	return len(token) > MaxTokenLength
+}
+
+// Splits a token length into the 4 bit TKL field and the extended token
+// length bytes following the header (RFC 8974 2.1).
+func encodeTokenLength(length int) (byte, []byte, error) {
+	switch {
+	case length > MaxExtendedTokenLength:
+		return 0, nil, ErrTokenTooLong
+	case length < 13:
+		return byte(length), nil, nil
+	case length < 269:
+		return 13, []byte{byte(length - 13)}, nil
+	default:
+		return 14, coding.EncodeUint16(uint16(length - 269)), nil
+	}
+}
+
+// Returns how many extended token length bytes follow a TKL field.
+func extendedTokenLengthSize(tkl byte) (int, error) {
+	switch tkl {
+	case 13:
+		return 1, nil
+	case 14:
+		return 2, nil
+	case 15:
+		return 0, errMalformedTokenLength
+	default:
+		return 0, nil
+	}
+}
+
+// Returns the token length of a TKL field and its extended bytes.
+func decodeTokenLength(tkl byte, extended []byte) int {
+	switch tkl {
+	case 13:
+		return int(extended[0]) + 13
+	case 14:
+		return int(coding.DecodeUint16(extended)) + 269
+	default:
+		return int(tkl)
+	}
+}
@@ -0,0 +1,87 @@
+package messages
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// TransmissionParams control the retransmission of confirmable messages and
+// the lifetimes derived from it (RFC 7252 4.8). Clients and servers
+// exchanging messages should use the same parameters.
+type TransmissionParams struct {
+	AckTimeout      time.Duration // Shortest wait for an acknowledgement before retransmitting
+	AckRandomFactor float64       // Initial waits are up to this many ACK timeouts
+	MaxRetransmit   int           // Retransmissions before giving up
+	Nstart          int           // Outstanding interactions with an endpoint at once
+	DefaultLeisure  time.Duration // Longest delay of responses to multicast requests
+	ProbingRate     float64       // Bytes per second sent to endpoints that don't respond
+
+	MaxLatency      time.Duration // Longest time a datagram takes to arrive
+	ProcessingDelay time.Duration // Longest time before acknowledging a confirmable message
+}
+
+// DefaultTransmissionParams are the defaults of RFC 7252 4.8.
+var DefaultTransmissionParams = TransmissionParams{
+	AckTimeout:      2 * time.Second,
+	AckRandomFactor: 1.5,
+	MaxRetransmit:   4,
+	Nstart:          1,
+	DefaultLeisure:  5 * time.Second,
+	ProbingRate:     1,
+	MaxLatency:      100 * time.Second,
+	ProcessingDelay: 2 * time.Second,
+}
+
+var ErrBadTransmissionParams = errors.New("Bad Transmission Parameters")
+
+// Validate checks the parameters can be used for transmission.
+func (p TransmissionParams) Validate() error {
+	if p.AckTimeout <= 0 || p.AckRandomFactor < 1 || p.MaxRetransmit < 0 || p.Nstart < 1 ||
+		p.DefaultLeisure < 0 || p.ProbingRate <= 0 || p.MaxLatency < 0 || p.ProcessingDelay < 0 {
+		return ErrBadTransmissionParams
+	}
+	return nil
+}
+
+// MaxTransmitSpan is the longest time from the first transmission of a
+// confirmable message to its last retransmission.
+func (p TransmissionParams) MaxTransmitSpan() time.Duration {
+	return p.scaledTimeout(math.Pow(2, float64(p.MaxRetransmit)) - 1)
+}
+
+// MaxTransmitWait is the longest time from the first transmission of a
+// confirmable message to giving up on an acknowledgement.
+func (p TransmissionParams) MaxTransmitWait() time.Duration {
+	return p.scaledTimeout(math.Pow(2, float64(p.MaxRetransmit+1)) - 1)
+}
+
+// MaxRTT is the longest round trip time.
+func (p TransmissionParams) MaxRTT() time.Duration {
+	return 2*p.MaxLatency + p.ProcessingDelay
+}
+
+// ExchangeLifetime is how long after the first transmission of a
+// confirmable message its message ID can't be reused.
+func (p TransmissionParams) ExchangeLifetime() time.Duration {
+	return p.MaxTransmitSpan() + 2*p.MaxLatency + p.ProcessingDelay
+}
+
+// NonLifetime is how long after the transmission of a non-confirmable
+// message its message ID can't be reused.
+func (p TransmissionParams) NonLifetime() time.Duration {
+	return p.MaxTransmitSpan() + p.MaxLatency
+}
+
+func (p TransmissionParams) scaledTimeout(factor float64) time.Duration {
+	return time.Duration(float64(p.AckTimeout) * factor * p.AckRandomFactor)
+}
+
+// InitialTimeout picks the wait before the first retransmission at random
+// between the ACK timeout and that times the random factor, so endpoints
+// that lost messages at once don't retransmit at once.
+func (p TransmissionParams) InitialTimeout() time.Duration {
+	spread := float64(p.AckTimeout) * (p.AckRandomFactor - 1)
+	return p.AckTimeout + time.Duration(rand.Float64()*spread)
+}
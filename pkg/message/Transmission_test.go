@@ -0,0 +1,85 @@
+package messages
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTransmissionParams_Derived(t *testing.T) {
+	tests := []struct {
+		name                 string
+		params               TransmissionParams
+		wantMaxTransmitSpan  time.Duration
+		wantMaxTransmitWait  time.Duration
+		wantMaxRTT           time.Duration
+		wantExchangeLifetime time.Duration
+		wantNonLifetime      time.Duration
+	}{
+		{
+			name:                 "Defaults",
+			params:               DefaultTransmissionParams,
+			wantMaxTransmitSpan:  45 * time.Second,
+			wantMaxTransmitWait:  93 * time.Second,
+			wantMaxRTT:           202 * time.Second,
+			wantExchangeLifetime: 247 * time.Second,
+			wantNonLifetime:      145 * time.Second,
+		},
+		{
+			name: "Fast Network",
+			params: TransmissionParams{
+				AckTimeout:      time.Second,
+				AckRandomFactor: 2,
+				MaxRetransmit:   2,
+				Nstart:          1,
+				ProbingRate:     1,
+				MaxLatency:      10 * time.Second,
+				ProcessingDelay: time.Second,
+			},
+			wantMaxTransmitSpan:  6 * time.Second,
+			wantMaxTransmitWait:  14 * time.Second,
+			wantMaxRTT:           21 * time.Second,
+			wantExchangeLifetime: 27 * time.Second,
+			wantNonLifetime:      16 * time.Second,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.params.MaxTransmitSpan(); got != tt.wantMaxTransmitSpan {
+				t.Errorf("TransmissionParams.MaxTransmitSpan() = %v, want %v", got, tt.wantMaxTransmitSpan)
+			}
+			if got := tt.params.MaxTransmitWait(); got != tt.wantMaxTransmitWait {
+				t.Errorf("TransmissionParams.MaxTransmitWait() = %v, want %v", got, tt.wantMaxTransmitWait)
+			}
+			if got := tt.params.MaxRTT(); got != tt.wantMaxRTT {
+				t.Errorf("TransmissionParams.MaxRTT() = %v, want %v", got, tt.wantMaxRTT)
+			}
+			if got := tt.params.ExchangeLifetime(); got != tt.wantExchangeLifetime {
+				t.Errorf("TransmissionParams.ExchangeLifetime() = %v, want %v", got, tt.wantExchangeLifetime)
+			}
+			if got := tt.params.NonLifetime(); got != tt.wantNonLifetime {
+				t.Errorf("TransmissionParams.NonLifetime() = %v, want %v", got, tt.wantNonLifetime)
+			}
+			if err := tt.params.Validate(); err != nil {
+				t.Errorf("TransmissionParams.Validate() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestTransmissionParams_InitialTimeout(t *testing.T) {
+	params := DefaultTransmissionParams
+	min, max := params.AckTimeout, time.Duration(float64(params.AckTimeout)*params.AckRandomFactor)
+
+	spread := make(map[time.Duration]bool)
+	for i := 0; i < 100; i++ {
+		timeout := params.InitialTimeout()
+		if timeout < min || timeout > max {
+			t.Fatalf("TransmissionParams.InitialTimeout() = %v, want between %v and %v", timeout, min, max)
+		}
+		spread[timeout] = true
+	}
+
+	if len(spread) < 2 {
+		t.Errorf("TransmissionParams.InitialTimeout() always %v, want random timeouts", min)
+	}
+}
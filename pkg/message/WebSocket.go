@@ -0,0 +1,57 @@
+package messages
+
+import (
+	"errors"
+)
+
+// MaxWebSocketOverhead is the most a WebSocket message carries besides the
+// options and payload, the header, a 2 byte extended token length and the
+// longest token.
+const MaxWebSocketOverhead = 2 + 2 + MaxExtendedTokenLength
+
+// EncodeWebSocket encodes the message for CoAP over WebSockets, where each
+// WebSocket message carries one CoAP message and the length is always zero
+// (RFC 8323 4.2).
+func (m *Message) EncodeWebSocket() ([]byte, error) {
+	body, err := m.EncodeBody()
+	if err != nil {
+		return nil, err
+	}
+
+	token := m.Token
+	tkl, extended, err := encodeTokenLength(len(token))
+	if err != nil {
+		return nil, err
+	}
+
+	frame := []byte{tkl, m.Code}
+	frame = append(frame, extended...)
+	frame = append(frame, token...)
+	return append(frame, body...), nil
+}
+
+// FromWebSocket decodes a message received in a WebSocket message.
+func FromWebSocket(b []byte) (*Message, error) {
+	if len(b) < 2 {
+		return nil, errors.New("Message Too Short")
+	}
+
+	if b[0]>>4 != 0 {
+		return nil, errors.New("Malformed Length")
+	}
+
+	// Extended token lengths follow the code
+	tkl := b[0] & 0x0F
+	size, err := extendedTokenLengthSize(tkl)
+	if err != nil || len(b) < 2+size {
+		return nil, errMalformedTokenLength
+	}
+	code, tokenLength := b[1], decodeTokenLength(tkl, b[2:2+size])
+
+	b = b[2+size:]
+	if len(b) < tokenLength {
+		return nil, errMalformedTokenLength
+	}
+
+	return DecodeBody(code, b[:tokenLength], b[tokenLength:])
+}
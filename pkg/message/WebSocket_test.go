@@ -0,0 +1,74 @@
+package messages
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestMessage_EncodeWebSocket(t *testing.T) {
+	tests := []struct {
+		name    string
+		message *Message
+		want    []byte
+	}{
+		{
+			name:    "Empty Request",
+			message: &Message{Code: GET, Token: []byte{0x01}},
+			want:    []byte{0x01, 0x01, 0x01},
+		},
+		{
+			name:    "Large Payload",
+			message: &Message{Code: Content, Token: []byte{0x01, 0x02}, Payload: bytes.Repeat([]byte{0xAA}, 20)},
+			want:    append([]byte{0x02, 0x45, 0x01, 0x02, 0xFF}, bytes.Repeat([]byte{0xAA}, 20)...),
+		},
+		{
+			name:    "Ping",
+			message: &Message{Code: Ping, Token: []byte{0x07}},
+			want:    []byte{0x01, 0xE2, 0x07},
+		},
+		{
+			name:    "Extended Token Length",
+			message: &Message{Code: GET, Token: bytes.Repeat([]byte{0x07}, 14)},
+			want:    append([]byte{0x0D, 0x01, 0x01}, bytes.Repeat([]byte{0x07}, 14)...),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.message.EncodeWebSocket()
+			if err != nil {
+				t.Fatalf("Message.EncodeWebSocket() error = %v", err)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("Message.EncodeWebSocket() = %X, want %X", got, tt.want)
+			}
+
+			m, err := FromWebSocket(got)
+			if err != nil {
+				t.Fatalf("FromWebSocket() error = %v", err)
+			}
+			if m.Code != tt.message.Code || !bytes.Equal(m.Token, tt.message.Token) || !bytes.Equal(m.Payload, tt.message.Payload) {
+				t.Errorf("FromWebSocket() = %v %X %X, want %v %X %X", m.Code, m.Token, m.Payload, tt.message.Code, tt.message.Token, tt.message.Payload)
+			}
+		})
+	}
+}
+
+func TestFromWebSocket(t *testing.T) {
+	tests := []struct {
+		name string
+		b    []byte
+	}{
+		{"Too Short", []byte{0x00}},
+		{"Length Set", []byte{0x10, 0x01, 0xFF}},
+		{"Reserved Token Length", []byte{0x0F, 0x01}},
+		{"Missing Extended Token Length", []byte{0x0E, 0x01, 0x00}},
+		{"Missing Token", []byte{0x04, 0x01, 1, 2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := FromWebSocket(tt.b); err == nil {
+				t.Errorf("FromWebSocket() error = nil, want error")
+			}
+		})
+	}
+}
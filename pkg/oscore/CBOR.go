@@ -0,0 +1,43 @@
+package oscore
+
+// The few CBOR items (RFC 7049) OSCORE needs for key derivation and the
+// additional authenticated data.
+
+func cborHead(major byte, n uint64) []byte {
+	major <<= 5
+
+	switch {
+	case n < 24:
+		return []byte{major | byte(n)}
+	case n <= 0xFF:
+		return []byte{major | 24, byte(n)}
+	case n <= 0xFFFF:
+		return []byte{major | 25, byte(n >> 8), byte(n)}
+	case n <= 0xFFFFFFFF:
+		return []byte{major | 26, byte(n >> 24), byte(n >> 16), byte(n >> 8), byte(n)}
+	default:
+		return []byte{major | 27, byte(n >> 56), byte(n >> 48), byte(n >> 40), byte(n >> 32), byte(n >> 24), byte(n >> 16), byte(n >> 8), byte(n)}
+	}
+}
+
+func cborUint(n uint64) []byte {
+	return cborHead(0, n)
+}
+
+func cborBytes(b []byte) []byte {
+	return append(cborHead(2, uint64(len(b))), b...)
+}
+
+func cborText(s string) []byte {
+	return append(cborHead(3, uint64(len(s))), s...)
+}
+
+func cborArray(items ...[]byte) []byte {
+	b := cborHead(4, uint64(len(items)))
+	for _, item := range items {
+		b = append(b, item...)
+	}
+	return b
+}
+
+var cborNull = []byte{0xF6}
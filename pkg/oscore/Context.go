@@ -0,0 +1,250 @@
+package oscore
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/pion/dtls/v2/pkg/crypto/ccm"
+	"golang.org/x/crypto/hkdf"
+)
+
+const (
+	AESCCM16_64_128   = 10 // COSE algorithm, the default AEAD of OSCORE
+	KeyLength         = 16 // Bytes in a sender or recipient key
+	NonceLength       = 13 // Bytes in the nonce and common IV
+	TagLength         = 8  // Bytes of authentication tag after each ciphertext
+	MaxIDLength       = NonceLength - 6
+	MaxSequenceNumber = 1<<40 - 1 // Partial IVs are at most 5 bytes
+	ReplayWindow      = 32        // Sequence numbers remembered below the highest one received
+)
+
+var (
+	ErrIDTooLong         = errors.New("Sender or Recipient ID Too Long")
+	ErrSequenceExhausted = errors.New("Sender Sequence Number Exhausted")
+	ErrReplay            = errors.New("Replayed Message")
+)
+
+// Context is an OSCORE security context (RFC 8613 3), shared by a client and
+// a server. Each endpoint protects with its sender key and verifies with its
+// recipient key, so the sender ID of one is the recipient ID of the other.
+type Context struct {
+	senderID    []byte
+	recipientID []byte
+	idContext   []byte
+
+	sender    cipher.AEAD
+	recipient cipher.AEAD
+	commonIV  []byte
+
+	mutex    sync.Mutex
+	sequence uint64 // Sender sequence number
+
+	// Replay window of the recipient
+	received bool
+	highest  uint64
+	window   uint32 // Bit n is set when highest - n has been received
+}
+
+// NewContext derives a security context from the master secret and salt
+// with HKDF SHA-256, for AES-CCM-16-64-128. The salt and ID context may be
+// nil.
+func NewContext(masterSecret, masterSalt, senderID, recipientID, idContext []byte) (*Context, error) {
+	if len(senderID) > MaxIDLength || len(recipientID) > MaxIDLength {
+		return nil, ErrIDTooLong
+	}
+
+	c := &Context{
+		senderID:    senderID,
+		recipientID: recipientID,
+		idContext:   idContext,
+	}
+
+	senderKey, err := derive(masterSecret, masterSalt, senderID, idContext, "Key", KeyLength)
+	if err != nil {
+		return nil, err
+	}
+	recipientKey, err := derive(masterSecret, masterSalt, recipientID, idContext, "Key", KeyLength)
+	if err != nil {
+		return nil, err
+	}
+	if c.commonIV, err = derive(masterSecret, masterSalt, []byte{}, idContext, "IV", NonceLength); err != nil {
+		return nil, err
+	}
+
+	if c.sender, err = newAEAD(senderKey); err != nil {
+		return nil, err
+	}
+	if c.recipient, err = newAEAD(recipientKey); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// Derives a key or the common IV (RFC 8613 3.2.1).
+func derive(secret, salt, id, idContext []byte, kind string, length int) ([]byte, error) {
+	context := cborNull
+	if idContext != nil {
+		context = cborBytes(idContext)
+	}
+
+	info := cborArray(
+		cborBytes(id),
+		context,
+		cborUint(AESCCM16_64_128),
+		cborText(kind),
+		cborUint(uint64(length)),
+	)
+
+	b := make([]byte, length)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, secret, salt, info), b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return ccm.NewCCM(block, TagLength, NonceLength)
+}
+
+// SenderID is the ID this endpoint protects messages with.
+func (c *Context) SenderID() []byte {
+	return c.senderID
+}
+
+// RecipientID is the ID of the other endpoint.
+func (c *Context) RecipientID() []byte {
+	return c.recipientID
+}
+
+// IDContext distinguishes contexts with the same IDs, nil if unused.
+func (c *Context) IDContext() []byte {
+	return c.idContext
+}
+
+// Takes the next sender sequence number, encoded as a partial IV.
+func (c *Context) nextPartialIV() ([]byte, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.sequence > MaxSequenceNumber {
+		return nil, ErrSequenceExhausted
+	}
+
+	piv := encodePartialIV(c.sequence)
+	c.sequence++
+	return piv, nil
+}
+
+// Records a partial IV received from the other endpoint, returning false if
+// it was already received or is too old to tell.
+func (c *Context) accept(piv []byte) bool {
+	sequence := decodePartialIV(piv)
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if !c.received {
+		c.received, c.highest, c.window = true, sequence, 1
+		return true
+	}
+
+	if sequence > c.highest {
+		shift := sequence - c.highest
+		if shift >= ReplayWindow {
+			c.window = 0
+		} else {
+			c.window <<= shift
+		}
+		c.highest = sequence
+		c.window |= 1
+		return true
+	}
+
+	offset := c.highest - sequence
+	if offset >= ReplayWindow || c.window&(1<<offset) != 0 {
+		return false
+	}
+
+	c.window |= 1 << offset
+	return true
+}
+
+// Builds the AEAD nonce from the ID of the endpoint that generated the
+// partial IV (RFC 8613 5.2).
+func (c *Context) nonce(id []byte, piv []byte) []byte {
+	nonce := make([]byte, NonceLength)
+	nonce[0] = byte(len(id))
+	copy(nonce[1+MaxIDLength-len(id):1+MaxIDLength], id)
+	copy(nonce[NonceLength-len(piv):], piv)
+
+	for i := range nonce {
+		nonce[i] ^= c.commonIV[i]
+	}
+	return nonce
+}
+
+// Sequence numbers as partial IVs are big endian without leading zeroes,
+// and zero is a single zero byte.
+func encodePartialIV(sequence uint64) []byte {
+	var piv []byte
+	for ; sequence > 0; sequence >>= 8 {
+		piv = append([]byte{byte(sequence)}, piv...)
+	}
+	if len(piv) == 0 {
+		return []byte{0}
+	}
+	return piv
+}
+
+func decodePartialIV(piv []byte) uint64 {
+	var sequence uint64
+	for _, b := range piv {
+		sequence = sequence<<8 | uint64(b)
+	}
+	return sequence
+}
+
+// Contexts holds the security contexts of a server, found by the sender ID
+// and ID context each client puts in its requests.
+type Contexts struct {
+	mutex    sync.RWMutex
+	contexts map[string]*Context
+}
+
+func NewContexts(contexts ...*Context) *Contexts {
+	c := &Contexts{contexts: make(map[string]*Context)}
+	for _, context := range contexts {
+		c.Add(context)
+	}
+	return c
+}
+
+func contextKey(id []byte, idContext []byte) string {
+	return fmt.Sprintf("%x/%x", idContext, id)
+}
+
+// Add stores a context under its recipient ID and ID context.
+func (c *Contexts) Add(context *Context) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.contexts[contextKey(context.recipientID, context.idContext)] = context
+}
+
+// Lookup returns the context for a client, or nil if there isn't one.
+func (c *Contexts) Lookup(kid []byte, idContext []byte) *Context {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	return c.contexts[contextKey(kid, idContext)]
+}
@@ -0,0 +1,105 @@
+package oscore
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+func decodeHex(t *testing.T, s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// Test vectors from RFC 8613 C.1.1 and C.4
+func TestNewContext(t *testing.T) {
+	secret := decodeHex(t, "0102030405060708090a0b0c0d0e0f10")
+	salt := decodeHex(t, "9e7ca92223786340")
+
+	tests := []struct {
+		name   string
+		id     []byte
+		kind   string
+		length int
+		want   string
+	}{
+		{"Client Sender Key", []byte{}, "Key", KeyLength, "f0910ed7295e6ad4b54fc793154302ff"},
+		{"Client Recipient Key", []byte{0x01}, "Key", KeyLength, "ffb14e093c94c9cac9471648b4f98710"},
+		{"Common IV", []byte{}, "IV", NonceLength, "4622d4dd6d944168eefb54987c"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := derive(secret, salt, tt.id, nil, tt.kind, tt.length)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if hex.EncodeToString(got) != tt.want {
+				t.Errorf("derive() = %x, want %s", got, tt.want)
+			}
+		})
+	}
+
+	c, err := NewContext(secret, salt, []byte{}, []byte{0x01}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// GET /tv1 with partial IV 0x14
+	piv := []byte{0x14}
+	ciphertext := c.sender.Seal(nil, c.nonce(c.senderID, piv), decodeHex(t, "01b3747631"), additionalData(c.senderID, piv))
+	if want := decodeHex(t, "612f1092f1776f1c1668b3825e"); !bytes.Equal(ciphertext, want) {
+		t.Errorf("ciphertext = %x, want %x", ciphertext, want)
+	}
+
+	if _, err := NewContext(secret, salt, make([]byte, MaxIDLength+1), nil, nil); err != ErrIDTooLong {
+		t.Errorf("NewContext() error = %v, want %v", err, ErrIDTooLong)
+	}
+}
+
+func TestContext_accept(t *testing.T) {
+	c := &Context{}
+
+	tests := []struct {
+		sequence uint64
+		want     bool
+	}{
+		{5, true},
+		{5, false},
+		{3, true},
+		{7, true},
+		{3, false},
+		{100, true},
+		{7, false}, // Fell out of the window
+		{99, true},
+		{100 - ReplayWindow + 1, true},
+	}
+	for _, tt := range tests {
+		if got := c.accept(encodePartialIV(tt.sequence)); got != tt.want {
+			t.Errorf("Context.accept(%d) = %v, want %v", tt.sequence, got, tt.want)
+		}
+	}
+}
+
+func TestEncodePartialIV(t *testing.T) {
+	tests := []struct {
+		sequence uint64
+		want     []byte
+	}{
+		{0, []byte{0x00}},
+		{0x14, []byte{0x14}},
+		{0x0100, []byte{0x01, 0x00}},
+		{MaxSequenceNumber, []byte{0xFF, 0xFF, 0xFF, 0xFF, 0xFF}},
+	}
+	for _, tt := range tests {
+		got := encodePartialIV(tt.sequence)
+		if !bytes.Equal(got, tt.want) {
+			t.Errorf("encodePartialIV(%d) = %x, want %x", tt.sequence, got, tt.want)
+		}
+		if decodePartialIV(got) != tt.sequence {
+			t.Errorf("decodePartialIV(%x) = %d, want %d", got, decodePartialIV(got), tt.sequence)
+		}
+	}
+}
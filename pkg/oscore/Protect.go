@@ -0,0 +1,307 @@
+package oscore
+
+import (
+	"errors"
+
+	messages "github.com/naspinall/GoAP/pkg/message"
+)
+
+var (
+	ErrNotProtected     = errors.New("Message Not Protected")
+	ErrMalformedOption  = errors.New("Malformed OSCORE Option")
+	ErrUnknownContext   = errors.New("Security Context Not Found")
+	ErrDecryptionFailed = errors.New("Decryption Failed")
+)
+
+// Exchange ties a response to the request it answers. Responses are bound
+// to the sender ID and partial IV of the request.
+type Exchange struct {
+	kid []byte
+	piv []byte
+}
+
+// ProtectRequest encrypts the code, payload and end-to-end options of a
+// request into the payload of an outer POST, or FETCH for observations
+// (RFC 8613 8.1). Only the options proxies need stay outside. The returned
+// exchange is needed to unprotect the response.
+func (c *Context) ProtectRequest(m *messages.Message) (*messages.Message, *Exchange, error) {
+	piv, err := c.nextPartialIV()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	outer, plaintext, err := split(m, true)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	outer.Options.OSCORE = encodeOption(piv, c.senderID, true, c.idContext)
+	outer.Payload = c.sender.Seal(nil, c.nonce(c.senderID, piv), plaintext, additionalData(c.senderID, piv))
+
+	return outer, &Exchange{kid: c.senderID, piv: piv}, nil
+}
+
+// UnprotectRequest verifies and decrypts a protected request, rejecting
+// replays (RFC 8613 8.2).
+func (c *Context) UnprotectRequest(m *messages.Message) (*messages.Message, *Exchange, error) {
+	if m.Options == nil || m.Options.OSCORE == nil {
+		return nil, nil, ErrNotProtected
+	}
+
+	piv, kid, _, hasKid, err := decodeOption(m.Options.OSCORE)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !hasKid || len(piv) == 0 {
+		return nil, nil, ErrMalformedOption
+	}
+	if string(kid) != string(c.recipientID) {
+		return nil, nil, ErrUnknownContext
+	}
+
+	plaintext, err := c.recipient.Open(nil, c.nonce(kid, piv), m.Payload, additionalData(kid, piv))
+	if err != nil {
+		return nil, nil, ErrDecryptionFailed
+	}
+
+	// Only authentic messages move the replay window
+	if !c.accept(piv) {
+		return nil, nil, ErrReplay
+	}
+
+	inner, err := join(m, plaintext, true)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return inner, &Exchange{kid: kid, piv: piv}, nil
+}
+
+// ProtectResponse encrypts a response to the request of the exchange. The
+// nonce of the request is reused, except for notifications which each get
+// a partial IV of their own (RFC 8613 8.3).
+func (c *Context) ProtectResponse(m *messages.Message, exchange *Exchange) (*messages.Message, error) {
+	outer, plaintext, err := split(m, false)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := c.nonce(exchange.kid, exchange.piv)
+	outer.Options.OSCORE = []byte{}
+
+	if m.Options != nil && m.Options.Observe != nil {
+		piv, err := c.nextPartialIV()
+		if err != nil {
+			return nil, err
+		}
+
+		nonce = c.nonce(c.senderID, piv)
+		outer.Options.OSCORE = encodeOption(piv, nil, false, nil)
+	}
+
+	outer.Payload = c.sender.Seal(nil, nonce, plaintext, additionalData(exchange.kid, exchange.piv))
+	return outer, nil
+}
+
+// UnprotectResponse verifies and decrypts a response to the request of the
+// exchange (RFC 8613 8.4).
+func (c *Context) UnprotectResponse(m *messages.Message, exchange *Exchange) (*messages.Message, error) {
+	if m.Options == nil || m.Options.OSCORE == nil {
+		return nil, ErrNotProtected
+	}
+
+	piv, _, _, _, err := decodeOption(m.Options.OSCORE)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := c.nonce(exchange.kid, exchange.piv)
+	if len(piv) > 0 {
+		nonce = c.nonce(c.recipientID, piv)
+	}
+
+	plaintext, err := c.recipient.Open(nil, nonce, m.Payload, additionalData(exchange.kid, exchange.piv))
+	if err != nil {
+		return nil, ErrDecryptionFailed
+	}
+
+	if len(piv) > 0 && !c.accept(piv) {
+		return nil, ErrReplay
+	}
+
+	return join(m, plaintext, false)
+}
+
+// UnprotectRequest finds the context for a protected request and
+// unprotects it with that context.
+func (c *Contexts) UnprotectRequest(m *messages.Message) (*messages.Message, *Context, *Exchange, error) {
+	if m.Options == nil || m.Options.OSCORE == nil {
+		return nil, nil, nil, ErrNotProtected
+	}
+
+	_, kid, idContext, hasKid, err := decodeOption(m.Options.OSCORE)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if !hasKid {
+		return nil, nil, nil, ErrMalformedOption
+	}
+
+	context := c.Lookup(kid, idContext)
+	if context == nil {
+		return nil, nil, nil, ErrUnknownContext
+	}
+
+	inner, exchange, err := context.UnprotectRequest(m)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return inner, context, exchange, nil
+}
+
+// Splits a message into the outer message proxies see and the plaintext of
+// its code, end-to-end options and payload.
+func split(m *messages.Message, request bool) (*messages.Message, []byte, error) {
+	options := &messages.Options{}
+	if m.Options != nil {
+		options = m.Options
+	}
+
+	// Options for proxies stay outside, the rest are encrypted
+	inner := *options
+	inner.URIHost, inner.URIPort, inner.ProxyURI, inner.ProxyScheme, inner.OSCORE = nil, 0, nil, nil, nil
+
+	outerOptions := &messages.Options{
+		URIHost:     options.URIHost,
+		URIPort:     options.URIPort,
+		ProxyURI:    options.ProxyURI,
+		ProxyScheme: options.ProxyScheme,
+		Observe:     options.Observe,
+	}
+
+	var code uint8
+	switch {
+	case request && options.Observe != nil:
+		code = messages.FETCH
+	case request:
+		code = messages.POST
+	case options.Observe != nil:
+		code = messages.Content
+		inner.Observe = nil
+	default:
+		code = messages.Changed
+	}
+
+	body, err := (&messages.Message{Code: m.Code, Options: &inner, Payload: m.Payload}).EncodeBody()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	outer := messages.NewMessage(messages.WithType(m.Type), messages.WithMessageID(m.MessageID), messages.WithToken(m.Token))
+	outer.Code = code
+	outer.Options = outerOptions
+
+	return outer, append([]byte{m.Code}, body...), nil
+}
+
+// Rebuilds a message from its outer message and decrypted plaintext.
+func join(outer *messages.Message, plaintext []byte, request bool) (*messages.Message, error) {
+	if len(plaintext) == 0 {
+		return nil, ErrDecryptionFailed
+	}
+
+	m, err := messages.DecodeBody(plaintext[0], nil, plaintext[1:])
+	if err != nil {
+		return nil, err
+	}
+
+	m.Type, m.MessageID, m.Token = outer.Type, outer.MessageID, outer.Token
+	m.Options.URIHost, m.Options.URIPort = outer.Options.URIHost, outer.Options.URIPort
+	m.Options.ProxyURI, m.Options.ProxyScheme = outer.Options.ProxyURI, outer.Options.ProxyScheme
+
+	// Notifications carry their sequence number outside
+	if !request {
+		m.Options.Observe = outer.Options.Observe
+	}
+
+	return m, nil
+}
+
+// Additional authenticated data, binding every message of an exchange to
+// the request (RFC 8613 5.4).
+func additionalData(kid []byte, piv []byte) []byte {
+	external := cborArray(
+		cborUint(1),
+		cborArray(cborUint(AESCCM16_64_128)),
+		cborBytes(kid),
+		cborBytes(piv),
+		cborBytes(nil),
+	)
+
+	return cborArray(
+		cborText("Encrypt0"),
+		cborBytes(nil),
+		cborBytes(external),
+	)
+}
+
+// Encodes the OSCORE option value (RFC 8613 6.1). Requests carry the
+// partial IV and sender ID, responses usually nothing at all.
+func encodeOption(piv []byte, kid []byte, includeKid bool, kidContext []byte) []byte {
+	flags := byte(len(piv))
+	if kidContext != nil {
+		flags |= 0x10
+	}
+	if includeKid {
+		flags |= 0x08
+	}
+
+	if flags == 0 {
+		return []byte{}
+	}
+
+	b := append([]byte{flags}, piv...)
+	if kidContext != nil {
+		b = append(b, byte(len(kidContext)))
+		b = append(b, kidContext...)
+	}
+	if includeKid {
+		b = append(b, kid...)
+	}
+	return b
+}
+
+func decodeOption(b []byte) (piv, kid, kidContext []byte, hasKid bool, err error) {
+	if len(b) == 0 {
+		return
+	}
+
+	flags := b[0]
+	n := int(flags & 0x07)
+	if flags&0xE0 != 0 || n > 5 {
+		err = ErrMalformedOption
+		return
+	}
+
+	b = b[1:]
+	if len(b) < n {
+		err = ErrMalformedOption
+		return
+	}
+	piv, b = b[:n], b[n:]
+
+	if flags&0x10 != 0 {
+		if len(b) == 0 || len(b) < 1+int(b[0]) {
+			err = ErrMalformedOption
+			return
+		}
+		kidContext, b = b[1:1+int(b[0])], b[1+int(b[0]):]
+	}
+
+	if flags&0x08 != 0 {
+		kid, hasKid = b, true
+	} else if len(b) > 0 {
+		err = ErrMalformedOption
+	}
+	return
+}
@@ -0,0 +1,218 @@
+package oscore
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	messages "github.com/naspinall/GoAP/pkg/message"
+)
+
+// Creates the contexts of a client and a server sharing a master secret.
+func contexts(t *testing.T) (*Context, *Context) {
+	secret := []byte("0123456789abcdef")
+
+	client, err := NewContext(secret, nil, []byte{0x01}, []byte{0x02}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err := NewContext(secret, nil, []byte{0x02}, []byte{0x01}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client, server
+}
+
+func TestContext_ProtectRequest(t *testing.T) {
+	client, server := contexts(t)
+
+	request := messages.NewMessage(messages.Get(), messages.WithMessageID(7), messages.WithToken([]byte{0x42}), messages.WithURI("coap://example.com/secret/thing"))
+	request.Payload = []byte("query")
+
+	protected, exchange, err := client.ProtectRequest(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if protected.Code != messages.POST {
+		t.Errorf("outer Code = %v, want %v", protected.Code, messages.POST)
+	}
+	if protected.Options.URIPath != nil || *protected.Options.URIHost != "example.com" {
+		t.Errorf("outer options = %+v, want only the host", protected.Options)
+	}
+	if bytes.Contains(protected.Payload, []byte("secret")) || bytes.Contains(protected.Payload, []byte("query")) {
+		t.Errorf("outer payload %x isn't encrypted", protected.Payload)
+	}
+
+	// Protected messages survive encoding
+	if err := protected.Encode(); err != nil {
+		t.Fatal(err)
+	}
+	received, err := messages.FromBytes(protected.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	inner, serverExchange, err := server.UnprotectRequest(received)
+	if err != nil {
+		t.Fatalf("Context.UnprotectRequest() error = %v", err)
+	}
+	if inner.Code != messages.GET || !bytes.Equal(inner.Token, []byte{0x42}) || inner.MessageID != 7 || string(inner.Payload) != "query" {
+		t.Errorf("Context.UnprotectRequest() = %v %x %v %q", inner.Code, inner.Token, inner.MessageID, inner.Payload)
+	}
+	if !reflect.DeepEqual(inner.Options.URIPath, []string{"secret", "thing"}) {
+		t.Errorf("Context.UnprotectRequest() URIPath = %v", inner.Options.URIPath)
+	}
+
+	// Replays are rejected
+	if _, _, err := server.UnprotectRequest(received); err != ErrReplay {
+		t.Errorf("Context.UnprotectRequest() replay error = %v, want %v", err, ErrReplay)
+	}
+
+	response := messages.NewMessage(messages.WithType(messages.Acknowledgement), messages.WithMessageID(7), messages.WithToken([]byte{0x42}), messages.WithPayload([]byte("42")))
+	response.Code = messages.Content
+
+	protectedResponse, err := server.ProtectResponse(response, serverExchange)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if protectedResponse.Code != messages.Changed || len(protectedResponse.Options.OSCORE) != 0 {
+		t.Errorf("outer response = %v %x, want %v with an empty option", protectedResponse.Code, protectedResponse.Options.OSCORE, messages.Changed)
+	}
+
+	got, err := client.UnprotectResponse(protectedResponse, exchange)
+	if err != nil {
+		t.Fatalf("Context.UnprotectResponse() error = %v", err)
+	}
+	if got.Code != messages.Content || string(got.Payload) != "42" || got.Type != messages.Acknowledgement {
+		t.Errorf("Context.UnprotectResponse() = %v %q %v", got.Code, got.Payload, got.Type)
+	}
+
+	// Responses are bound to their request
+	_, other, err := client.ProtectRequest(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.UnprotectResponse(protectedResponse, other); err != ErrDecryptionFailed {
+		t.Errorf("Context.UnprotectResponse() other request error = %v, want %v", err, ErrDecryptionFailed)
+	}
+}
+
+func TestContext_ProtectResponse(t *testing.T) {
+	client, server := contexts(t)
+
+	request := messages.NewMessage(messages.Get(), messages.WithToken([]byte{0x42}), messages.WithURI("coap://example.com/temperature"), messages.WithObserve(messages.ObserveRegister))
+	protected, exchange, err := client.ProtectRequest(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if protected.Code != messages.FETCH || protected.Options.Observe == nil {
+		t.Errorf("outer request = %v %v, want %v with Observe", protected.Code, protected.Options.Observe, messages.FETCH)
+	}
+
+	_, serverExchange, err := server.UnprotectRequest(protected)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Every notification has its own partial IV
+	var pivs [][]byte
+	for sequence := uint(1); sequence <= 3; sequence++ {
+		notification := messages.NewMessage(messages.WithToken([]byte{0x42}), messages.WithObserve(sequence), messages.WithPayload([]byte{byte(sequence)}))
+		notification.Code = messages.Content
+
+		protected, err := server.ProtectResponse(notification, serverExchange)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pivs = append(pivs, protected.Options.OSCORE)
+
+		got, err := client.UnprotectResponse(protected, exchange)
+		if err != nil {
+			t.Fatalf("Context.UnprotectResponse() error = %v", err)
+		}
+		if *got.Options.Observe != sequence || got.Payload[0] != byte(sequence) {
+			t.Errorf("Context.UnprotectResponse() = %v %x, want %v", *got.Options.Observe, got.Payload, sequence)
+		}
+
+		if _, err := client.UnprotectResponse(protected, exchange); err != ErrReplay {
+			t.Errorf("Context.UnprotectResponse() replay error = %v, want %v", err, ErrReplay)
+		}
+	}
+
+	if bytes.Equal(pivs[0], pivs[1]) || len(pivs[0]) == 0 {
+		t.Errorf("notification options = %x, want distinct partial IVs", pivs)
+	}
+}
+
+func TestContexts_UnprotectRequest(t *testing.T) {
+	client, server := contexts(t)
+	stranger, err := NewContext([]byte("fedcba9876543210"), nil, []byte{0x03}, []byte{0x02}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	contexts := NewContexts(server)
+
+	request := messages.NewMessage(messages.Get(), messages.WithURI("coap://example.com/a"))
+	protected, _, err := client.ProtectRequest(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, context, _, err := contexts.UnprotectRequest(protected); err != nil || context != server {
+		t.Errorf("Contexts.UnprotectRequest() = %v, %v, want the server context", context, err)
+	}
+
+	protected, _, err = stranger.ProtectRequest(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err := contexts.UnprotectRequest(protected); err != ErrUnknownContext {
+		t.Errorf("Contexts.UnprotectRequest() error = %v, want %v", err, ErrUnknownContext)
+	}
+
+	if _, _, _, err := contexts.UnprotectRequest(request); err != ErrNotProtected {
+		t.Errorf("Contexts.UnprotectRequest() error = %v, want %v", err, ErrNotProtected)
+	}
+}
+
+func TestDecodeOption(t *testing.T) {
+	tests := []struct {
+		name           string
+		value          []byte
+		wantPIV        []byte
+		wantKID        []byte
+		wantKIDContext []byte
+		wantErr        bool
+	}{
+		{name: "Empty", value: []byte{}},
+		{name: "Request", value: []byte{0x09, 0x14}, wantPIV: []byte{0x14}, wantKID: []byte{}},
+		{name: "ID Context", value: []byte{0x19, 0x05, 0x02, 0xAA, 0xBB, 0x01}, wantPIV: []byte{0x05}, wantKID: []byte{0x01}, wantKIDContext: []byte{0xAA, 0xBB}},
+		{name: "Notification", value: []byte{0x02, 0x01, 0x00}, wantPIV: []byte{0x01, 0x00}},
+		{name: "Reserved Flags", value: []byte{0x80}, wantErr: true},
+		{name: "Partial IV Too Long", value: []byte{0x06, 1, 2, 3, 4, 5, 6}, wantErr: true},
+		{name: "Truncated", value: []byte{0x03, 0x01}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			piv, kid, kidContext, _, err := decodeOption(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("decodeOption() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if !bytes.Equal(piv, tt.wantPIV) || !bytes.Equal(kid, tt.wantKID) || !bytes.Equal(kidContext, tt.wantKIDContext) {
+				t.Errorf("decodeOption() = %x %x %x, want %x %x %x", piv, kid, kidContext, tt.wantPIV, tt.wantKID, tt.wantKIDContext)
+			}
+
+			// Round trip
+			if tt.wantKID != nil || tt.wantKIDContext != nil {
+				if got := encodeOption(piv, kid, tt.wantKID != nil, kidContext); !bytes.Equal(got, tt.value) {
+					t.Errorf("encodeOption() = %x, want %x", got, tt.value)
+				}
+			}
+		})
+	}
+}
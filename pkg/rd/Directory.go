@@ -0,0 +1,455 @@
+// Package rd implements a Resource Directory (RFC 9176), where endpoints
+// register links to their resources for clients to look up.
+package rd
+
+import (
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/naspinall/GoAP/pkg/link"
+	messages "github.com/naspinall/GoAP/pkg/message"
+	"github.com/naspinall/GoAP/pkg/server"
+)
+
+// Paths of the directory's interfaces
+const (
+	DirectoryPath      = "/rd"
+	EndpointLookupPath = "/rd-lookup/ep"
+	ResourceLookupPath = "/rd-lookup/res"
+	RegistrationPath   = "/reg" // Registration resources are created below it
+)
+
+// Resource types of the directory's interfaces, for discovery
+const (
+	DirectoryType      = "core.rd"
+	EndpointLookupType = "core.rd-lookup-ep"
+	ResourceLookupType = "core.rd-lookup-res"
+)
+
+// Registration parameters (RFC 9176 9.3)
+const (
+	EndpointParameter = "ep"
+	SectorParameter   = "d"
+	LifetimeParameter = "lt"
+	BaseParameter     = "base"
+	TypeParameter     = "et"
+	PageParameter     = "page"
+	CountParameter    = "count"
+	AnchorAttribute   = "anchor"
+)
+
+const MaxLifetime = 1<<32 - 1 // Longest lifetime in seconds
+
+// DefaultRegistrationLifetime is how long the directory keeps a registration
+// that isn't updated, for registrations without a lifetime (RFC 9176 5.3).
+const DefaultRegistrationLifetime = 90000 * time.Second
+
+// Registration is an endpoint registered with the directory.
+type Registration struct {
+	Location string // Path of the registration resource
+	Endpoint string
+	Sector   string
+	Type     string
+	Base     string // URI the links of the endpoint are relative to
+	Lifetime time.Duration
+	Links    link.Links
+
+	expires time.Time
+}
+
+// Link to the registration resource, with the endpoint's attributes, as in
+// endpoint lookups.
+func (r *Registration) link() *link.Link {
+	l := link.New(r.Location, link.Attribute{Name: EndpointParameter, Value: r.Endpoint})
+	if r.Sector != "" {
+		l.Attributes = append(l.Attributes, link.Attribute{Name: SectorParameter, Value: r.Sector})
+	}
+	l.Attributes = append(l.Attributes, link.Attribute{Name: BaseParameter, Value: r.Base})
+	if r.Type != "" {
+		l.Attributes = append(l.Attributes, link.Attribute{Name: TypeParameter, Value: r.Type})
+	}
+	l.Attributes = append(l.Attributes, link.Attribute{Name: LifetimeParameter, Value: strconv.FormatInt(int64(r.Lifetime/time.Second), 10)})
+	return l
+}
+
+// Links of the endpoint with targets resolved against its base, anchored
+// at the base, as in resource lookups.
+func (r *Registration) resources() link.Links {
+	base, err := url.Parse(r.Base)
+	if err != nil {
+		return link.Links{}
+	}
+
+	resources := make(link.Links, 0, len(r.Links))
+	for _, l := range r.Links {
+		target, err := url.Parse(l.Target)
+		if err != nil {
+			continue
+		}
+
+		attributes := append([]link.Attribute{}, l.Attributes...)
+		if _, ok := l.Get(AnchorAttribute); !ok {
+			attributes = append(attributes, link.Attribute{Name: AnchorAttribute, Value: r.Base})
+		}
+		resources = append(resources, link.New(base.ResolveReference(target).String(), attributes...))
+	}
+	return resources
+}
+
+// Directory is a handler serving the registration and lookup interfaces of
+// a Resource Directory. Requests for other paths go to Handler.
+type Directory struct {
+	Handler server.Handler // Serves other paths, replying 4.04 Not Found if nil
+
+	mutex         sync.Mutex
+	registrations map[string]*Registration // By location
+	next          uint64
+	now           func() time.Time
+}
+
+func NewDirectory() *Directory {
+	return &Directory{
+		registrations: make(map[string]*Registration),
+		now:           time.Now,
+	}
+}
+
+// Links describes the directory's interfaces for /.well-known/core.
+func (d *Directory) Links() link.Links {
+	return link.Links{
+		link.New(DirectoryPath, link.ResourceType(DirectoryType), link.ContentFormat(messages.LinkFormat)),
+		link.New(EndpointLookupPath, link.ResourceType(EndpointLookupType)),
+		link.New(ResourceLookupPath, link.ResourceType(ResourceLookupType)),
+	}
+}
+
+// Registrations returns the registrations that haven't expired, ordered by
+// location.
+func (d *Directory) Registrations() []*Registration {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	return d.sorted()
+}
+
+// Endpoints returns the links to the registrations matching the queries
+// (RFC 9176 7). Queries on the attributes of resources match endpoints
+// with a matching resource.
+func (d *Directory) Endpoints(queries ...string) link.Links {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	endpoints := link.Links{}
+	for _, registration := range d.sorted() {
+		l, resources := registration.link(), registration.resources()
+		if matchesAll(queries, l, resources) {
+			endpoints = append(endpoints, l)
+		}
+	}
+	return endpoints
+}
+
+// Resources returns the links of registered endpoints matching the queries
+// (RFC 9176 7). Queries on the attributes of endpoints match every resource
+// of matching endpoints.
+func (d *Directory) Resources(queries ...string) link.Links {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	resources := link.Links{}
+	for _, registration := range d.sorted() {
+		endpoint := registration.link()
+		for _, resource := range registration.resources() {
+			if matchesAll(queries, resource, link.Links{endpoint}) {
+				resources = append(resources, resource)
+			}
+		}
+	}
+	return resources
+}
+
+// Reports if l, or one of the other links, matches each query.
+func matchesAll(queries []string, l *link.Link, others link.Links) bool {
+	for _, query := range queries {
+		if l.Matches(query) {
+			continue
+		}
+		if len(others.Filter(query)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Removes expired registrations, returning the rest by location.
+func (d *Directory) sorted() []*Registration {
+	now := d.now()
+
+	registrations := make([]*Registration, 0, len(d.registrations))
+	for location, registration := range d.registrations {
+		if now.After(registration.expires) {
+			delete(d.registrations, location)
+			continue
+		}
+		registrations = append(registrations, registration)
+	}
+
+	sort.Slice(registrations, func(i, j int) bool {
+		return registrations[i].Location < registrations[j].Location
+	})
+	return registrations
+}
+
+func (d *Directory) ServeCOAP(w server.ResponseWriter, r *server.Request) {
+	path := "/" + r.Path()
+
+	switch {
+	case path == DirectoryPath:
+		if r.Code != messages.POST {
+			w.WriteCode(messages.MethodNotAllowed)
+			return
+		}
+		d.register(w, r)
+
+	case path == EndpointLookupPath || path == ResourceLookupPath:
+		if r.Code != messages.GET {
+			w.WriteCode(messages.MethodNotAllowed)
+			return
+		}
+		d.lookup(w, r, path == EndpointLookupPath)
+
+	case strings.HasPrefix(path, RegistrationPath+"/"):
+		d.serveRegistration(w, r, path)
+
+	case path == link.WellKnownCore && r.Code == messages.GET:
+		links := d.Links()
+		if linker, ok := d.Handler.(interface{ Links() link.Links }); ok {
+			links = append(links, linker.Links()...)
+		}
+		w.Options().SetContentFormat(messages.LinkFormat)
+		w.Write(links.Filter(r.Options.URIQuery...).Bytes())
+
+	case d.Handler != nil:
+		d.Handler.ServeCOAP(w, r)
+
+	default:
+		server.NotFound(w, r)
+	}
+}
+
+// Registers an endpoint, or replaces its registration if it already has
+// one (RFC 9176 5.3).
+func (d *Directory) register(w server.ResponseWriter, r *server.Request) {
+	parameters := queryParameters(r.Options.URIQuery)
+
+	endpoint := parameters[EndpointParameter]
+	if endpoint == "" {
+		badRequest(w, "Endpoint name required")
+		return
+	}
+
+	links, ok := parseLinks(w, r)
+	if !ok {
+		return
+	}
+
+	lifetime, ok := parseLifetime(w, parameters, DefaultRegistrationLifetime)
+	if !ok {
+		return
+	}
+
+	base := parameters[BaseParameter]
+	if base == "" {
+		base = "coap://" + r.RemoteAddr.String()
+	}
+
+	registration := &Registration{
+		Endpoint: endpoint,
+		Sector:   parameters[SectorParameter],
+		Type:     parameters[TypeParameter],
+		Base:     base,
+		Lifetime: lifetime,
+		Links:    links,
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	// Endpoints are identified by their name and sector
+	for _, existing := range d.sorted() {
+		if existing.Endpoint == registration.Endpoint && existing.Sector == registration.Sector {
+			registration.Location = existing.Location
+		}
+	}
+	if registration.Location == "" {
+		d.next++
+		registration.Location = RegistrationPath + "/" + strconv.FormatUint(d.next, 10)
+	}
+
+	registration.expires = d.now().Add(lifetime)
+	d.registrations[registration.Location] = registration
+
+	w.Options().LocationPath = strings.Split(strings.TrimPrefix(registration.Location, "/"), "/")
+	w.WriteCode(messages.Created)
+}
+
+// Serves a registration resource, which endpoints update and remove, and
+// anyone can read (RFC 9176 5.3).
+func (d *Directory) serveRegistration(w server.ResponseWriter, r *server.Request, location string) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.sorted()
+
+	registration, ok := d.registrations[location]
+	if !ok {
+		server.NotFound(w, r)
+		return
+	}
+
+	switch r.Code {
+	case messages.GET:
+		w.Options().SetContentFormat(messages.LinkFormat)
+		w.Write(registration.Links.Filter(r.Options.URIQuery...).Bytes())
+
+	case messages.POST:
+		// Updating with any new parameters and links, and restarting the
+		// lifetime
+		parameters := queryParameters(r.Options.URIQuery)
+
+		links, ok := parseLinks(w, r)
+		if !ok {
+			return
+		}
+		lifetime, ok := parseLifetime(w, parameters, registration.Lifetime)
+		if !ok {
+			return
+		}
+
+		updated := *registration
+		updated.Lifetime, updated.expires = lifetime, d.now().Add(lifetime)
+		if base := parameters[BaseParameter]; base != "" {
+			updated.Base = base
+		}
+		if len(r.Payload) > 0 {
+			updated.Links = links
+		}
+		d.registrations[location] = &updated
+
+		w.WriteCode(messages.Changed)
+
+	case messages.DELETE:
+		delete(d.registrations, location)
+		w.WriteCode(messages.Deleted)
+
+	default:
+		w.WriteCode(messages.MethodNotAllowed)
+	}
+}
+
+// Serves endpoint and resource lookups, paged with the page and count
+// parameters.
+func (d *Directory) lookup(w server.ResponseWriter, r *server.Request, endpoints bool) {
+	var queries []string
+	var page, count int
+	for _, query := range r.Options.URIQuery {
+		name, value := splitQuery(query)
+
+		var err error
+		switch name {
+		case PageParameter:
+			page, err = strconv.Atoi(value)
+		case CountParameter:
+			count, err = strconv.Atoi(value)
+		default:
+			queries = append(queries, query)
+		}
+		if err != nil || page < 0 || count < 0 {
+			badRequest(w, "Bad "+name)
+			return
+		}
+	}
+
+	var links link.Links
+	if endpoints {
+		links = d.Endpoints(queries...)
+	} else {
+		links = d.Resources(queries...)
+	}
+
+	if count > 0 {
+		start := page * count
+		if start > len(links) {
+			start = len(links)
+		}
+		end := start + count
+		if end > len(links) {
+			end = len(links)
+		}
+		links = links[start:end]
+	}
+
+	w.Options().SetContentFormat(messages.LinkFormat)
+	w.Write(links.Bytes())
+}
+
+func splitQuery(query string) (string, string) {
+	if i := strings.IndexByte(query, '='); i >= 0 {
+		return query[:i], query[i+1:]
+	}
+	return query, ""
+}
+
+func queryParameters(queries []string) map[string]string {
+	parameters := make(map[string]string)
+	for _, query := range queries {
+		name, value := splitQuery(query)
+		parameters[name] = value
+	}
+	return parameters
+}
+
+// Reads the links in a request payload, replying with an error if they
+// can't be read.
+func parseLinks(w server.ResponseWriter, r *server.Request) (link.Links, bool) {
+	if len(r.Payload) == 0 {
+		return link.Links{}, true
+	}
+
+	if r.Options.ContentFormat == nil || *r.Options.ContentFormat != messages.LinkFormat {
+		w.WriteCode(messages.UnsupportedContent)
+		return nil, false
+	}
+
+	links, err := link.Parse(r.Payload)
+	if err != nil {
+		badRequest(w, err.Error())
+		return nil, false
+	}
+	return links, true
+}
+
+// Reads the lifetime parameter in seconds, replying with an error if it is
+// out of range.
+func parseLifetime(w server.ResponseWriter, parameters map[string]string, lifetime time.Duration) (time.Duration, bool) {
+	value, ok := parameters[LifetimeParameter]
+	if !ok {
+		return lifetime, true
+	}
+
+	seconds, err := strconv.ParseUint(value, 10, 32)
+	if err != nil || seconds == 0 || seconds > MaxLifetime {
+		badRequest(w, "Bad lifetime")
+		return 0, false
+	}
+	return time.Duration(seconds) * time.Second, true
+}
+
+func badRequest(w server.ResponseWriter, diagnostic string) {
+	w.WriteCode(messages.Bad)
+	w.Write([]byte(diagnostic))
+}
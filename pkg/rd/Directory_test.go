@@ -0,0 +1,213 @@
+package rd
+
+import (
+	"net"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/naspinall/GoAP/pkg/client"
+	"github.com/naspinall/GoAP/pkg/link"
+	messages "github.com/naspinall/GoAP/pkg/message"
+	"github.com/naspinall/GoAP/pkg/server"
+)
+
+// Serves the directory over UDP, returning a client connected to it.
+func directoryServer(t *testing.T, d *Directory) (*server.Server, *client.Client) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &server.Server{Handler: d}
+	go s.Serve(conn)
+
+	c, err := client.NewClient("127.0.0.1", conn.LocalAddr().(*net.UDPAddr).Port)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, c
+}
+
+func targets(links link.Links) []string {
+	got := []string{}
+	for _, l := range links {
+		got = append(got, l.Target)
+	}
+	return got
+}
+
+func TestDirectory_Lookup(t *testing.T) {
+	d := NewDirectory()
+	s, c := directoryServer(t, d)
+	defer s.Close()
+	defer c.Close()
+
+	sensor := &client.Registration{
+		Endpoint: "sensor",
+		Sector:   "building",
+		Base:     "coap://[2001:db8::1]:5683",
+		Links: link.Links{
+			link.New("/temp", link.ResourceType("temperature-c"), link.Observable()),
+			link.New("/light", link.ResourceType("light-lux")),
+		},
+	}
+	if err := c.Register("coap://127.0.0.1/rd", sensor); err != nil {
+		t.Fatal(err)
+	}
+	defer sensor.Close()
+
+	actuator := &client.Registration{
+		Endpoint: "actuator",
+		Base:     "coap://[2001:db8::2]",
+		Links:    link.Links{link.New("/led", link.Interface("core.a"))},
+	}
+	if err := c.Register("coap://127.0.0.1/rd", actuator); err != nil {
+		t.Fatal(err)
+	}
+	defer actuator.Close()
+
+	if got, want := sensor.Location(), "coap://127.0.0.1/reg/1"; got != want {
+		t.Errorf("Registration.Location() = %v, want %v", got, want)
+	}
+
+	tests := []struct {
+		name    string
+		path    string
+		queries []string
+		want    []string
+	}{
+		{
+			name: "Every Endpoint",
+			path: EndpointLookupPath,
+			want: []string{"/reg/1", "/reg/2"},
+		},
+		{
+			name:    "Endpoint By Name",
+			path:    EndpointLookupPath,
+			queries: []string{"ep=actuator"},
+			want:    []string{"/reg/2"},
+		},
+		{
+			name:    "Endpoint By Resource",
+			path:    EndpointLookupPath,
+			queries: []string{"rt=temperature-c"},
+			want:    []string{"/reg/1"},
+		},
+		{
+			name:    "Resource By Type",
+			path:    ResourceLookupPath,
+			queries: []string{"rt=light*"},
+			want:    []string{"coap://[2001:db8::1]:5683/light"},
+		},
+		{
+			name:    "Resource By Sector",
+			path:    ResourceLookupPath,
+			queries: []string{"d=building"},
+			want:    []string{"coap://[2001:db8::1]:5683/temp", "coap://[2001:db8::1]:5683/light"},
+		},
+		{
+			name:    "Resource Page",
+			path:    ResourceLookupPath,
+			queries: []string{"page=1", "count=2"},
+			want:    []string{"coap://[2001:db8::2]/led"},
+		},
+		{
+			name:    "No Match",
+			path:    ResourceLookupPath,
+			queries: []string{"if=core.s"},
+			want:    []string{},
+		},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := messages.NewMessage(messages.Get(), messages.WithMessageID(uint16(i+1)), messages.WithToken([]byte{byte(i + 1)}), messages.WithURI("coap://127.0.0.1"+tt.path))
+			m.Options.URIQuery = tt.queries
+
+			response, err := c.Do(m)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if response.Code != messages.Content || response.Options.ContentFormat == nil || *response.Options.ContentFormat != messages.LinkFormat {
+				t.Fatalf("lookup code = %v, format = %v", response.Code, response.Options.ContentFormat)
+			}
+
+			links, err := link.Parse(response.Payload)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := targets(links); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("lookup = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDirectory_Registration(t *testing.T) {
+	d := NewDirectory()
+	var clock atomic.Value
+	clock.Store(time.Now())
+	d.now = func() time.Time { return clock.Load().(time.Time) }
+	advance := func(duration time.Duration) { clock.Store(d.now().Add(duration)) }
+
+	s, c := directoryServer(t, d)
+	defer s.Close()
+	defer c.Close()
+
+	r := &client.Registration{
+		Endpoint: "node",
+		Lifetime: time.Minute,
+		Links:    link.Links{link.New("/temp")},
+	}
+	if err := c.Register("coap://127.0.0.1/rd", r); err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	registrations := d.Registrations()
+	if len(registrations) != 1 || registrations[0].Lifetime != time.Minute {
+		t.Fatalf("Directory.Registrations() = %v, want one with a minute lifetime", registrations)
+	}
+
+	// Registering the endpoint again replaces the registration
+	again := &client.Registration{Endpoint: "node", Links: link.Links{link.New("/light")}}
+	if err := c.Register("coap://127.0.0.1/rd", again); err != nil {
+		t.Fatal(err)
+	}
+	if again.Location() != r.Location() {
+		t.Errorf("Registration.Location() = %v, want %v", again.Location(), r.Location())
+	}
+	if got := targets(d.Registrations()[0].Links); !reflect.DeepEqual(got, []string{"/light"}) {
+		t.Errorf("Registration.Links = %v, want [/light]", got)
+	}
+
+	// Updates restart the lifetime
+	advance(time.Minute)
+	if err := r.Update(); err != nil {
+		t.Fatal(err)
+	}
+	advance(DefaultRegistrationLifetime - time.Second)
+	if len(d.Registrations()) != 1 {
+		t.Fatalf("Directory.Registrations() = %v, want registration updated", d.Registrations())
+	}
+
+	// Expired registrations are removed, and made again by updates
+	advance(2 * time.Second)
+	if len(d.Registrations()) != 0 {
+		t.Fatalf("Directory.Registrations() = %v, want registration expired", d.Registrations())
+	}
+	if err := r.Update(); err != nil {
+		t.Fatal(err)
+	}
+	if len(d.Registrations()) != 1 {
+		t.Fatalf("Directory.Registrations() = %v, want registration made again", d.Registrations())
+	}
+
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if len(d.Registrations()) != 0 {
+		t.Errorf("Directory.Registrations() = %v, want registration removed", d.Registrations())
+	}
+}
@@ -0,0 +1,137 @@
+package security
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"math/big"
+	"time"
+
+	"github.com/pion/dtls/v2"
+)
+
+var (
+	ErrUnknownIdentity = errors.New("Unknown PSK Identity")
+	ErrUnknownPeer     = errors.New("Unknown Peer Public Key")
+)
+
+// PSKConfig configures a client for the pre-shared key mode (RFC 7252
+// 9.1.3.1), sending identity to the server.
+func PSKConfig(identity []byte, key []byte) *dtls.Config {
+	return &dtls.Config{
+		PSK: func(hint []byte) ([]byte, error) {
+			return key, nil
+		},
+		PSKIdentityHint:      identity,
+		CipherSuites:         []dtls.CipherSuiteID{dtls.TLS_PSK_WITH_AES_128_CCM_8},
+		ExtendedMasterSecret: dtls.RequireExtendedMasterSecret,
+	}
+}
+
+// ServerPSKConfig configures a server for the pre-shared key mode, looking
+// up the key for the identity sent by each client.
+func ServerPSKConfig(keys map[string][]byte) *dtls.Config {
+	return &dtls.Config{
+		PSK: func(identity []byte) ([]byte, error) {
+			key, ok := keys[string(identity)]
+			if !ok {
+				return nil, ErrUnknownIdentity
+			}
+			return key, nil
+		},
+		CipherSuites:         []dtls.CipherSuiteID{dtls.TLS_PSK_WITH_AES_128_CCM_8},
+		ExtendedMasterSecret: dtls.RequireExtendedMasterSecret,
+	}
+}
+
+// CertificateConfig configures the certificate mode (RFC 7252 9.1.3.3),
+// presenting certificate and verifying the peer against roots. Servers
+// require clients to present a certificate too.
+func CertificateConfig(certificate tls.Certificate, roots *x509.CertPool) *dtls.Config {
+	return &dtls.Config{
+		Certificates:         []tls.Certificate{certificate},
+		RootCAs:              roots,
+		ClientCAs:            roots,
+		ClientAuth:           dtls.RequireAndVerifyClientCert,
+		ExtendedMasterSecret: dtls.RequireExtendedMasterSecret,
+	}
+}
+
+// PinnedKeyConfig configures the certificate mode with pinned public keys,
+// identifying with key in a self-signed certificate and accepting only
+// peers whose certificate carries one of the given public keys. Chains and
+// names aren't verified.
+//
+// This is not the raw public key mode of RFC 7252 9.1.3.2, which the DTLS
+// library can't negotiate (RFC 7250). Peers expecting raw public keys
+// won't connect, both ends have to send certificates.
+func PinnedKeyConfig(key crypto.Signer, peers ...crypto.PublicKey) (*dtls.Config, error) {
+	certificate, err := selfSigned(key)
+	if err != nil {
+		return nil, err
+	}
+
+	// Comparing keys in their encoded form
+	trusted := make([][]byte, len(peers))
+	for i, peer := range peers {
+		if trusted[i], err = x509.MarshalPKIXPublicKey(peer); err != nil {
+			return nil, err
+		}
+	}
+
+	return &dtls.Config{
+		Certificates:         []tls.Certificate{certificate},
+		InsecureSkipVerify:   true,
+		ClientAuth:           dtls.RequireAnyClientCert,
+		ExtendedMasterSecret: dtls.RequireExtendedMasterSecret,
+		VerifyPeerCertificate: func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+			if len(rawCerts) == 0 {
+				return ErrUnknownPeer
+			}
+
+			certificate, err := x509.ParseCertificate(rawCerts[0])
+			if err != nil {
+				return err
+			}
+
+			public, err := x509.MarshalPKIXPublicKey(certificate.PublicKey)
+			if err != nil {
+				return err
+			}
+
+			for _, key := range trusted {
+				if bytes.Equal(public, key) {
+					return nil
+				}
+			}
+			return ErrUnknownPeer
+		},
+	}, nil
+}
+
+// Wraps a key in a certificate carrying nothing but the public key.
+func selfSigned(key crypto.Signer) (tls.Certificate, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 64))
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().AddDate(100, 0, 0),
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	return tls.Certificate{
+		Certificate: [][]byte{der},
+		PrivateKey:  key,
+	}, nil
+}
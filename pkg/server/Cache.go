@@ -0,0 +1,122 @@
+package server
+
+import (
+	"container/list"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	messages "github.com/naspinall/GoAP/pkg/message"
+)
+
+const DefaultMaxExchanges = 4096 // Exchanges remembered for deduplication
+
+// exchange is a request the server has seen, with its response once the
+// handler has finished.
+type exchange struct {
+	key      string
+	expires  time.Time
+	response []byte
+}
+
+// exchangeCache remembers recent requests by endpoint and message ID, so
+// retransmitted requests get the same response without running the handler
+// again (RFC 7252 4.5).
+type exchangeCache struct {
+	mutex     sync.Mutex
+	capacity  int
+	exchanges map[string]*list.Element
+	order     *list.List // Oldest exchange first
+	now       func() time.Time
+}
+
+func newExchangeCache(capacity int) *exchangeCache {
+	if capacity <= 0 {
+		capacity = DefaultMaxExchanges
+	}
+	return &exchangeCache{
+		capacity:  capacity,
+		exchanges: make(map[string]*list.Element),
+		order:     list.New(),
+		now:       time.Now,
+	}
+}
+
+func exchangeKey(addr net.Addr, messageID uint16) string {
+	return fmt.Sprintf("%s/%d", addr.String(), messageID)
+}
+
+// Lifetime of an exchange, after which the message ID can be reused.
+func exchangeLifetime(params messages.TransmissionParams, messageType messages.MessageType) time.Duration {
+	if messageType == messages.NonConfirmable {
+		return params.NonLifetime()
+	}
+	return params.ExchangeLifetime()
+}
+
+// Start records a new exchange. If the exchange is a duplicate it returns
+// false, along with the cached response if the handler has finished.
+func (c *exchangeCache) Start(key string, lifetime time.Duration) (bool, []byte) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	now := c.now()
+	c.expire(now)
+
+	if element, ok := c.exchanges[key]; ok {
+		e := element.Value.(*exchange)
+		if !now.After(e.expires) {
+			return false, e.response
+		}
+
+		// Message ID is being reused
+		c.remove(element)
+	}
+
+	// Making room by dropping the oldest exchange
+	if c.order.Len() >= c.capacity {
+		c.remove(c.order.Front())
+	}
+
+	c.exchanges[key] = c.order.PushBack(&exchange{
+		key:     key,
+		expires: now.Add(lifetime),
+	})
+
+	return true, nil
+}
+
+// Complete stores the response for an exchange.
+func (c *exchangeCache) Complete(key string, response []byte) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if element, ok := c.exchanges[key]; ok {
+		element.Value.(*exchange).response = response
+	}
+}
+
+// Len returns the number of remembered exchanges.
+func (c *exchangeCache) Len() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.order.Len()
+}
+
+// Removes expired exchanges from the front of the queue. Lifetimes differ
+// by message type, so a few expired exchanges can stay behind a longer
+// lived one until it expires or they are looked up.
+func (c *exchangeCache) expire(now time.Time) {
+	for element := c.order.Front(); element != nil; element = c.order.Front() {
+		if !now.After(element.Value.(*exchange).expires) {
+			return
+		}
+		c.remove(element)
+	}
+}
+
+func (c *exchangeCache) remove(element *list.Element) {
+	c.order.Remove(element)
+	delete(c.exchanges, element.Value.(*exchange).key)
+}
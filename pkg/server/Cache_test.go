@@ -0,0 +1,109 @@
+package server
+
+import (
+	"bytes"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	messages "github.com/naspinall/GoAP/pkg/message"
+)
+
+func TestExchangeCache(t *testing.T) {
+	now := time.Now()
+	c := newExchangeCache(2)
+	c.now = func() time.Time { return now }
+
+	if ok, _ := c.Start("a", time.Minute); !ok {
+		t.Fatal("exchangeCache.Start() new exchange is a duplicate")
+	}
+
+	// Duplicate before the handler finished
+	if ok, response := c.Start("a", time.Minute); ok || response != nil {
+		t.Errorf("exchangeCache.Start() = %v, %v, want false, nil", ok, response)
+	}
+
+	// Duplicate after the handler finished
+	c.Complete("a", []byte{1})
+	if ok, response := c.Start("a", time.Minute); ok || !bytes.Equal(response, []byte{1}) {
+		t.Errorf("exchangeCache.Start() = %v, %v, want false, [1]", ok, response)
+	}
+
+	// Evicting the oldest exchange when full
+	c.Start("b", time.Minute)
+	c.Start("c", time.Minute)
+	if got := c.Len(); got != 2 {
+		t.Errorf("exchangeCache.Len() = %v, want 2", got)
+	}
+	if ok, _ := c.Start("a", time.Minute); !ok {
+		t.Errorf("exchangeCache.Start() evicted exchange is a duplicate")
+	}
+
+	// Expiring exchanges after their lifetime
+	now = now.Add(2 * time.Minute)
+	if ok, _ := c.Start("c", time.Minute); !ok {
+		t.Errorf("exchangeCache.Start() expired exchange is a duplicate")
+	}
+	if got := c.Len(); got != 1 {
+		t.Errorf("exchangeCache.Len() after expiry = %v, want 1", got)
+	}
+}
+
+func TestServer_Duplicates(t *testing.T) {
+	var calls int32
+	mux := NewServeMux()
+	mux.HandleFunc("/counter", func(w ResponseWriter, r *Request) {
+		w.Write([]byte{byte(atomic.AddInt32(&calls, 1))})
+	})
+
+	s, peer := testServer(t, mux)
+	defer s.Close()
+	defer peer.Close()
+
+	tests := []struct {
+		name        string
+		request     *messages.Message
+		wantPayload []byte
+	}{
+		{
+			name:        "First Request",
+			request:     messages.NewMessage(messages.Post(), messages.WithMessageID(1), messages.WithToken([]byte{1}), messages.WithURI("coap://localhost/counter")),
+			wantPayload: []byte{1},
+		},
+		{
+			name:        "Retransmission",
+			request:     messages.NewMessage(messages.Post(), messages.WithMessageID(1), messages.WithToken([]byte{1}), messages.WithURI("coap://localhost/counter")),
+			wantPayload: []byte{1},
+		},
+		{
+			name:        "New Request",
+			request:     messages.NewMessage(messages.Post(), messages.WithMessageID(2), messages.WithToken([]byte{2}), messages.WithURI("coap://localhost/counter")),
+			wantPayload: []byte{2},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reply := roundTrip(t, peer, tt.request)
+			if !bytes.Equal(reply.Payload, tt.wantPayload) {
+				t.Errorf("Reply Payload = %v, want %v", reply.Payload, tt.wantPayload)
+			}
+		})
+	}
+
+	if got := atomic.LoadInt32(&calls); got != 2 {
+		t.Errorf("Handler calls = %v, want 2", got)
+	}
+
+	// Duplicate non-confirmable requests are ignored
+	request := messages.NewMessage(messages.Post(), messages.WithType(messages.NonConfirmable), messages.WithMessageID(3), messages.WithToken([]byte{3}), messages.WithURI("coap://localhost/counter"))
+	roundTrip(t, peer, request)
+	request.Write(peer)
+
+	peer.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	if _, err := peer.Read(make([]byte, messages.MaxMessageSize)); err == nil {
+		t.Errorf("Duplicate non-confirmable request got a response")
+	} else if err, ok := err.(net.Error); !ok || !err.Timeout() {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,129 @@
+package server
+
+import (
+	"errors"
+	"net"
+
+	messages "github.com/naspinall/GoAP/pkg/message"
+	"github.com/pion/dtls/v2"
+	"github.com/pion/transport/v2/udp"
+)
+
+const DefaultDTLSAddr = ":5684"
+
+// ListenAndServeDTLS listens for coaps requests on the server address,
+// securing them with DTLS 1.2.
+func (s *Server) ListenAndServeDTLS(config *dtls.Config) error {
+	addr := s.Addr
+	if addr == "" {
+		addr = DefaultDTLSAddr
+	}
+
+	udpAddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return err
+	}
+
+	l, err := dtls.Listen("udp", udpAddr, config)
+	if err != nil {
+		return err
+	}
+
+	return s.ServeDTLS(l)
+}
+
+// ServeDTLS accepts DTLS sessions on a listener from dtls.Listen, serving
+// the requests of each like Serve. ServeDTLS always returns a non-nil error
+// and closes l.
+func (s *Server) ServeDTLS(l net.Listener) error {
+	s.mutex.Lock()
+	if s.closed {
+		s.mutex.Unlock()
+		l.Close()
+		return ErrServerClosed
+	}
+	if s.listeners == nil {
+		s.listeners = make(map[net.Listener]bool)
+	}
+	s.listeners[l] = true
+	if s.exchanges == nil {
+		s.exchanges = newExchangeCache(s.MaxExchanges)
+	}
+	s.mutex.Unlock()
+
+	defer l.Close()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if s.isClosed() {
+				return ErrServerClosed
+			}
+
+			if errors.Is(err, udp.ErrClosedListener) {
+				return err
+			}
+
+			// Failed handshakes only end their own session
+			continue
+		}
+
+		go s.serveSession(conn)
+	}
+}
+
+// Serves the requests of a single DTLS session until it is closed.
+func (s *Server) serveSession(conn net.Conn) {
+	s.mutex.Lock()
+	if s.closed {
+		s.mutex.Unlock()
+		conn.Close()
+		return
+	}
+	if s.sessions == nil {
+		s.sessions = make(map[net.Conn]bool)
+	}
+	s.sessions[conn] = true
+	s.mutex.Unlock()
+
+	defer func() {
+		conn.Close()
+
+		s.mutex.Lock()
+		delete(s.sessions, conn)
+		s.mutex.Unlock()
+	}()
+
+	packetConn := sessionConn{conn}
+
+	for {
+		b := make([]byte, messages.MaxMessageSize)
+		n, err := conn.Read(b)
+		if err != nil {
+			return
+		}
+
+		m, err := messages.FromBytes(b[:n])
+		if err != nil {
+			// Dropping malformed messages
+			continue
+		}
+
+		s.handleMessage(packetConn, conn.RemoteAddr(), m, false)
+	}
+}
+
+// sessionConn lets a DTLS session be used like the packet connection of
+// Serve, with every datagram to and from the peer of the session.
+type sessionConn struct {
+	net.Conn
+}
+
+func (c sessionConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	n, err := c.Read(b)
+	return n, c.RemoteAddr(), err
+}
+
+func (c sessionConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	return c.Write(b)
+}
@@ -0,0 +1,127 @@
+package server
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/naspinall/GoAP/pkg/client"
+	messages "github.com/naspinall/GoAP/pkg/message"
+	"github.com/naspinall/GoAP/pkg/security"
+	"github.com/pion/dtls/v2"
+)
+
+// Starts a coaps server, returning its port.
+func dtlsServer(t *testing.T, handler Handler, config *dtls.Config) (*Server, int) {
+	l, err := dtls.Listen("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)}, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &Server{Handler: handler}
+	go s.ServeDTLS(l)
+
+	return s, l.Addr().(*net.UDPAddr).Port
+}
+
+func generateKey(t *testing.T) *ecdsa.PrivateKey {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestServer_ServeDTLS(t *testing.T) {
+	serverKey, clientKey, otherKey := generateKey(t), generateKey(t), generateKey(t)
+
+	pinnedServer, err := security.PinnedKeyConfig(serverKey, clientKey.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	pinnedClient, err := security.PinnedKeyConfig(clientKey, serverKey.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	pinnedUnknown, err := security.PinnedKeyConfig(otherKey, serverKey.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pskServer := security.ServerPSKConfig(map[string][]byte{
+		"client": []byte("secret"),
+	})
+
+	tests := []struct {
+		name    string
+		server  *dtls.Config
+		client  *dtls.Config
+		wantErr bool
+	}{
+		{
+			name:   "Pre-Shared Key",
+			server: pskServer,
+			client: security.PSKConfig([]byte("client"), []byte("secret")),
+		},
+		{
+			name:    "Wrong Pre-Shared Key",
+			server:  pskServer,
+			client:  security.PSKConfig([]byte("client"), []byte("guess")),
+			wantErr: true,
+		},
+		{
+			name:    "Unknown Identity",
+			server:  pskServer,
+			client:  security.PSKConfig([]byte("stranger"), []byte("secret")),
+			wantErr: true,
+		},
+		{
+			name:   "Pinned Public Key",
+			server: pinnedServer,
+			client: pinnedClient,
+		},
+		{
+			name:    "Unknown Public Key",
+			server:  pinnedServer,
+			client:  pinnedUnknown,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mux := NewServeMux()
+			mux.HandleFunc("/hello", func(w ResponseWriter, r *Request) {
+				w.Write([]byte("world"))
+			})
+
+			s, port := dtlsServer(t, mux, tt.server)
+			defer s.Close()
+
+			// Failed handshakes aren't always answered with an alert
+			tt.client.ConnectContextMaker = func() (context.Context, func()) {
+				return context.WithTimeout(context.Background(), time.Second)
+			}
+
+			c, err := client.NewDTLSClient("127.0.0.1", port, tt.client)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewDTLSClient() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			defer c.Close()
+
+			m, err := c.Get("coaps://127.0.0.1/hello")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if m.Code != messages.Content || string(m.Payload) != "world" {
+				t.Errorf("Get() = %v %q, want %v %q", m.Code, m.Payload, messages.Content, "world")
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package server
+
+import (
+	"net"
+
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// ListenAndServeGroup joins the multicast group on the interface, or one
+// chosen by the system if ifi is nil, and serves requests sent to it. The
+// group address has a port, such as "224.0.1.187:5683".
+func (s *Server) ListenAndServeGroup(ifi *net.Interface, group string) error {
+	addr, err := net.ResolveUDPAddr("udp", group)
+	if err != nil {
+		return err
+	}
+
+	conn, err := net.ListenMulticastUDP("udp", ifi, addr)
+	if err != nil {
+		return err
+	}
+
+	return s.ServeGroup(conn)
+}
+
+// ServeGroup serves requests from a connection that joined multicast groups.
+// Requests sent to a group are marked as multicast, and only get a response
+// after a random delay of up to the server's leisure.
+func (s *Server) ServeGroup(conn *net.UDPConn) error {
+	if local, ok := conn.LocalAddr().(*net.UDPAddr); ok && local.IP.To4() == nil {
+		return s.serveGroup6(conn)
+	}
+	return s.serveGroup4(conn)
+}
+
+func (s *Server) serveGroup4(conn *net.UDPConn) error {
+	p := ipv4.NewPacketConn(conn)
+	if err := p.SetControlMessage(ipv4.FlagDst, true); err != nil {
+		conn.Close()
+		return err
+	}
+
+	return s.servePackets(conn, func(b []byte) (int, net.Addr, bool, error) {
+		n, cm, addr, err := p.ReadFrom(b)
+		return n, addr, cm != nil && cm.Dst.IsMulticast(), err
+	})
+}
+
+func (s *Server) serveGroup6(conn *net.UDPConn) error {
+	p := ipv6.NewPacketConn(conn)
+	if err := p.SetControlMessage(ipv6.FlagDst, true); err != nil {
+		conn.Close()
+		return err
+	}
+
+	return s.servePackets(conn, func(b []byte) (int, net.Addr, bool, error) {
+		n, cm, addr, err := p.ReadFrom(b)
+		return n, addr, cm != nil && cm.Dst.IsMulticast(), err
+	})
+}
@@ -0,0 +1,104 @@
+package server
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/naspinall/GoAP/pkg/client"
+	messages "github.com/naspinall/GoAP/pkg/message"
+)
+
+// Finds an interface multicast datagrams can be sent and received on.
+func multicastInterface(t *testing.T) *net.Interface {
+	ifis, err := net.Interfaces()
+	if err != nil {
+		t.Skip(err)
+	}
+	for i := range ifis {
+		if ifis[i].Flags&net.FlagUp != 0 && ifis[i].Flags&net.FlagMulticast != 0 {
+			return &ifis[i]
+		}
+	}
+	t.Skip("No multicast interface")
+	return nil
+}
+
+func TestServer_ServeGroup(t *testing.T) {
+	ifi := multicastInterface(t)
+
+	conn, err := net.ListenMulticastUDP("udp4", ifi, &net.UDPAddr{IP: net.ParseIP(client.AllCoAPNodesIPv4)})
+	if err != nil {
+		t.Skip(err)
+	}
+	port := conn.LocalAddr().(*net.UDPAddr).Port
+
+	mux := NewServeMux()
+	mux.HandleFunc("/hello", func(w ResponseWriter, r *Request) {
+		if !r.Multicast {
+			w.WriteCode(messages.Bad)
+			return
+		}
+		w.Write([]byte("hello"))
+	})
+
+	s := &Server{Handler: mux, Leisure: 50 * time.Millisecond}
+	defer s.Close()
+	go s.ServeGroup(conn)
+
+	noResponse := func(bits uint) *uint { return &bits }
+
+	tests := []struct {
+		name       string
+		path       string
+		noResponse *uint
+		wantCodes  []uint8
+	}{
+		{
+			name:      "Response",
+			path:      "/hello",
+			wantCodes: []uint8{messages.Content},
+		},
+		{
+			name: "Error Suppressed",
+			path: "/missing",
+		},
+		{
+			name:       "Error Wanted",
+			path:       "/missing",
+			noResponse: noResponse(0),
+			wantCodes:  []uint8{messages.NotFound},
+		},
+		{
+			name:       "Success Suppressed",
+			path:       "/hello",
+			noResponse: noResponse(messages.NoResponseSuccess),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, err := client.NewGroup(client.AllCoAPNodesIPv4, port)
+			if err != nil {
+				t.Fatal(err)
+			}
+			g.Interface = ifi
+
+			m := messages.NewMessage(messages.Get(), messages.WithToken([]byte{byte(len(tt.name))}), messages.WithURI("coap://"+client.AllCoAPNodesIPv4+tt.path))
+			m.Options.NoResponse = tt.noResponse
+
+			responses, err := g.Do(m, 500*time.Millisecond)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(responses) != len(tt.wantCodes) {
+				t.Fatalf("Group.Do() got %d responses, want %d", len(responses), len(tt.wantCodes))
+			}
+			for i, response := range responses {
+				if response.Code != tt.wantCodes[i] {
+					t.Errorf("Group.Do() code = %v, want %v", response.Code, tt.wantCodes[i])
+				}
+			}
+		})
+	}
+}
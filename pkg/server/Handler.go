@@ -0,0 +1,123 @@
+package server
+
+import (
+	"bytes"
+	"net"
+	"strings"
+
+	messages "github.com/naspinall/GoAP/pkg/message"
+	"github.com/naspinall/GoAP/pkg/oscore"
+	"github.com/naspinall/GoAP/pkg/stream"
+)
+
+// Handler responds to a CoAP request.
+type Handler interface {
+	ServeCOAP(w ResponseWriter, r *Request)
+}
+
+// HandlerFunc allows ordinary functions to be used as handlers.
+type HandlerFunc func(w ResponseWriter, r *Request)
+
+func (f HandlerFunc) ServeCOAP(w ResponseWriter, r *Request) {
+	f(w, r)
+}
+
+// Request is a message received by the server.
+type Request struct {
+	*messages.Message
+	RemoteAddr net.Addr
+	Multicast  bool // Sent to a multicast group the server joined
+
+	conn   net.PacketConn
+	stream stream.Conn
+	server *Server
+
+	// Set for requests protected with OSCORE
+	security *oscore.Context
+	exchange *oscore.Exchange
+}
+
+// Path of the requested resource without a leading slash.
+func (r *Request) Path() string {
+	return strings.Join(r.Options.URIPath, "/")
+}
+
+// ResponseWriter builds the response to a request, which is sent once the
+// handler returns.
+type ResponseWriter interface {
+	// Options of the response
+	Options() *messages.Options
+
+	// Sets the response code, 2.05 Content if never called
+	WriteCode(code uint8)
+
+	// Appends to the response payload
+	Write(b []byte) (int, error)
+}
+
+type response struct {
+	code    uint8
+	options *messages.Options
+	payload bytes.Buffer
+
+	// Protects the response to an OSCORE request
+	security *oscore.Context
+	exchange *oscore.Exchange
+
+	// Rejects a non-confirmable request with a reset instead
+	reset bool
+}
+
+func newResponse() *response {
+	return &response{
+		code:    messages.Content,
+		options: messages.NewMessage().Options,
+	}
+}
+
+func (w *response) Options() *messages.Options {
+	return w.options
+}
+
+func (w *response) WriteCode(code uint8) {
+	w.code = code
+}
+
+func (w *response) Write(b []byte) (int, error) {
+	return w.payload.Write(b)
+}
+
+// Creates the response message for a request, piggybacked on the
+// acknowledgement for confirmable requests.
+func (w *response) message(request *messages.Message) *messages.Message {
+	m := messages.NewMessage(messages.WithToken(request.Token), messages.WithPayload(w.payload.Bytes()))
+	m.Code = w.code
+	m.Options = w.options
+
+	if request.Type == messages.Confirmable {
+		m.SetType(messages.Acknowledgement).SetMessageID(request.MessageID)
+	} else {
+		m.SetType(messages.NonConfirmable).SetMessageID(nextMessageID())
+	}
+
+	if w.security == nil {
+		return m
+	}
+
+	protected, err := w.security.ProtectResponse(m, w.exchange)
+	if err != nil {
+		m.Code, m.Options, m.Payload = messages.InternalServerError, messages.NewMessage().Options, nil
+		return m
+	}
+	return protected
+}
+
+// NotFound replies with 4.04 Not Found.
+func NotFound(w ResponseWriter, r *Request) {
+	w.WriteCode(messages.NotFound)
+}
+
+// NotFoundHandler returns a handler replying with 4.04 Not Found.
+func NotFoundHandler() Handler {
+	return HandlerFunc(NotFound)
+}
@@ -0,0 +1,186 @@
+package server
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/naspinall/GoAP/pkg/link"
+	messages "github.com/naspinall/GoAP/pkg/message"
+)
+
+// ServeMux routes requests on their URI-Path, then on their method. Unless
+// a handler is registered for it, /.well-known/core lists the links to the
+// registered paths (RFC 6690).
+type ServeMux struct {
+	mutex  sync.RWMutex
+	routes map[string]*route
+}
+
+type route struct {
+	methods    map[uint8]Handler
+	any        Handler
+	attributes []link.Attribute
+}
+
+// Describer is implemented by handlers with attributes for their link in
+// /.well-known/core, like observable resources.
+type Describer interface {
+	Attributes() []link.Attribute
+}
+
+// Routes only described have no handlers.
+func (r *route) empty() bool {
+	return r.any == nil && len(r.methods) == 0
+}
+
+// The handler of GET requests can describe the resource.
+func (r *route) describer() (Describer, bool) {
+	if handler, ok := r.methods[messages.GET]; ok {
+		describer, ok := handler.(Describer)
+		return describer, ok
+	}
+	describer, ok := r.any.(Describer)
+	return describer, ok
+}
+
+func NewServeMux() *ServeMux {
+	return &ServeMux{
+		routes: make(map[string]*route),
+	}
+}
+
+// DefaultServeMux is used by servers without a handler.
+var DefaultServeMux = NewServeMux()
+
+func cleanPath(path string) string {
+	return strings.Trim(path, "/")
+}
+
+func (mux *ServeMux) route(path string) *route {
+	path = cleanPath(path)
+
+	r, ok := mux.routes[path]
+	if !ok {
+		r = &route{methods: make(map[uint8]Handler)}
+		mux.routes[path] = r
+	}
+	return r
+}
+
+// Handle registers the handler for every method on path.
+func (mux *ServeMux) Handle(path string, handler Handler) {
+	mux.mutex.Lock()
+	defer mux.mutex.Unlock()
+
+	mux.route(path).any = handler
+}
+
+// HandleFunc registers the handler function for every method on path.
+func (mux *ServeMux) HandleFunc(path string, handler func(ResponseWriter, *Request)) {
+	mux.Handle(path, HandlerFunc(handler))
+}
+
+// HandleMethod registers the handler for a single method on path, taking
+// precedence over handlers for every method.
+func (mux *ServeMux) HandleMethod(method uint8, path string, handler Handler) {
+	mux.mutex.Lock()
+	defer mux.mutex.Unlock()
+
+	mux.route(path).methods[method] = handler
+}
+
+// Handler returns the handler for the request, replying with 4.04 Not Found
+// for unknown paths and 4.05 Method Not Allowed for unknown methods.
+func (mux *ServeMux) Handler(r *Request) Handler {
+	mux.mutex.RLock()
+	defer mux.mutex.RUnlock()
+
+	route, ok := mux.routes[r.Path()]
+	if !ok || route.empty() {
+		if r.Path() == cleanPath(link.WellKnownCore) {
+			return HandlerFunc(mux.serveLinks)
+		}
+		return NotFoundHandler()
+	}
+
+	if handler, ok := route.methods[r.Code]; ok {
+		return handler
+	}
+
+	if route.any != nil {
+		return route.any
+	}
+
+	return HandlerFunc(func(w ResponseWriter, r *Request) {
+		w.WriteCode(messages.MethodNotAllowed)
+	})
+}
+
+// Describe adds attributes to the link to path in /.well-known/core.
+func (mux *ServeMux) Describe(path string, attributes ...link.Attribute) {
+	mux.mutex.Lock()
+	defer mux.mutex.Unlock()
+
+	route := mux.route(path)
+	route.attributes = append(route.attributes, attributes...)
+}
+
+// Links returns the links to every registered path, sorted by path.
+func (mux *ServeMux) Links() link.Links {
+	mux.mutex.RLock()
+	defer mux.mutex.RUnlock()
+
+	paths := make([]string, 0, len(mux.routes))
+	for path := range mux.routes {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	links := link.Links{}
+	for _, path := range paths {
+		route := mux.routes[path]
+		if route.empty() {
+			continue
+		}
+
+		var attributes []link.Attribute
+		if describer, ok := route.describer(); ok {
+			attributes = append(attributes, describer.Attributes()...)
+		}
+		attributes = append(attributes, route.attributes...)
+
+		links = append(links, link.New("/"+path, attributes...))
+	}
+	return links
+}
+
+// Responds with the links to the registered paths matching the query.
+func (mux *ServeMux) serveLinks(w ResponseWriter, r *Request) {
+	if r.Code != messages.GET {
+		w.WriteCode(messages.MethodNotAllowed)
+		return
+	}
+
+	w.Options().SetContentFormat(messages.LinkFormat)
+	w.Write(mux.Links().Filter(r.Options.URIQuery...).Bytes())
+}
+
+func (mux *ServeMux) ServeCOAP(w ResponseWriter, r *Request) {
+	mux.Handler(r).ServeCOAP(w, r)
+}
+
+// Handle registers the handler on DefaultServeMux.
+func Handle(path string, handler Handler) {
+	DefaultServeMux.Handle(path, handler)
+}
+
+// HandleFunc registers the handler function on DefaultServeMux.
+func HandleFunc(path string, handler func(ResponseWriter, *Request)) {
+	DefaultServeMux.HandleFunc(path, handler)
+}
+
+// Describe adds attributes to the link to path on DefaultServeMux.
+func Describe(path string, attributes ...link.Attribute) {
+	DefaultServeMux.Describe(path, attributes...)
+}
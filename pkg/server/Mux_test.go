@@ -0,0 +1,28 @@
+package server
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/naspinall/GoAP/pkg/link"
+	messages "github.com/naspinall/GoAP/pkg/message"
+)
+
+func TestServeMux_Links(t *testing.T) {
+	mux := NewServeMux()
+	mux.HandleFunc("/sensors/light", func(w ResponseWriter, r *Request) {})
+	mux.Describe("/sensors/light", link.ResourceType("light-lux"), link.Interface("sensor"))
+	mux.Handle("/sensors/temp", NewResource([]byte("20"), messages.TextPlain))
+	mux.Describe("/sensors/temp", link.ResourceType("temperature-c"))
+	mux.HandleMethod(messages.POST, "/actuators/led", HandlerFunc(func(w ResponseWriter, r *Request) {}))
+	mux.Describe("/unhandled", link.Title("Nothing here"))
+
+	want := link.Links{
+		link.New("/actuators/led"),
+		link.New("/sensors/light", link.ResourceType("light-lux"), link.Interface("sensor")),
+		link.New("/sensors/temp", link.ContentFormat(messages.TextPlain), link.Observable(), link.ResourceType("temperature-c")),
+	}
+	if got := mux.Links(); !reflect.DeepEqual(got, want) {
+		t.Errorf("ServeMux.Links() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,115 @@
+package server
+
+import (
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/naspinall/GoAP/pkg/client"
+	"github.com/naspinall/GoAP/pkg/memnet"
+	messages "github.com/naspinall/GoAP/pkg/message"
+)
+
+func TestServer_SimulatedNetwork(t *testing.T) {
+	// Drops the first datagram from the endpoint at addr
+	dropFirst := func(addr string) func(from, to net.Addr, b []byte) bool {
+		var once sync.Once
+		return func(from, to net.Addr, b []byte) bool {
+			dropped := false
+			if from.String() == addr {
+				once.Do(func() { dropped = true })
+			}
+			return dropped
+		}
+	}
+
+	tests := []struct {
+		name    string
+		network func(n *memnet.Network)
+	}{
+		{
+			name:    "Lost Request",
+			network: func(n *memnet.Network) { n.Drop = dropFirst("client") },
+		},
+		{
+			name:    "Lost Response",
+			network: func(n *memnet.Network) { n.Drop = dropFirst("server") },
+		},
+		{
+			name:    "Duplicated",
+			network: func(n *memnet.Network) { n.Duplicate = 1 },
+		},
+		{
+			name:    "Reordered",
+			network: func(n *memnet.Network) { n.Reorder = 0.5 },
+		},
+		{
+			name: "Lossy",
+			network: func(n *memnet.Network) {
+				n.Loss, n.Duplicate, n.Reorder = 0.2, 0.2, 0.2
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			network := memnet.NewNetwork(7)
+			tt.network(network)
+
+			// Counting how often each request is handled
+			var mutex sync.Mutex
+			handled := make(map[string]int)
+			s := &Server{Handler: HandlerFunc(func(w ResponseWriter, r *Request) {
+				mutex.Lock()
+				handled[string(r.Payload)]++
+				mutex.Unlock()
+
+				w.WriteCode(messages.Changed)
+				w.Write(r.Payload)
+			})}
+			defer s.Close()
+
+			conn, err := network.Listen("server")
+			if err != nil {
+				t.Fatal(err)
+			}
+			go s.Serve(conn)
+
+			peer, err := network.Listen("client")
+			if err != nil {
+				t.Fatal(err)
+			}
+			c := client.NewPacketClient(peer, conn.LocalAddr())
+			defer c.Close()
+
+			params := messages.DefaultTransmissionParams
+			params.AckTimeout, params.MaxRetransmit, params.ProbingRate = 5*time.Millisecond, 8, 1e6
+			if err := c.SetTransmissionParams(params); err != nil {
+				t.Fatal(err)
+			}
+
+			for i := 0; i < 10; i++ {
+				payload := strconv.Itoa(i)
+				m, err := c.Put("coap://server/counter", messages.WithPayload([]byte(payload)))
+				if err != nil {
+					t.Fatalf("Client.Put() error = %v", err)
+				}
+				if m.Code != messages.Changed || string(m.Payload) != payload {
+					t.Errorf("Client.Put() = %v %q, want %v %q", m.Code, m.Payload, messages.Changed, payload)
+				}
+			}
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			for payload, times := range handled {
+				if times != 1 {
+					t.Errorf("Server handled request %s %d times, want once", payload, times)
+				}
+			}
+			if len(handled) != 10 {
+				t.Errorf("Server handled %d requests, want 10", len(handled))
+			}
+		})
+	}
+}
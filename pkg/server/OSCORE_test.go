@@ -0,0 +1,129 @@
+package server
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/naspinall/GoAP/pkg/client"
+	messages "github.com/naspinall/GoAP/pkg/message"
+	"github.com/naspinall/GoAP/pkg/oscore"
+)
+
+// Starts a UDP server, returning a client connected to it.
+func udpServer(t *testing.T, s *Server) *client.Client {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go s.Serve(conn)
+
+	c, err := client.NewClient("127.0.0.1", conn.LocalAddr().(*net.UDPAddr).Port)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func newContext(t *testing.T, secret string, senderID, recipientID byte) *oscore.Context {
+	context, err := oscore.NewContext([]byte(secret), nil, []byte{senderID}, []byte{recipientID}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return context
+}
+
+func TestServer_OSCORE(t *testing.T) {
+	mux := NewServeMux()
+	mux.HandleFunc("/secret", func(w ResponseWriter, r *Request) {
+		w.Write(append([]byte("hello "), r.Payload...))
+	})
+	resource := NewResource([]byte("20"), messages.TextPlain)
+	mux.Handle("/temperature", resource)
+
+	const secret = "0123456789abcdef"
+
+	tests := []struct {
+		name     string
+		contexts *oscore.Contexts
+		client   *oscore.Context
+		wantCode uint8
+	}{
+		{
+			name:     "Protected",
+			contexts: oscore.NewContexts(newContext(t, secret, 0x02, 0x01)),
+			client:   newContext(t, secret, 0x01, 0x02),
+			wantCode: messages.Content,
+		},
+		{
+			name:     "Unknown Context",
+			contexts: oscore.NewContexts(newContext(t, secret, 0x02, 0x01)),
+			client:   newContext(t, secret, 0x03, 0x02),
+			wantCode: messages.Unauthorized,
+		},
+		{
+			name:     "Wrong Secret",
+			contexts: oscore.NewContexts(newContext(t, secret, 0x02, 0x01)),
+			client:   newContext(t, "fedcba9876543210", 0x01, 0x02),
+			wantCode: messages.Bad,
+		},
+		{
+			name:     "Not Supported",
+			client:   newContext(t, secret, 0x01, 0x02),
+			wantCode: messages.BadOption,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Server{Handler: mux, OSCORE: tt.contexts}
+			defer s.Close()
+
+			c := udpServer(t, s)
+			defer c.Close()
+			c.SetSecurityContext(tt.client)
+
+			m, err := c.Post("coap://127.0.0.1/secret", messages.WithPayload([]byte("world")))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if m.Code != tt.wantCode {
+				t.Fatalf("Post() Code = %v, want %v", m.Code, tt.wantCode)
+			}
+			if tt.wantCode == messages.Content && string(m.Payload) != "hello world" {
+				t.Errorf("Post() Payload = %q, want %q", m.Payload, "hello world")
+			}
+		})
+	}
+
+	t.Run("Observe", func(t *testing.T) {
+		s := &Server{Handler: mux, OSCORE: oscore.NewContexts(newContext(t, secret, 0x02, 0x01))}
+		defer s.Close()
+
+		c := udpServer(t, s)
+		defer c.Close()
+		c.SetSecurityContext(newContext(t, secret, 0x01, 0x02))
+
+		notifications := make(chan string, 4)
+		observation, err := c.Observe("coap://127.0.0.1/temperature", func(m *messages.Message) {
+			notifications <- string(m.Payload)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer observation.Cancel()
+
+		resource.Set([]byte("21"), messages.TextPlain)
+
+		for _, want := range []string{"20", "21"} {
+			select {
+			case got := <-notifications:
+				if got != want {
+					t.Errorf("notification = %q, want %q", got, want)
+				}
+			case <-time.After(time.Second):
+				t.Fatalf("no notification %q", want)
+			}
+		}
+	})
+}
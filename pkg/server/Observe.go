@@ -0,0 +1,298 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/naspinall/GoAP/pkg/link"
+	messages "github.com/naspinall/GoAP/pkg/message"
+	"github.com/naspinall/GoAP/pkg/oscore"
+	"github.com/naspinall/GoAP/pkg/stream"
+)
+
+const (
+	ObserveCheckInterval = 24 * time.Hour // Longest time between confirmable notifications to an observer
+	MaxObserveSequence   = 0xFFFFFF       // Observe sequence numbers are 24 bit
+	recentNotifications  = 8              // Notification message IDs remembered per observer
+)
+
+// observer is a client registered for notifications of a resource.
+type observer struct {
+	conn   net.PacketConn
+	stream stream.Conn // Set for observers on reliable transports
+	addr   net.Addr
+	token  []byte
+
+	// Set for observers registered with OSCORE
+	security *oscore.Context
+	exchange *oscore.Exchange
+
+	// Retransmission of confirmable notifications
+	params messages.TransmissionParams
+
+	// Outstanding confirmable notification
+	pending      *messages.Message
+	attempts     int
+	acknowledged chan struct{}
+
+	lastConfirmable time.Time
+	recent          []uint16
+}
+
+// Resource is a representation clients can observe (RFC 7641). Changes set
+// with Set are sent to every observer as notifications.
+type Resource struct {
+	// Sends every notification as a confirmable message
+	Confirmable bool
+
+	// Longest time between confirmable notifications, checking observers
+	// are still interested.
+	CheckInterval time.Duration
+
+	mutex         sync.Mutex
+	observers     map[string]*observer
+	sequence      uint
+	payload       []byte
+	contentFormat uint
+}
+
+func NewResource(payload []byte, contentFormat uint) *Resource {
+	return &Resource{
+		CheckInterval: ObserveCheckInterval,
+		observers:     make(map[string]*observer),
+		payload:       payload,
+		contentFormat: contentFormat,
+	}
+}
+
+func observerKey(addr net.Addr, token []byte) string {
+	return fmt.Sprintf("%s/%x", addr.String(), token)
+}
+
+// Observers returns the number of registered observers.
+func (r *Resource) Observers() int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return len(r.observers)
+}
+
+// Set changes the representation and notifies all observers.
+func (r *Resource) Set(payload []byte, contentFormat uint) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.payload, r.contentFormat = payload, contentFormat
+	r.sequence = (r.sequence + 1) & MaxObserveSequence
+
+	for _, o := range r.observers {
+		r.notify(o)
+	}
+}
+
+// Attributes describe the resource as observable in /.well-known/core.
+func (r *Resource) Attributes() []link.Attribute {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return []link.Attribute{link.ContentFormat(r.contentFormat), link.Observable()}
+}
+
+// ServeCOAP responds to a request for the resource, registering or
+// deregistering the sender when the request has the Observe option.
+func (r *Resource) ServeCOAP(w ResponseWriter, request *Request) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if request.Code != messages.GET {
+		w.WriteCode(messages.MethodNotAllowed)
+		return
+	}
+
+	key := observerKey(request.RemoteAddr, request.Token)
+	w.Options().SetContentFormat(r.contentFormat)
+	w.Write(r.payload)
+
+	// Requests that didn't come through a server, like ones built in tests,
+	// have nowhere to send notifications
+	if request.Options.Observe == nil || (request.conn == nil && request.stream == nil) {
+		return
+	}
+
+	switch *request.Options.Observe {
+	case messages.ObserveRegister:
+		// Registering again replaces the existing registration
+		if o, ok := r.observers[key]; ok {
+			r.remove(o)
+		}
+
+		r.observers[key] = &observer{
+			conn:            request.conn,
+			stream:          request.stream,
+			addr:            request.RemoteAddr,
+			token:           request.Token,
+			security:        request.security,
+			exchange:        request.exchange,
+			params:          messages.DefaultTransmissionParams,
+			lastConfirmable: time.Now(),
+		}
+		if request.server != nil {
+			r.observers[key].params = request.server.transmissionParams()
+		}
+
+		// Server passes on acknowledgements and resets of notifications
+		if request.server != nil {
+			request.server.observe(r)
+		}
+
+		sequence := r.sequence
+		w.Options().Observe = &sequence
+
+	case messages.ObserveDeregister:
+		if o, ok := r.observers[key]; ok {
+			r.remove(o)
+		}
+	}
+}
+
+// Acknowledge marks a confirmable notification as received by the observer.
+func (r *Resource) Acknowledge(addr net.Addr, messageID uint16) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for _, o := range r.observers {
+		if o.addr.String() != addr.String() || o.pending == nil || o.pending.MessageID != messageID {
+			continue
+		}
+
+		// Observer is still alive
+		close(o.acknowledged)
+		o.pending, o.attempts = nil, 0
+		o.lastConfirmable = time.Now()
+	}
+}
+
+// Reset removes the observer that rejected a notification with a Reset.
+func (r *Resource) Reset(addr net.Addr, messageID uint16) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for _, o := range r.observers {
+		if o.addr.String() != addr.String() {
+			continue
+		}
+		for _, id := range o.recent {
+			if id == messageID {
+				r.remove(o)
+				break
+			}
+		}
+	}
+}
+
+// Removes an observer, stopping any retransmission. Must hold the mutex.
+func (r *Resource) remove(o *observer) {
+	if o.pending != nil {
+		close(o.acknowledged)
+		o.pending = nil
+	}
+	delete(r.observers, observerKey(o.addr, o.token))
+}
+
+// Removes the observers on a closed connection.
+func (r *Resource) removeStream(conn stream.Conn) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for _, o := range r.observers {
+		if o.stream == conn {
+			r.remove(o)
+		}
+	}
+}
+
+// Sends the current representation to an observer. Must hold the mutex.
+func (r *Resource) notify(o *observer) {
+	sequence := r.sequence
+	m := messages.NewMessage(messages.WithToken(o.token), messages.WithMessageID(nextMessageID()), messages.WithObserve(sequence), messages.WithPayload(r.payload))
+	m.Code = messages.Content
+	m.Options.SetContentFormat(r.contentFormat)
+
+	if o.security != nil {
+		protected, err := o.security.ProtectResponse(m, o.exchange)
+		if err != nil {
+			return
+		}
+		m = protected
+	}
+
+	// Reliable transports deliver notifications without acknowledgements
+	if o.stream != nil {
+		o.stream.WriteMessage(m)
+		return
+	}
+
+	// Remembering message IDs so resets can be matched to the observer
+	o.recent = append(o.recent, m.MessageID)
+	if len(o.recent) > recentNotifications {
+		o.recent = o.recent[1:]
+	}
+
+	// Checking the observer is still interested now and then
+	confirmable := r.Confirmable || o.pending != nil || time.Since(o.lastConfirmable) >= r.CheckInterval
+	if !confirmable {
+		m.SetType(messages.NonConfirmable)
+		writeTo(o.conn, o.addr, m)
+		return
+	}
+
+	m.SetType(messages.Confirmable)
+
+	// A newer notification replaces the outstanding one, keeping the
+	// retransmission counter.
+	if o.pending == nil {
+		o.acknowledged = make(chan struct{})
+		go r.retransmit(o, o.acknowledged)
+	}
+	o.pending = m
+
+	writeTo(o.conn, o.addr, m)
+}
+
+// Retransmits the outstanding confirmable notification of an observer until
+// it is acknowledged, removing the observer if it never is.
+func (r *Resource) retransmit(o *observer, acknowledged chan struct{}) {
+	timeout := o.params.InitialTimeout()
+
+	for {
+		select {
+		case <-acknowledged:
+			return
+		case <-time.After(timeout):
+		}
+
+		r.mutex.Lock()
+
+		// Acknowledged or removed while waiting for the lock
+		select {
+		case <-acknowledged:
+			r.mutex.Unlock()
+			return
+		default:
+		}
+
+		// Observer is no longer there
+		if o.attempts >= o.params.MaxRetransmit {
+			r.remove(o)
+			r.mutex.Unlock()
+			return
+		}
+
+		o.attempts++
+		writeTo(o.conn, o.addr, o.pending)
+		r.mutex.Unlock()
+
+		timeout *= 2
+	}
+}
@@ -0,0 +1,153 @@
+package server
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/naspinall/GoAP/pkg/client"
+	messages "github.com/naspinall/GoAP/pkg/message"
+)
+
+func serveResource(t *testing.T, resource *Resource) *net.UDPConn {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mux := NewServeMux()
+	mux.Handle("/temperature", resource)
+
+	s := &Server{Handler: mux}
+	go s.Serve(conn)
+	return conn
+}
+
+func waitFor(t *testing.T, condition func() bool) {
+	deadline := time.Now().Add(2 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for condition")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestResource_Notify(t *testing.T) {
+	tests := []struct {
+		name        string
+		confirmable bool
+	}{
+		{
+			name:        "Non-Confirmable Notifications",
+			confirmable: false,
+		},
+		{
+			name:        "Confirmable Notifications",
+			confirmable: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resource := NewResource([]byte("20"), messages.TextPlain)
+			resource.Confirmable = tt.confirmable
+
+			conn := serveResource(t, resource)
+			defer conn.Close()
+
+			c, err := client.NewClient("127.0.0.1", conn.LocalAddr().(*net.UDPAddr).Port)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			received := make(chan string, 4)
+			o, err := c.Observe("coap://127.0.0.1/temperature", func(m *messages.Message) {
+				received <- string(m.Payload)
+			})
+			if err != nil {
+				t.Fatalf("Client.Observe() error = %v", err)
+			}
+
+			resource.Set([]byte("21"), messages.TextPlain)
+			resource.Set([]byte("22"), messages.TextPlain)
+
+			for _, want := range []string{"20", "21", "22"} {
+				select {
+				case got := <-received:
+					if got != want {
+						t.Errorf("Notification = %v, want %v", got, want)
+					}
+				case <-time.After(time.Second):
+					t.Fatalf("Missing notification %v", want)
+				}
+			}
+
+			// Confirmable notifications are acknowledged by the client
+			waitFor(t, func() bool {
+				resource.mutex.Lock()
+				defer resource.mutex.Unlock()
+				for _, o := range resource.observers {
+					if o.pending != nil {
+						return false
+					}
+				}
+				return true
+			})
+
+			if err := o.Cancel(); err != nil {
+				t.Fatalf("Observation.Cancel() error = %v", err)
+			}
+			if got := resource.Observers(); got != 0 {
+				t.Errorf("Resource.Observers() after cancel = %v, want 0", got)
+			}
+		})
+	}
+}
+
+func TestResource_Reset(t *testing.T) {
+	resource := NewResource([]byte("20"), messages.TextPlain)
+	conn := serveResource(t, resource)
+	defer conn.Close()
+
+	observer, err := net.DialUDP("udp", nil, conn.LocalAddr().(*net.UDPAddr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer observer.Close()
+
+	// Registering by hand
+	request := messages.NewMessage(messages.Get(), messages.WithType(messages.NonConfirmable), messages.WithMessageID(1), messages.WithToken([]byte{0x42}), messages.WithURI("coap://127.0.0.1/temperature"), messages.WithObserve(messages.ObserveRegister))
+	if err := request.Write(observer); err != nil {
+		t.Fatal(err)
+	}
+
+	b := make([]byte, messages.MaxMessageSize)
+	if _, err := observer.Read(b); err != nil {
+		t.Fatal(err)
+	}
+	if got := resource.Observers(); got != 1 {
+		t.Fatalf("Resource.Observers() = %v, want 1", got)
+	}
+
+	resource.Set([]byte("21"), messages.TextPlain)
+
+	n, err := observer.Read(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	notification, err := messages.FromBytes(b[:n])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if notification.Options.Observe == nil || *notification.Options.Observe != 1 {
+		t.Errorf("Notification Observe = %v, want 1", notification.Options.Observe)
+	}
+
+	// Rejecting the notification ends the observation
+	reset := messages.NewMessage(messages.WithType(messages.Reset), messages.WithMessageID(notification.MessageID))
+	if err := reset.Write(observer); err != nil {
+		t.Fatal(err)
+	}
+
+	waitFor(t, func() bool { return resource.Observers() == 0 })
+}
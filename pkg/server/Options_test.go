@@ -0,0 +1,63 @@
+package server
+
+import (
+	"strings"
+	"testing"
+
+	messages "github.com/naspinall/GoAP/pkg/message"
+)
+
+// Adds an option without checking it is registered.
+func withRawOption(number uint, value []byte) messages.MessagesConfig {
+	return func(m *messages.Message) error {
+		m.Options.Raw = append(m.Options.Raw, messages.Option{Number: number, Value: value})
+		return nil
+	}
+}
+
+func TestServer_BadOption(t *testing.T) {
+	if err := messages.RegisterOption(messages.OptionDef{Number: 2061, Name: "Test-Critical", Format: messages.StringFormat, MaxLength: 8}); err != nil && err != messages.ErrOptionRegistered {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		messageType messages.MessageType
+		option      messages.MessagesConfig
+		wantType    messages.MessageType
+		wantCode    uint8
+	}{
+		{name: "Unrecognized Critical", option: withRawOption(2053, []byte{1}), wantType: messages.Acknowledgement, wantCode: messages.BadOption},
+		{name: "Unrecognized Elective", option: withRawOption(2054, []byte{1}), wantType: messages.Acknowledgement, wantCode: messages.Content},
+		{name: "Registered Critical", option: messages.WithOption(2061, []byte("value")), wantType: messages.Acknowledgement, wantCode: messages.Content},
+		{name: "Malformed Critical", option: withRawOption(2061, []byte("too long!")), wantType: messages.Acknowledgement, wantCode: messages.BadOption},
+		{name: "Non-confirmable Unrecognized Critical", messageType: messages.NonConfirmable, option: withRawOption(2053, []byte{1}), wantType: messages.Reset, wantCode: messages.Empty},
+		{name: "Non-confirmable Unrecognized Elective", messageType: messages.NonConfirmable, option: withRawOption(2054, []byte{1}), wantType: messages.NonConfirmable, wantCode: messages.Content},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handled := make(chan struct{}, 1)
+			s, peer := testServer(t, HandlerFunc(func(w ResponseWriter, r *Request) {
+				handled <- struct{}{}
+				w.Write([]byte("hello"))
+			}))
+			defer s.Close()
+			defer peer.Close()
+
+			request := messages.NewMessage(messages.Get(), messages.WithType(tt.messageType), messages.WithMessageID(1), messages.WithToken([]byte{1}), messages.WithURI("coap://localhost/hello"), tt.option)
+			reply := roundTrip(t, peer, request)
+			if reply.Type != tt.wantType || reply.Code != tt.wantCode {
+				t.Errorf("Reply = %v %v, want %v %v", reply.Type, reply.Code, tt.wantType, tt.wantCode)
+			}
+			if ran := len(handled) > 0; ran != (tt.wantCode == messages.Content) {
+				t.Errorf("Handler ran = %v", ran)
+			}
+			if tt.wantCode == messages.BadOption && !strings.Contains(string(reply.Payload), "critical option") {
+				t.Errorf("Reply Payload = %q, want a diagnostic", reply.Payload)
+			}
+			if tt.wantType == messages.Reset && reply.MessageID != request.MessageID {
+				t.Errorf("Reply MessageID = %v, want %v", reply.MessageID, request.MessageID)
+			}
+		})
+	}
+}
@@ -1,66 +1,549 @@
 package server
 
 import (
+	"errors"
+	"fmt"
 	"log"
+	"math/rand"
 	"net"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	messages "github.com/naspinall/GoAP/pkg/message"
+	"github.com/naspinall/GoAP/pkg/oscore"
+	"github.com/naspinall/GoAP/pkg/stream"
 )
 
-// Echo UDP Server
-func Echo() {
-	conn, err := net.ListenUDP("udp", &net.UDPAddr{
-		IP:   []byte{0, 0, 0, 0},
-		Port: 5000,
-		Zone: "",
-	})
+const (
+	DefaultAddr          = ":5683"
+	DefaultSeparateDelay = time.Second // Wait before acknowledging a request the handler hasn't answered
+)
+
+// ErrServerClosed is returned by Serve after the server is closed.
+var ErrServerClosed = errors.New("Server Closed")
+
+// Server serves CoAP requests over UDP.
+type Server struct {
+	Addr    string  // UDP address to listen on, ":5683" if empty
+	Handler Handler // Handler to invoke, DefaultServeMux if nil
+
+	// Requests remembered for replying to retransmissions, 4096 if zero
+	MaxExchanges int
+
+	// Time to wait for a handler before acknowledging a confirmable request
+	// and sending the response separately, one second if zero. Should be
+	// less than the ACK timeout so clients don't retransmit.
+	SeparateDelay time.Duration
+
+	// Longest token accepted, messages.MaxExtendedTokenLength if zero, or
+	// messages.MaxTokenLength to turn off extended token lengths (RFC 8974).
+	// Confirmable messages with longer tokens are rejected with a reset,
+	// like messages that can't be parsed.
+	MaxTokenLength int
+
+	// Security contexts for requests protected with OSCORE. Protected
+	// requests are rejected with 4.02 Bad Option if nil.
+	OSCORE *oscore.Contexts
+
+	// Longest random delay of responses to group requests, so the members
+	// of a group don't all respond at once. The default leisure of the
+	// transmission parameters if zero.
+	Leisure time.Duration
+
+	// Retransmission of confirmable messages the server sends, and how long
+	// requests are remembered. messages.DefaultTransmissionParams if zero.
+	TransmissionParams messages.TransmissionParams
 
+	mutex     sync.Mutex
+	conns     map[net.PacketConn]bool
+	closed    bool
+	resources map[*Resource]bool
+	exchanges *exchangeCache
+	pending   map[string]chan bool
+	listeners map[net.Listener]bool
+	streams   map[stream.Conn]bool
+	sessions  map[net.Conn]bool // DTLS sessions
+}
+
+// ListenAndServe listens on addr and serves requests with handler.
+func ListenAndServe(addr string, handler Handler) error {
+	s := &Server{Addr: addr, Handler: handler}
+	return s.ListenAndServe()
+}
+
+// ListenAndServe listens on the server address and serves requests.
+func (s *Server) ListenAndServe() error {
+	addr := s.Addr
+	if addr == "" {
+		addr = DefaultAddr
+	}
+
+	conn, err := net.ListenPacket("udp", addr)
 	if err != nil {
-		log.Fatal(err)
+		return err
+	}
+
+	return s.Serve(conn)
+}
+
+// Serve reads requests from conn, handling each in a new goroutine. Serve
+// always returns a non-nil error and closes conn.
+func (s *Server) Serve(conn net.PacketConn) error {
+	return s.servePackets(conn, func(b []byte) (int, net.Addr, bool, error) {
+		n, addr, err := conn.ReadFrom(b)
+		return n, addr, false, err
+	})
+}
+
+// Reads datagrams from conn with read, which also reports if they were
+// sent to a multicast group.
+func (s *Server) servePackets(conn net.PacketConn, read func(b []byte) (int, net.Addr, bool, error)) error {
+	s.mutex.Lock()
+	if s.closed {
+		s.mutex.Unlock()
+		conn.Close()
+		return ErrServerClosed
+	}
+	if s.conns == nil {
+		s.conns = make(map[net.PacketConn]bool)
+	}
+	s.conns[conn] = true
+	if s.exchanges == nil {
+		s.exchanges = newExchangeCache(s.MaxExchanges)
 	}
+	s.mutex.Unlock()
+
+	defer func() {
+		conn.Close()
+
+		s.mutex.Lock()
+		delete(s.conns, conn)
+		s.mutex.Unlock()
+	}()
 
 	for {
-		b := make([]byte, 1024)
-		_, raddr, err := conn.ReadFrom(b)
+		b := make([]byte, messages.MaxMessageSize)
+		n, raddr, multicast, err := read(b)
+		if err != nil {
+			if s.isClosed() {
+				return ErrServerClosed
+			}
+			return err
+		}
 
+		m, err := messages.FromBytes(b[:n])
 		if err != nil {
-			log.Fatal(err)
+			// Dropping malformed messages
+			continue
 		}
-		_, err = conn.WriteTo(b, raddr)
+
+		s.handleMessage(conn, raddr, m, multicast)
 	}
 }
 
-func Ping() {
+// Close stops the server, closing its connections.
+func (s *Server) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
 
-	conn, err := net.ListenUDP("udp", &net.UDPAddr{
-		IP:   []byte{0, 0, 0, 0},
-		Port: 5000,
-		Zone: "",
-	})
+	s.closed = true
 
-	if err != nil {
-		log.Fatal(err)
+	for l := range s.listeners {
+		l.Close()
+	}
+	for conn := range s.streams {
+		conn.Close()
+	}
+	for conn := range s.sessions {
+		conn.Close()
+	}
+	for conn := range s.conns {
+		conn.Close()
 	}
 
-	for {
-		b := make([]byte, 1024)
-		_, raddr, err := conn.ReadFrom(b)
-		log.Println("Message Read")
-		m, err := messages.FromBytes(b)
-		log.Printf("%+v", b)
-		if err != nil {
-			log.Fatal(err)
+	return nil
+}
+
+func (s *Server) isClosed() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.closed
+}
+
+func (s *Server) handleMessage(conn net.PacketConn, addr net.Addr, m *messages.Message, multicast bool) {
+	switch m.Type {
+	case messages.Acknowledgement:
+		if s.acknowledge(addr, m.MessageID, true) {
+			return
+		}
+		for _, resource := range s.observed() {
+			resource.Acknowledge(addr, m.MessageID)
+		}
+		return
+
+	case messages.Reset:
+		if s.acknowledge(addr, m.MessageID, false) {
+			return
 		}
+		for _, resource := range s.observed() {
+			resource.Reset(addr, m.MessageID)
+		}
+		return
+	}
 
+	// Group requests are never confirmable (RFC 7252 8.1)
+	if multicast && m.Type != messages.NonConfirmable {
+		return
+	}
+
+	// Only requests are handled, empty confirmable messages are pings
+	if !isRequest(m.Code) || len(m.Token) > s.maxTokenLength() {
 		if m.Type == messages.Confirmable {
-			// Encoding ACK
-			err := m.AsAcknowledge().Encode()
-			if err != nil {
-				log.Fatal(err)
+			reset := messages.NewMessage(messages.WithType(messages.Reset), messages.WithMessageID(m.MessageID))
+			writeTo(conn, addr, reset)
+		}
+		return
+	}
+
+	// Retransmitted requests get the original response
+	key := exchangeKey(addr, m.MessageID)
+	if ok, response := s.exchanges.Start(key, exchangeLifetime(s.transmissionParams(), m.Type)); !ok {
+		if response != nil && m.Type == messages.Confirmable {
+			conn.WriteTo(response, addr)
+		}
+		return
+	}
+
+	go s.serve(conn, key, &Request{
+		Message:    m,
+		RemoteAddr: addr,
+		Multicast:  multicast,
+		conn:       conn,
+		server:     s,
+	})
+}
+
+func (s *Server) serve(conn net.PacketConn, key string, r *Request) {
+	// Handlers of protected requests get the request inside, the response
+	// matches the one that arrived
+	request := r.Message
+
+	responses := make(chan *response, 1)
+	go func() {
+		responses <- s.run(r)
+	}()
+
+	var w *response
+	if request.Type != messages.Confirmable {
+		w = <-responses
+	} else {
+		timer := time.NewTimer(s.separateDelay())
+
+		select {
+		case w = <-responses:
+			timer.Stop()
+
+		case <-timer.C:
+			// Acknowledging now, the response follows in its own exchange
+			ack := messages.NewMessage(messages.WithType(messages.Acknowledgement), messages.WithMessageID(request.MessageID))
+			if err := ack.Encode(); err != nil {
+				return
+			}
+			s.exchanges.Complete(key, ack.Bytes())
+			conn.WriteTo(ack.Bytes(), r.RemoteAddr)
+
+			w = <-responses
+			if s.suppress(r, w.code) {
+				return
+			}
+
+			m := w.message(request)
+			m.SetType(messages.Confirmable).SetMessageID(nextMessageID())
+			s.confirm(conn, r.RemoteAddr, m)
+			return
+		}
+	}
+
+	// Rejected rather than answered, with a reset unless the request was for
+	// a group, which gets silence (RFC 7252 8.1)
+	if w.reset {
+		if r.Multicast {
+			return
+		}
+
+		reset := messages.NewMessage(messages.WithType(messages.Reset), messages.WithMessageID(request.MessageID))
+		if err := reset.Encode(); err != nil {
+			return
+		}
+		s.exchanges.Complete(key, reset.Bytes())
+		conn.WriteTo(reset.Bytes(), r.RemoteAddr)
+		return
+	}
+
+	m := w.message(request)
+	if s.suppress(r, w.code) {
+		// Confirmable requests are still acknowledged, without a response
+		if request.Type != messages.Confirmable {
+			return
+		}
+		m = messages.NewMessage(messages.WithType(messages.Acknowledgement), messages.WithMessageID(request.MessageID))
+	}
+	if err := m.Encode(); err != nil {
+		return
+	}
+
+	// Spreading the responses of group members out (RFC 7252 8.2)
+	if leisure := s.leisure(); r.Multicast && leisure > 0 {
+		time.Sleep(time.Duration(rand.Int63n(int64(leisure))))
+	}
+
+	s.exchanges.Complete(key, m.Bytes())
+	conn.WriteTo(m.Bytes(), r.RemoteAddr)
+}
+
+// Runs the handler for a request.
+func (s *Server) run(r *Request) (w *response) {
+	w = newResponse()
+	messageType := r.Type
+
+	// Handler panics become server errors, logged here rather than told to
+	// the client
+	defer func() {
+		if err := recover(); err != nil {
+			log.Printf("coap: panic serving %v /%s: %v\n%s", r.RemoteAddr, r.Path(), err, debug.Stack())
+
+			w = newResponse()
+			w.security, w.exchange = r.security, r.exchange
+			w.WriteCode(messages.InternalServerError)
+		}
+	}()
+
+	if badOptions(w, r, messageType) {
+		return w
+	}
+
+	if r.Options.OSCORE != nil {
+		if code, diagnostic := s.unprotect(r); code != messages.Empty {
+			// Errors about OSCORE itself can't be protected
+			w.WriteCode(code)
+			w.Options().SetMaxAge(0)
+			w.Write([]byte(diagnostic))
+			return w
+		}
+		w.security, w.exchange = r.security, r.exchange
+
+		// The request inside has options of its own
+		if badOptions(w, r, messageType) {
+			return w
+		}
+	}
+
+	s.handler().ServeCOAP(w, r)
+	return w
+}
+
+// Rejects requests with critical options the server doesn't recognize,
+// instead of running the handler (RFC 7252 5.4.1). Confirmable requests get
+// a 4.02 Bad Option response, non-confirmable ones a reset.
+func badOptions(w *response, r *Request, messageType messages.MessageType) bool {
+	bad := r.Options.BadOptions()
+	if len(bad) == 0 {
+		return false
+	}
+
+	if messageType == messages.NonConfirmable {
+		w.reset = true
+		return true
+	}
+
+	w.WriteCode(messages.BadOption)
+	w.Write([]byte(fmt.Sprintf("Unrecognized critical option %d", bad[0])))
+	return true
+}
+
+// Replaces a protected request with the request inside, returning the error
+// response code and diagnostic if it can't be unprotected (RFC 8613 8.2).
+func (s *Server) unprotect(r *Request) (uint8, string) {
+	if s.OSCORE == nil {
+		return messages.BadOption, ""
+	}
+
+	inner, security, exchange, err := s.OSCORE.UnprotectRequest(r.Message)
+	switch err {
+	case nil:
+		r.Message, r.security, r.exchange = inner, security, exchange
+		return messages.Empty, ""
+	case oscore.ErrUnknownContext:
+		return messages.Unauthorized, "Security context not found"
+	case oscore.ErrDecryptionFailed:
+		return messages.Bad, "Decryption failed"
+	case oscore.ErrReplay:
+		return messages.Unauthorized, "Replay detected"
+	default:
+		return messages.BadOption, ""
+	}
+}
+
+// Sends a confirmable message, retransmitting it until it is acknowledged
+// or rejected with a reset.
+func (s *Server) confirm(conn net.PacketConn, addr net.Addr, m *messages.Message) error {
+	if err := m.Encode(); err != nil {
+		return err
+	}
+
+	key := exchangeKey(addr, m.MessageID)
+	replies := make(chan bool, 1)
+
+	s.mutex.Lock()
+	if s.pending == nil {
+		s.pending = make(map[string]chan bool)
+	}
+	s.pending[key] = replies
+	s.mutex.Unlock()
+
+	defer func() {
+		s.mutex.Lock()
+		delete(s.pending, key)
+		s.mutex.Unlock()
+	}()
+
+	params := s.transmissionParams()
+	timeout := params.InitialTimeout()
+
+	for retransmit := 0; ; retransmit++ {
+		if _, err := conn.WriteTo(m.Bytes(), addr); err != nil {
+			return err
+		}
+
+		select {
+		case acknowledged := <-replies:
+			if !acknowledged {
+				return errors.New("Message Reset")
 			}
+			return nil
 
-			// Sending ACK
-			conn.WriteTo(m.Bytes(), raddr)
+		case <-time.After(timeout):
+			if retransmit >= params.MaxRetransmit {
+				return errors.New("Timeout")
+			}
+			timeout *= 2
 		}
 	}
 }
+
+// Passes an acknowledgement or reset to the confirmable message waiting for
+// it, returning false if there isn't one.
+func (s *Server) acknowledge(addr net.Addr, messageID uint16, acknowledged bool) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	replies, ok := s.pending[exchangeKey(addr, messageID)]
+	if !ok {
+		return false
+	}
+
+	select {
+	case replies <- acknowledged:
+	default:
+	}
+	return true
+}
+
+// Reports if the response to a request isn't wanted. Clients choose with the
+// No-Response option (RFC 7967), and group requests get no error responses
+// without it, as the members that can't answer would flood the client.
+func (s *Server) suppress(r *Request, code uint8) bool {
+	var class uint
+	switch code >> 5 {
+	case 2:
+		class = messages.NoResponseSuccess
+	case 4:
+		class = messages.NoResponseClientError
+	case 5:
+		class = messages.NoResponseServerError
+	}
+
+	if r.Options.NoResponse != nil {
+		return *r.Options.NoResponse&class != 0
+	}
+	return r.Multicast && class != messages.NoResponseSuccess
+}
+
+func (s *Server) leisure() time.Duration {
+	if s.Leisure == 0 {
+		return s.transmissionParams().DefaultLeisure
+	}
+	return s.Leisure
+}
+
+func (s *Server) maxTokenLength() int {
+	if s.MaxTokenLength == 0 {
+		return messages.MaxExtendedTokenLength
+	}
+	return s.MaxTokenLength
+}
+
+func (s *Server) transmissionParams() messages.TransmissionParams {
+	if s.TransmissionParams == (messages.TransmissionParams{}) {
+		return messages.DefaultTransmissionParams
+	}
+	return s.TransmissionParams
+}
+
+func (s *Server) separateDelay() time.Duration {
+	if s.SeparateDelay == 0 {
+		return DefaultSeparateDelay
+	}
+	return s.SeparateDelay
+}
+
+func (s *Server) handler() Handler {
+	if s.Handler == nil {
+		return DefaultServeMux
+	}
+	return s.Handler
+}
+
+// Keeps track of resources with observers for acknowledgements and resets.
+func (s *Server) observe(resource *Resource) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.resources == nil {
+		s.resources = make(map[*Resource]bool)
+	}
+	s.resources[resource] = true
+}
+
+func (s *Server) observed() []*Resource {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	resources := make([]*Resource, 0, len(s.resources))
+	for resource := range s.resources {
+		resources = append(resources, resource)
+	}
+	return resources
+}
+
+// Request codes are in class 0, excluding the empty code.
+func isRequest(code uint8) bool {
+	return code != messages.Empty && code>>5 == 0
+}
+
+// Message IDs for messages the server starts, like notifications
+var messageID = uint32(time.Now().UnixNano())
+
+func nextMessageID() uint16 {
+	return uint16(atomic.AddUint32(&messageID, 1))
+}
+
+func writeTo(conn net.PacketConn, addr net.Addr, m *messages.Message) error {
+	if err := m.Encode(); err != nil {
+		return err
+	}
+	_, err := conn.WriteTo(m.Bytes(), addr)
+	return err
+}
@@ -0,0 +1,214 @@
+package server
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+
+	messages "github.com/naspinall/GoAP/pkg/message"
+)
+
+// Starts a server with handler, returning a connection to it.
+func testServer(t *testing.T, handler Handler) (*Server, *net.UDPConn) {
+	return startServer(t, &Server{Handler: handler})
+}
+
+func startServer(t *testing.T, s *Server) (*Server, *net.UDPConn) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go s.Serve(conn)
+
+	peer, err := net.DialUDP("udp", nil, conn.LocalAddr().(*net.UDPAddr))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return s, peer
+}
+
+// Sends a message and reads the reply.
+func roundTrip(t *testing.T, peer *net.UDPConn, m *messages.Message) *messages.Message {
+	if err := m.Write(peer); err != nil {
+		t.Fatal(err)
+	}
+	return read(t, peer)
+}
+
+func read(t *testing.T, peer *net.UDPConn) *messages.Message {
+	peer.SetReadDeadline(time.Now().Add(time.Second))
+	b := make([]byte, messages.MaxMessageSize)
+	n, err := peer.Read(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reply, err := messages.FromBytes(b[:n])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return reply
+}
+
+func TestServer_Serve(t *testing.T) {
+	mux := NewServeMux()
+	mux.HandleFunc("/hello", func(w ResponseWriter, r *Request) {
+		w.Options().SetContentFormat(messages.TextPlain)
+		w.Write([]byte("world"))
+	})
+	mux.HandleMethod(messages.POST, "/things", HandlerFunc(func(w ResponseWriter, r *Request) {
+		w.Options().LocationPath = []string{"things", "1"}
+		w.WriteCode(messages.Created)
+	}))
+	mux.HandleFunc("/panic", func(w ResponseWriter, r *Request) {
+		panic("handler failed")
+	})
+
+	s, peer := testServer(t, mux)
+	defer s.Close()
+	defer peer.Close()
+
+	tests := []struct {
+		name        string
+		request     *messages.Message
+		wantType    messages.MessageType
+		wantCode    uint8
+		wantPayload string
+	}{
+		{
+			name:        "Piggybacked Response",
+			request:     messages.NewMessage(messages.Get(), messages.WithMessageID(1), messages.WithToken([]byte{1}), messages.WithURI("coap://localhost/hello")),
+			wantType:    messages.Acknowledgement,
+			wantCode:    messages.Content,
+			wantPayload: "world",
+		},
+		{
+			name:        "Non-Confirmable Response",
+			request:     messages.NewMessage(messages.Get(), messages.WithType(messages.NonConfirmable), messages.WithMessageID(2), messages.WithToken([]byte{2}), messages.WithURI("coap://localhost/hello")),
+			wantType:    messages.NonConfirmable,
+			wantCode:    messages.Content,
+			wantPayload: "world",
+		},
+		{
+			name:     "Method Handler",
+			request:  messages.NewMessage(messages.Post(), messages.WithMessageID(3), messages.WithToken([]byte{3}), messages.WithURI("coap://localhost/things")),
+			wantType: messages.Acknowledgement,
+			wantCode: messages.Created,
+		},
+		{
+			name:     "Method Not Allowed",
+			request:  messages.NewMessage(messages.Get(), messages.WithMessageID(4), messages.WithToken([]byte{4}), messages.WithURI("coap://localhost/things")),
+			wantType: messages.Acknowledgement,
+			wantCode: messages.MethodNotAllowed,
+		},
+		{
+			name:     "Not Found",
+			request:  messages.NewMessage(messages.Get(), messages.WithMessageID(5), messages.WithToken([]byte{5}), messages.WithURI("coap://localhost/missing")),
+			wantType: messages.Acknowledgement,
+			wantCode: messages.NotFound,
+		},
+		{
+			name:     "Handler Panic",
+			request:  messages.NewMessage(messages.Get(), messages.WithMessageID(6), messages.WithToken([]byte{6}), messages.WithURI("coap://localhost/panic")),
+			wantType: messages.Acknowledgement,
+			wantCode: messages.InternalServerError,
+		},
+		{
+			name:     "Ping",
+			request:  messages.NewMessage(messages.WithMessageID(7)),
+			wantType: messages.Reset,
+			wantCode: messages.Empty,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reply := roundTrip(t, peer, tt.request)
+
+			if reply.Type != tt.wantType {
+				t.Errorf("Reply Type = %v, want %v", reply.Type, tt.wantType)
+			}
+			if reply.Code != tt.wantCode {
+				t.Errorf("Reply Code = %v, want %v", reply.Code, tt.wantCode)
+			}
+			if string(reply.Payload) != tt.wantPayload {
+				t.Errorf("Reply Payload = %q, want %q", reply.Payload, tt.wantPayload)
+			}
+			if !bytes.Equal(reply.Token, tt.request.Token) {
+				t.Errorf("Reply Token = %v, want %v", reply.Token, tt.request.Token)
+			}
+			if tt.wantType != messages.NonConfirmable && reply.MessageID != tt.request.MessageID {
+				t.Errorf("Reply MessageID = %v, want %v", reply.MessageID, tt.request.MessageID)
+			}
+		})
+	}
+}
+
+func TestServer_Close(t *testing.T) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &Server{Handler: NewServeMux()}
+	served := make(chan error)
+	go func() { served <- s.Serve(conn) }()
+
+	time.Sleep(10 * time.Millisecond)
+	s.Close()
+
+	if err := <-served; err != ErrServerClosed {
+		t.Errorf("Server.Serve() error = %v, want %v", err, ErrServerClosed)
+	}
+}
+
+func TestServer_SeparateResponse(t *testing.T) {
+	mux := NewServeMux()
+	mux.HandleFunc("/slow", func(w ResponseWriter, r *Request) {
+		time.Sleep(100 * time.Millisecond)
+		w.Write([]byte("done"))
+	})
+
+	s, peer := startServer(t, &Server{Handler: mux, SeparateDelay: 20 * time.Millisecond})
+	defer s.Close()
+	defer peer.Close()
+
+	request := messages.NewMessage(messages.Get(), messages.WithMessageID(1), messages.WithToken([]byte{0x55}), messages.WithURI("coap://localhost/slow"))
+
+	// Empty acknowledgement first
+	ack := roundTrip(t, peer, request)
+	if ack.Type != messages.Acknowledgement || ack.Code != messages.Empty || ack.MessageID != request.MessageID {
+		t.Fatalf("Acknowledgement = %+v, want empty acknowledgement of %v", ack, request.MessageID)
+	}
+
+	// Retransmitted requests are acknowledged again
+	if duplicate := roundTrip(t, peer, request); duplicate.Type != messages.Acknowledgement || duplicate.Code != messages.Empty {
+		t.Errorf("Duplicate Acknowledgement = %+v, want empty acknowledgement", duplicate)
+	}
+
+	// Then the response in a confirmable message with the same token
+	response := read(t, peer)
+	if response.Type != messages.Confirmable {
+		t.Errorf("Response Type = %v, want %v", response.Type, messages.Confirmable)
+	}
+	if !bytes.Equal(response.Token, request.Token) {
+		t.Errorf("Response Token = %v, want %v", response.Token, request.Token)
+	}
+	if string(response.Payload) != "done" {
+		t.Errorf("Response Payload = %q, want %q", response.Payload, "done")
+	}
+
+	reply := messages.NewMessage(messages.WithType(messages.Acknowledgement), messages.WithMessageID(response.MessageID))
+	if err := reply.Write(peer); err != nil {
+		t.Fatal(err)
+	}
+
+	// Acknowledged responses aren't retransmitted
+	waitFor(t, func() bool {
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		return len(s.pending) == 0
+	})
+}
@@ -0,0 +1,147 @@
+package server
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+
+	"github.com/naspinall/GoAP/pkg/stream"
+)
+
+const DefaultTLSAddr = ":5684"
+
+// ListenAndServeTCP listens for CoAP over TCP on the server address.
+func (s *Server) ListenAndServeTCP() error {
+	addr := s.Addr
+	if addr == "" {
+		addr = DefaultAddr
+	}
+
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	return s.ServeTCP(l)
+}
+
+// ListenAndServeTLS listens for CoAP over TLS on the server address, using
+// the certificate and key in the given files.
+func (s *Server) ListenAndServeTLS(certFile, keyFile string) error {
+	addr := s.Addr
+	if addr == "" {
+		addr = DefaultTLSAddr
+	}
+
+	certificate, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return err
+	}
+
+	l, err := tls.Listen("tcp", addr, stream.TLSConfig(&tls.Config{
+		Certificates: []tls.Certificate{certificate},
+	}))
+	if err != nil {
+		return err
+	}
+
+	return s.ServeTCP(l)
+}
+
+// ServeTCP accepts connections on l, serving CoAP over TCP, or CoAP over
+// TLS for listeners from tls.Listen. ServeTCP always returns a non-nil error
+// and closes l.
+func (s *Server) ServeTCP(l net.Listener) error {
+	s.mutex.Lock()
+	if s.closed {
+		s.mutex.Unlock()
+		l.Close()
+		return ErrServerClosed
+	}
+	if s.listeners == nil {
+		s.listeners = make(map[net.Listener]bool)
+	}
+	s.listeners[l] = true
+	s.mutex.Unlock()
+
+	defer l.Close()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if s.isClosed() {
+				return ErrServerClosed
+			}
+			return err
+		}
+
+		go s.ServeStream(stream.NewTCPConn(conn))
+	}
+}
+
+// ServeHTTP upgrades the request to CoAP over WebSockets and serves it, so
+// the server can be mounted on an HTTP server at stream.WebSocketPath.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	stream.WebSocketHandler(s.ServeStream).ServeHTTP(w, r)
+}
+
+// ServeStream serves requests on a single reliable connection until it is
+// closed.
+func (s *Server) ServeStream(conn stream.Conn) {
+	s.mutex.Lock()
+	if s.closed {
+		s.mutex.Unlock()
+		conn.Close()
+		return
+	}
+	if s.streams == nil {
+		s.streams = make(map[stream.Conn]bool)
+	}
+	s.streams[conn] = true
+	s.mutex.Unlock()
+
+	defer func() {
+		conn.Close()
+
+		s.mutex.Lock()
+		delete(s.streams, conn)
+		s.mutex.Unlock()
+	}()
+
+	session, err := stream.NewSession(conn)
+	if err != nil {
+		return
+	}
+
+	// Observers on the connection are gone with it
+	defer func() {
+		for _, resource := range s.observed() {
+			resource.removeStream(session)
+		}
+	}()
+
+	for {
+		m, err := session.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		// Responses and empty messages have nowhere to go
+		if !isRequest(m.Code) {
+			continue
+		}
+
+		go func(r *Request) {
+			w := s.run(r)
+			if s.suppress(r, w.code) {
+				return
+			}
+			session.WriteMessage(w.message(r.Message))
+		}(&Request{
+			Message:    m,
+			RemoteAddr: conn.RemoteAddr(),
+			stream:     session,
+			server:     s,
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/naspinall/GoAP/pkg/client"
+	messages "github.com/naspinall/GoAP/pkg/message"
+	"github.com/naspinall/GoAP/pkg/stream"
+)
+
+// Starts a server over TCP, returning a client connected to it.
+func tcpServer(t *testing.T, handler Handler) (*Server, *client.Client, string) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &Server{Handler: handler}
+	go s.ServeTCP(l)
+
+	addr := l.Addr().(*net.TCPAddr)
+	c, err := client.NewTCPClient(addr.IP.String(), addr.Port)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return s, c, fmt.Sprintf("coap+tcp://%s", addr)
+}
+
+func TestServer_ServeTCP(t *testing.T) {
+	mux := NewServeMux()
+	mux.HandleFunc("/hello", func(w ResponseWriter, r *Request) {
+		w.Write([]byte("world"))
+	})
+	resource := NewResource([]byte("20"), messages.TextPlain)
+	mux.Handle("/temperature", resource)
+
+	s, c, uri := tcpServer(t, mux)
+	defer s.Close()
+	defer c.Close()
+
+	m, err := c.Get(uri + "/hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Code != messages.Content || string(m.Payload) != "world" {
+		t.Errorf("Get() = %v %q, want %v %q", m.Code, m.Payload, messages.Content, "world")
+	}
+
+	if err := c.Ping(); err != nil {
+		t.Errorf("Ping() error = %v", err)
+	}
+
+	notifications := make(chan string, 4)
+	observation, err := c.Observe(uri+"/temperature", func(m *messages.Message) {
+		notifications <- string(m.Payload)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer observation.Cancel()
+
+	resource.Set([]byte("21"), messages.TextPlain)
+
+	for _, want := range []string{"20", "21"} {
+		select {
+		case got := <-notifications:
+			if got != want {
+				t.Errorf("notification = %q, want %q", got, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("no notification %q", want)
+		}
+	}
+
+	// Observers go away with their connection
+	c.Close()
+	waitFor(t, func() bool { return resource.Observers() == 0 })
+}
+
+func TestServer_ServeHTTP(t *testing.T) {
+	mux := NewServeMux()
+	mux.HandleFunc("/hello", func(w ResponseWriter, r *Request) {
+		w.Write(r.Payload)
+	})
+
+	s := &Server{Handler: mux}
+	defer s.Close()
+
+	queries := make(chan string, 1)
+	web := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries <- r.URL.RawQuery
+		s.ServeHTTP(w, r)
+	}))
+	defer web.Close()
+
+	uri := "coap+ws://" + web.Listener.Addr().String()
+	c, err := client.NewWebSocketClient(uri+stream.WebSocketPath+"?key=1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if got := <-queries; got != "key=1" {
+		t.Errorf("handshake query = %q, want %q", got, "key=1")
+	}
+
+	payload := bytes.Repeat([]byte("hello"), 100)
+	m, err := c.Post(uri+"/hello", messages.WithPayload(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Code != messages.Content || !bytes.Equal(m.Payload, payload) {
+		t.Errorf("Post() = %v %q, want %v %q", m.Code, m.Payload, messages.Content, payload)
+	}
+
+	if err := c.Ping(); err != nil {
+		t.Errorf("Ping() error = %v", err)
+	}
+}
@@ -0,0 +1,76 @@
+package server
+
+import (
+	"bytes"
+	"testing"
+
+	messages "github.com/naspinall/GoAP/pkg/message"
+)
+
+func TestServer_MaxTokenLength(t *testing.T) {
+	tests := []struct {
+		name           string
+		maxTokenLength int
+		length         int
+		wantType       messages.MessageType
+	}{
+		{name: "Extended", length: 300, wantType: messages.Acknowledgement},
+		{name: "Turned Off", maxTokenLength: messages.MaxTokenLength, length: 9, wantType: messages.Reset},
+		{name: "Limited", maxTokenLength: 16, length: 17, wantType: messages.Reset},
+		{name: "Within Limit", maxTokenLength: 16, length: 16, wantType: messages.Acknowledgement},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, peer := startServer(t, &Server{Handler: NotFoundHandler(), MaxTokenLength: tt.maxTokenLength})
+			defer s.Close()
+			defer peer.Close()
+
+			request := messages.NewMessage(messages.Get(), messages.WithMessageID(1), messages.WithToken(bytes.Repeat([]byte{0x01}, tt.length)))
+			if reply := roundTrip(t, peer, request); reply.Type != tt.wantType {
+				t.Errorf("Reply Type = %v, want %v", reply.Type, tt.wantType)
+			}
+		})
+	}
+}
+
+func TestServer_ExtendedToken(t *testing.T) {
+	handler := HandlerFunc(func(w ResponseWriter, r *Request) {
+		w.Write([]byte("hello"))
+	})
+	token := bytes.Repeat([]byte{0x00, 0x8E}, 150)
+
+	t.Run("UDP", func(t *testing.T) {
+		s := &Server{Handler: handler}
+		defer s.Close()
+
+		c := udpServer(t, s)
+		defer c.Close()
+
+		m, err := c.Get("coap://127.0.0.1/hello", messages.WithToken(token))
+		if err != nil {
+			t.Fatalf("Client.Get() error = %v", err)
+		}
+		if !bytes.Equal(m.Token, token) || string(m.Payload) != "hello" {
+			t.Errorf("Client.Get() = %X %q, want %X %q", m.Token, m.Payload, token, "hello")
+		}
+	})
+
+	t.Run("TCP", func(t *testing.T) {
+		s, c, uri := tcpServer(t, handler)
+		defer s.Close()
+		defer c.Close()
+
+		// First response comes after the server's CSM
+		if _, err := c.Get(uri + "/hello"); err != nil {
+			t.Fatal(err)
+		}
+
+		m, err := c.Get(uri+"/hello", messages.WithToken(token))
+		if err != nil {
+			t.Fatalf("Client.Get() error = %v", err)
+		}
+		if !bytes.Equal(m.Token, token) || string(m.Payload) != "hello" {
+			t.Errorf("Client.Get() = %X %q, want %X %q", m.Token, m.Payload, token, "hello")
+		}
+	})
+}
@@ -0,0 +1,104 @@
+package stream
+
+import (
+	"bufio"
+	"crypto/tls"
+	"net"
+	"sync"
+
+	messages "github.com/naspinall/GoAP/pkg/message"
+)
+
+const (
+	DefaultMaxMessageSize = 1152    // Peer message size limit until its CSM arrives
+	MaxMessageSize        = 1 << 16 // Largest message accepted, advertised in our CSM
+	ALPN                  = "coap"  // TLS application protocol for CoAP over TLS
+)
+
+// Conn carries CoAP messages over a reliable, ordered connection (RFC 8323).
+// Messages have no type or message ID, requests and responses are matched
+// by token alone.
+type Conn interface {
+	ReadMessage() (*messages.Message, error)
+	WriteMessage(m *messages.Message) error
+	Close() error
+	LocalAddr() net.Addr
+	RemoteAddr() net.Addr
+}
+
+// tcpConn frames messages with the length prefixed header of CoAP over TCP.
+type tcpConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	mutex  sync.Mutex
+}
+
+// NewTCPConn frames messages over a TCP or TLS connection.
+func NewTCPConn(conn net.Conn) Conn {
+	return &tcpConn{
+		conn:   conn,
+		reader: bufio.NewReader(conn),
+	}
+}
+
+// DialTCP connects to a CoAP over TCP endpoint.
+func DialTCP(address string) (Conn, error) {
+	conn, err := net.Dial("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	return NewTCPConn(conn), nil
+}
+
+// DialTLS connects to a CoAP over TLS endpoint.
+func DialTLS(address string, config *tls.Config) (Conn, error) {
+	conn, err := tls.Dial("tcp", address, TLSConfig(config))
+	if err != nil {
+		return nil, err
+	}
+	return NewTCPConn(conn), nil
+}
+
+// TLSConfig returns a copy of config negotiating the CoAP application
+// protocol.
+func TLSConfig(config *tls.Config) *tls.Config {
+	if config == nil {
+		config = &tls.Config{}
+	}
+
+	config = config.Clone()
+	if len(config.NextProtos) == 0 {
+		config.NextProtos = []string{ALPN}
+	}
+	return config
+}
+
+func (c *tcpConn) ReadMessage() (*messages.Message, error) {
+	return messages.ReadTCP(c.reader, MaxMessageSize)
+}
+
+func (c *tcpConn) WriteMessage(m *messages.Message) error {
+	frame, err := m.EncodeTCP()
+	if err != nil {
+		return err
+	}
+
+	// Frames must not interleave
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	_, err = c.conn.Write(frame)
+	return err
+}
+
+func (c *tcpConn) Close() error {
+	return c.conn.Close()
+}
+
+func (c *tcpConn) LocalAddr() net.Addr {
+	return c.conn.LocalAddr()
+}
+
+func (c *tcpConn) RemoteAddr() net.Addr {
+	return c.conn.RemoteAddr()
+}
@@ -0,0 +1,201 @@
+package stream
+
+import (
+	"crypto/rand"
+	"errors"
+	"sync"
+	"time"
+
+	messages "github.com/naspinall/GoAP/pkg/message"
+)
+
+var (
+	ErrReleased    = errors.New("Connection Released")
+	ErrAborted     = errors.New("Connection Aborted")
+	ErrMissingCSM  = errors.New("Missing Capabilities and Settings Message")
+	ErrPingTimeout = errors.New("Ping Timeout")
+)
+
+// Session handles the signaling messages of a connection (RFC 8323 5),
+// passing requests and responses on to the reader.
+type Session struct {
+	Conn
+
+	mutex              sync.Mutex
+	csm                bool
+	peerMaxMessageSize uint
+	peerBlockWise      bool
+	peerTokenLength    uint
+	pongs              map[string]chan struct{} // By token bytes
+}
+
+// NewSession starts a session by sending our Capabilities and Settings
+// Message, which must be the first message on the connection.
+func NewSession(conn Conn) (*Session, error) {
+	s := &Session{
+		Conn:               conn,
+		peerMaxMessageSize: DefaultMaxMessageSize,
+		peerTokenLength:    messages.MaxTokenLength,
+		pongs:              make(map[string]chan struct{}),
+	}
+
+	csm := &messages.Message{
+		Code: messages.CSM,
+		Signal: &messages.Signal{
+			MaxMessageSize:      MaxMessageSize,
+			BlockWiseTransfer:   true,
+			ExtendedTokenLength: messages.MaxExtendedTokenLength,
+		},
+	}
+	if err := conn.WriteMessage(csm); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// PeerMaxMessageSize is the largest message the peer accepts.
+func (s *Session) PeerMaxMessageSize() uint {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.peerMaxMessageSize
+}
+
+// PeerMaxTokenLength is the longest token the peer accepts, over
+// messages.MaxTokenLength if it supports extended token lengths (RFC 8974).
+func (s *Session) PeerMaxTokenLength() uint {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.peerTokenLength
+}
+
+// PeerBlockWise reports if the peer supports block-wise transfers.
+func (s *Session) PeerBlockWise() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.peerBlockWise
+}
+
+// ReadMessage returns the next request or response, handling signaling
+// messages in between. Release and Abort end the session with an error.
+func (s *Session) ReadMessage() (*messages.Message, error) {
+	for {
+		m, err := s.Conn.ReadMessage()
+		if err == messages.ErrMessageTooLarge {
+			s.Abort("Message Too Large")
+			return nil, err
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		s.mutex.Lock()
+		csm := s.csm
+		s.mutex.Unlock()
+
+		// First message from the peer must be a CSM
+		if !csm && m.Code != messages.CSM {
+			s.Abort("Missing CSM")
+			return nil, ErrMissingCSM
+		}
+
+		if !messages.IsSignal(m.Code) {
+			return m, nil
+		}
+
+		if err := s.signal(m); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (s *Session) signal(m *messages.Message) error {
+	signal := m.Signal
+	if signal == nil {
+		signal = &messages.Signal{}
+	}
+
+	switch m.Code {
+	case messages.CSM:
+		s.mutex.Lock()
+		s.csm = true
+		if signal.MaxMessageSize != 0 {
+			s.peerMaxMessageSize = signal.MaxMessageSize
+		}
+		if signal.BlockWiseTransfer {
+			s.peerBlockWise = true
+		}
+		if signal.ExtendedTokenLength > messages.MaxTokenLength {
+			s.peerTokenLength = signal.ExtendedTokenLength
+		}
+		s.mutex.Unlock()
+
+	case messages.Ping:
+		// Answering with the same token
+		pong := &messages.Message{Code: messages.Pong, Token: m.Token}
+		return s.WriteMessage(pong)
+
+	case messages.Pong:
+		s.mutex.Lock()
+		if pong, ok := s.pongs[string(m.Token)]; ok {
+			close(pong)
+			delete(s.pongs, string(m.Token))
+		}
+		s.mutex.Unlock()
+
+	case messages.Release:
+		s.Close()
+		return ErrReleased
+
+	case messages.Abort:
+		s.Close()
+		return ErrAborted
+	}
+
+	return nil
+}
+
+// Ping checks the peer is alive, waiting up to timeout for the Pong. The
+// session must be read from for the Pong to arrive.
+func (s *Session) Ping(timeout time.Duration) error {
+	token := make([]byte, 8)
+	if _, err := rand.Read(token); err != nil {
+		return err
+	}
+
+	pong := make(chan struct{})
+	s.mutex.Lock()
+	s.pongs[string(token)] = pong
+	s.mutex.Unlock()
+
+	defer func() {
+		s.mutex.Lock()
+		delete(s.pongs, string(token))
+		s.mutex.Unlock()
+	}()
+
+	if err := s.WriteMessage(&messages.Message{Code: messages.Ping, Token: token}); err != nil {
+		return err
+	}
+
+	select {
+	case <-pong:
+		return nil
+	case <-time.After(timeout):
+		return ErrPingTimeout
+	}
+}
+
+// Release gracefully ends the session.
+func (s *Session) Release() error {
+	err := s.WriteMessage(&messages.Message{Code: messages.Release})
+	s.Close()
+	return err
+}
+
+// Abort ends the session because of an error, described in the payload.
+func (s *Session) Abort(reason string) error {
+	err := s.WriteMessage(&messages.Message{Code: messages.Abort, Payload: []byte(reason)})
+	s.Close()
+	return err
+}
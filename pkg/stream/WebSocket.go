@@ -0,0 +1,175 @@
+package stream
+
+import (
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	messages "github.com/naspinall/GoAP/pkg/message"
+	"golang.org/x/net/websocket"
+)
+
+const (
+	WebSocketPath     = "/.well-known/coap" // Resource the WebSocket endpoint is served at
+	WebSocketProtocol = "coap"              // WebSocket subprotocol for CoAP
+)
+
+var (
+	ErrHandshake         = errors.New("WebSocket Handshake Failed")
+	ErrWebSocketProtocol = errors.New("WebSocket Protocol Error")
+)
+
+// Largest WebSocket message, any token plus the options and payload.
+const maxWebSocketMessage = messages.MaxWebSocketOverhead + MaxMessageSize
+
+// Carries one CoAP message in each binary WebSocket message (RFC 8323 4).
+var coapCodec = websocket.Codec{
+	Marshal: func(v interface{}) ([]byte, byte, error) {
+		b, err := v.(*messages.Message).EncodeWebSocket()
+		return b, websocket.BinaryFrame, err
+	},
+	Unmarshal: func(b []byte, payloadType byte, v interface{}) error {
+		if payloadType != websocket.BinaryFrame {
+			return ErrWebSocketProtocol
+		}
+		m, err := messages.FromWebSocket(b)
+		if err != nil {
+			return err
+		}
+		*v.(**messages.Message) = m
+		return nil
+	},
+}
+
+// wsConn is a CoAP over WebSockets connection, with the addresses of the
+// underlying TCP connection.
+type wsConn struct {
+	conn   *websocket.Conn
+	local  net.Addr
+	remote net.Addr
+}
+
+func newWSConn(conn *websocket.Conn, local net.Addr, remote net.Addr) *wsConn {
+	conn.PayloadType = websocket.BinaryFrame
+	conn.MaxPayloadBytes = maxWebSocketMessage
+	return &wsConn{conn: conn, local: local, remote: remote}
+}
+
+// DialWebSocket connects to a CoAP over WebSockets endpoint with a coap+ws
+// or coaps+ws URI, using config for coaps+ws. The endpoint is at
+// /.well-known/coap unless the URI has a path.
+func DialWebSocket(rawurl string, config *tls.Config) (Conn, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), strconv.Itoa(messages.DefaultPort(u.Scheme)))
+	}
+
+	location := &url.URL{Host: u.Host, Path: u.Path, RawPath: u.RawPath, RawQuery: u.RawQuery}
+	if location.Path == "" || location.Path == "/" {
+		location.Path, location.RawPath = WebSocketPath, ""
+	}
+
+	var conn net.Conn
+	switch u.Scheme {
+	case "coap+ws":
+		location.Scheme = "ws"
+		conn, err = net.Dial("tcp", host)
+	case "coaps+ws":
+		if config == nil {
+			config = &tls.Config{}
+		}
+		location.Scheme = "wss"
+		conn, err = tls.Dial("tcp", host, config)
+	default:
+		return nil, errors.New("Unsupported Scheme")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	origin := &url.URL{Scheme: "http", Host: u.Host}
+	if location.Scheme == "wss" {
+		origin.Scheme = "https"
+	}
+
+	wsConfig := &websocket.Config{
+		Location:  location,
+		Origin:    origin,
+		Protocol:  []string{WebSocketProtocol},
+		Version:   websocket.ProtocolVersionHybi13,
+		TlsConfig: config,
+	}
+	ws, err := websocket.NewClient(wsConfig, conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return newWSConn(ws, conn.LocalAddr(), conn.RemoteAddr()), nil
+}
+
+// WebSocketHandler completes the opening handshake of CoAP over WebSockets
+// requests, calling serve with each connection. Requests without the coap
+// subprotocol are refused.
+func WebSocketHandler(serve func(Conn)) http.Handler {
+	return websocket.Server{
+		Handshake: func(config *websocket.Config, r *http.Request) error {
+			for _, protocol := range config.Protocol {
+				if protocol == WebSocketProtocol {
+					config.Protocol = []string{WebSocketProtocol}
+					return nil
+				}
+			}
+			return ErrHandshake
+		},
+		Handler: func(ws *websocket.Conn) {
+			r := ws.Request()
+
+			local, _ := r.Context().Value(http.LocalAddrContextKey).(net.Addr)
+			remote, err := net.ResolveTCPAddr("tcp", r.RemoteAddr)
+			if err != nil {
+				ws.Close()
+				return
+			}
+
+			serve(newWSConn(ws, local, remote))
+		},
+	}
+}
+
+// ReadMessage returns the next CoAP message. WebSocket pings are answered
+// while reading.
+func (c *wsConn) ReadMessage() (*messages.Message, error) {
+	var m *messages.Message
+	err := coapCodec.Receive(c.conn, &m)
+	if err == websocket.ErrFrameTooLarge {
+		return nil, messages.ErrMessageTooLarge
+	}
+	return m, err
+}
+
+// WriteMessage sends the message in a single binary WebSocket message.
+func (c *wsConn) WriteMessage(m *messages.Message) error {
+	return coapCodec.Send(c.conn, m)
+}
+
+// Close sends a close frame and closes the connection.
+func (c *wsConn) Close() error {
+	return c.conn.Close()
+}
+
+func (c *wsConn) LocalAddr() net.Addr {
+	return c.local
+}
+
+func (c *wsConn) RemoteAddr() net.Addr {
+	return c.remote
+}